@@ -9,15 +9,32 @@ type BucketCache struct {
 	*shardedCache
 }
 
+// Options configures a cache created with NewBucketCacheWithOptions.
+type Options = TypedOptions[string, interface{}]
+
+// New returns a single bucket cache. All items share one map and one lock.
+func New(defaultExpiration, cleanupInterval time.Duration) *BucketCache {
+	return NewBucketCache(defaultExpiration, cleanupInterval, 1)
+}
+
 func NewBucketCache(defaultExpiration, cleanupInterval time.Duration, shardnum int) *BucketCache {
-	if defaultExpiration == 0 {
-		defaultExpiration = -1
-	}
-	sc := newShardedCache(shardnum, defaultExpiration)
-	SC := &BucketCache{sc}
-	if cleanupInterval > 0 {
-		runShardedJanitor(sc, cleanupInterval)
-		runtime.SetFinalizer(SC, stopShardedJanitor)
+	return NewBucketCacheWithOptions(Options{
+		DefaultExpiration: defaultExpiration,
+		CleanupInterval:   cleanupInterval,
+		Shards:            shardnum,
+	})
+}
+
+// NewBucketCacheWithOptions returns a cache that is optionally bounded by
+// the number of items and/or their total cost. When a bound is reached, items
+// are evicted according to the selected policy and OnEvicted callbacks run
+// with EvictionCapacity.
+func NewBucketCacheWithOptions(o Options) *BucketCache {
+	sc := newTypedShardedCache(o)
+	SC := &BucketCache{&shardedCache{typedShardedCache: sc}}
+	if o.CleanupInterval > 0 {
+		runJanitor(sc, o.CleanupInterval)
+		runtime.SetFinalizer(SC, (*BucketCache).stopJanitor)
 	}
 	return SC
 }
@@ -1124,6 +1124,79 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteByPrefix(t *testing.T) {
+	tc := NewBucketCache(5*time.Minute, 10*time.Minute, 10)
+	var deleted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		deleted = append(deleted, k)
+	})
+	tc.Set("user:1", "a", DefaultExpiration)
+	tc.Set("user:2", "b", DefaultExpiration)
+	tc.Set("order:1", "c", DefaultExpiration)
+	if n := tc.DeleteByPrefix("user:"); n != 2 {
+		t.Error("expected 2 deleted items, got", n)
+	}
+	if _, found := tc.Get("user:1"); found {
+		t.Error("user:1 was found, but it should have been deleted")
+	}
+	if _, found := tc.Get("order:1"); !found {
+		t.Error("order:1 was not found")
+	}
+	if len(deleted) != 2 {
+		t.Error("OnEvicted was not called for every deleted item:", deleted)
+	}
+}
+
+func TestDeleteByTag(t *testing.T) {
+	tc := NewBucketCache(5*time.Minute, 10*time.Minute, 10)
+	tc.SetWithTags("user:42:profile", "a", DefaultExpiration, "user:42")
+	tc.SetWithTags("user:42:orders", "b", DefaultExpiration, "user:42", "orders")
+	tc.SetWithTags("user:43:orders", "c", DefaultExpiration, "user:43", "orders")
+	tc.Set("other", "d", DefaultExpiration)
+
+	if tags := tc.Tags("user:42:orders"); len(tags) != 2 || tags[0] != "user:42" || tags[1] != "orders" {
+		t.Error("unexpected tags", tags)
+	}
+	if n := tc.DeleteByTag("user:42"); n != 2 {
+		t.Error("expected 2 deleted items, got", n)
+	}
+	if _, found := tc.Get("user:42:profile"); found {
+		t.Error("user:42:profile was found, but it should have been deleted")
+	}
+	if _, found := tc.Get("user:43:orders"); !found {
+		t.Error("user:43:orders was not found")
+	}
+	if n := tc.DeleteByTag("orders"); n != 1 {
+		t.Error("the tag index still contains deleted keys, deleted", n)
+	}
+
+	// setting a key again replaces its tags
+	tc.SetWithTags("k", 1, DefaultExpiration, "old")
+	tc.Set("k", 2, DefaultExpiration)
+	if n := tc.DeleteByTag("old"); n != 0 {
+		t.Error("overwritten item kept its tags")
+	}
+	if _, found := tc.Get("k"); !found {
+		t.Error("k was not found")
+	}
+
+	// expired and evicted items leave the index
+	tc.SetWithTags("e", 1, time.Millisecond, "short")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	for _, c := range tc.cs {
+		if len(c.tags["short"]) != 0 || len(c.keyTags["e"]) != 0 {
+			t.Error("expired item is still indexed")
+		}
+	}
+	bc := NewBucketCacheWithOptions(Options{MaxEntries: 1})
+	bc.SetWithTags("a", 1, DefaultExpiration, "t")
+	bc.SetWithTags("b", 2, DefaultExpiration, "t")
+	if n := bc.DeleteByTag("t"); n != 1 {
+		t.Error("expected the evicted item to be unindexed, deleted", n)
+	}
+}
+
 func TestItemCount(t *testing.T) {
 	tc := NewBucketCache(5*time.Minute, 10*time.Minute, 10)
 	tc.Set("foo", "1", DefaultExpiration)
@@ -6,49 +6,125 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type Item struct {
-	Object     interface{}
+// TypedItem is an item of a cache with values of type V.
+type TypedItem[V any] struct {
+	Object     V
 	Expiration int64
 }
 
+// Item is an item of a BucketCache.
+type Item = TypedItem[interface{}]
+
 // Returns true if the item has expired.
-func (item Item) Expired() bool {
+func (item TypedItem[V]) Expired() bool {
 	if item.Expiration == 0 {
 		return false
 	}
 	return time.Now().UnixNano() > item.Expiration
 }
 
-type cache struct {
+// EvictionReason tells an OnEvictedWithReason callback why an item left the
+// cache.
+type EvictionReason int
+
+const (
+	// The item expired and was removed by the janitor.
+	EvictionExpired EvictionReason = iota + 1
+	// The item was evicted to keep a size-bounded cache within its limits,
+	// or was not admitted by the W-TinyLFU policy.
+	EvictionCapacity
+	// The item was deleted with Delete.
+	EvictionDeleted
+	// The item was overwritten by Set, Replace or an Add of an expired item.
+	EvictionReplaced
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionExpired:
+		return "expired"
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionDeleted:
+		return "deleted"
+	case EvictionReplaced:
+		return "replaced"
+	}
+	return "unknown"
+}
+
+// typedCache is one bucket of a cache: a map with its own lock, eviction
+// policy, tag index, expiry heap and counters. Every cache of this package,
+// generic or not, is made of these buckets.
+type typedCache[K comparable, V any] struct {
+	// stats is the first field so that its 64 bit counters are aligned for
+	// atomic access on 32 bit platforms.
+	stats             counters
 	defaultExpiration time.Duration
-	items             map[string]Item
+	items             map[K]TypedItem[V]
 	mu                sync.RWMutex
-	onEvicted         func(string, interface{})
+	onEvicted         func(K, V)
+	onEvictedReason   func(K, V, EvictionReason)
+
+	// Size bounds of a bounded cache; zero means no bound. policy is nil
+	// for unbounded caches, which keeps their fast path unchanged.
+	maxEntries int
+	maxCost    int64
+	costFunc   func(K, V) int64
+	cost       int64
+	costs      map[K]int64
+	policy     policy[K]
+	// pmu guards policy on the read path, where only mu.RLock is held. It
+	// is always acquired after mu.
+	pmu sync.Mutex
+
+	// tags maps a tag to its keys and keyTags a key to its tags. Both are
+	// nil until an item is set with tags.
+	tags    map[string]map[K]struct{}
+	keyTags map[K][]string
+
+	// expiry holds the expiration times of the items that expire.
+	expiry expiryHeap[K]
+
+	// loading holds the running getOrLoad calls by key; nil when none ran.
+	loading map[K]*loadCall[V]
+}
+
+// cache is a bucket of a BucketCache.
+type cache = typedCache[string, interface{}]
+
+func newTypedCache[K comparable, V any](de time.Duration) *typedCache[K, V] {
+	return &typedCache[K, V]{
+		defaultExpiration: de,
+		items:             map[K]TypedItem[V]{},
+	}
 }
 
-func (c *cache) setRecover(k string, x interface{}, e int64) {
+func (c *typedCache[K, V]) setRecover(k K, x V, e int64) {
 	c.mu.Lock()
 	_, found := c.getkey(k)
 	if found {
 		c.mu.Unlock()
 		return
 	}
-	c.items[k] = Item{
+	evicted := c.store(k, TypedItem[V]{
 		Object:     x,
 		Expiration: e,
-	}
+	})
 	// TODO: Calls to mu.Unlock are currently not deferred because defer
 	// adds ~200 ns (as of go1.)
 	c.mu.Unlock()
+	c.notify(evicted)
 }
 
 // Add an item to the cache, replacing any existing item. If the duration is 0
 // (DefaultExpiration), the cache's default expiration time is used. If it is -1
 // (NoExpiration), the item never expires.
-func (c *cache) set(k string, x interface{}, d time.Duration) {
+func (c *typedCache[K, V]) set(k K, x V, d time.Duration) {
 	// "Inlining" of set
 	var e int64
 	if d == DefaultExpiration {
@@ -58,16 +134,17 @@ func (c *cache) set(k string, x interface{}, d time.Duration) {
 		e = time.Now().Add(d).UnixNano()
 	}
 	c.mu.Lock()
-	c.items[k] = Item{
+	evicted := c.store(k, TypedItem[V]{
 		Object:     x,
 		Expiration: e,
-	}
+	})
 	// TODO: Calls to mu.Unlock are currently not deferred because defer
 	// adds ~200 ns (as of go1.)
 	c.mu.Unlock()
+	c.notify(evicted)
 }
 
-func (c *cache) setkvd(k string, x interface{}, d time.Duration) {
+func (c *typedCache[K, V]) setkvd(k K, x V, d time.Duration) []keyAndValue[K, V] {
 	var e int64
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
@@ -75,105 +152,392 @@ func (c *cache) setkvd(k string, x interface{}, d time.Duration) {
 	if d > 0 {
 		e = time.Now().Add(d).UnixNano()
 	}
-	c.items[k] = Item{
+	return c.store(k, TypedItem[V]{
 		Object:     x,
 		Expiration: e,
+	})
+}
+
+// store writes an item and, for a bounded cache, updates the policy and
+// evicts entries until the cache is within its limits again. The caller must
+// hold c.mu and pass the returned items to notify after releasing it.
+func (c *typedCache[K, V]) store(k K, item TypedItem[V]) []keyAndValue[K, V] {
+	var evicted []keyAndValue[K, V]
+	watched := c.onEvicted != nil || c.onEvictedReason != nil
+	if old, found := c.items[k]; found && watched {
+		evicted = append(evicted, keyAndValue[K, V]{k, old.Object, EvictionReplaced})
+	}
+	c.items[k] = item
+	c.track(k, item.Expiration)
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+	atomic.AddUint64(&c.stats.sets, 1)
+	if c.policy == nil {
+		return evicted
+	}
+
+	if c.costs != nil {
+		n := c.costFunc(k, item.Object)
+		c.cost += n - c.costs[k]
+		c.costs[k] = n
+	}
+	c.pmu.Lock()
+	c.policy.add(k)
+	for (c.maxEntries > 0 && len(c.items) > c.maxEntries) || (c.maxCost > 0 && c.cost > c.maxCost) {
+		victim, ok := c.policy.victim()
+		if !ok {
+			break
+		}
+		c.policy.remove(victim)
+		v := c.items[victim]
+		c.removekey(victim)
+		atomic.AddUint64(&c.stats.evictions, 1)
+		if watched {
+			evicted = append(evicted, keyAndValue[K, V]{victim, v.Object, EvictionCapacity})
+		}
+	}
+	c.pmu.Unlock()
+	return evicted
+}
+
+// removekey deletes k from the item map, the cost accounting and the tag
+// index, but not from the policy.
+func (c *typedCache[K, V]) removekey(k K) {
+	delete(c.items, k)
+	if c.costs != nil {
+		c.cost -= c.costs[k]
+		delete(c.costs, k)
+	}
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+}
+
+// Add an item to the cache, replacing any existing item and its tags, and
+// index it under tags.
+func (c *typedCache[K, V]) setWithTags(k K, x V, d time.Duration, tags []string) {
+	c.mu.Lock()
+	evicted := c.setkvd(k, x, d)
+	// a bounded cache may not have admitted the item
+	if _, found := c.items[k]; found && len(tags) > 0 {
+		c.tag(k, tags)
+	}
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// tag indexes k under tags. The caller must hold c.mu.
+func (c *typedCache[K, V]) tag(k K, tags []string) {
+	if c.keyTags == nil {
+		c.tags = map[string]map[K]struct{}{}
+		c.keyTags = map[K][]string{}
+	}
+	for _, t := range tags {
+		keys, ok := c.tags[t]
+		if !ok {
+			keys = map[K]struct{}{}
+			c.tags[t] = keys
+		}
+		if _, ok := keys[k]; !ok {
+			keys[k] = struct{}{}
+			c.keyTags[k] = append(c.keyTags[k], t)
+		}
+	}
+}
+
+// untag removes k from the tag index. The caller must hold c.mu.
+func (c *typedCache[K, V]) untag(k K) {
+	for _, t := range c.keyTags[k] {
+		keys := c.tags[t]
+		delete(keys, k)
+		if len(keys) == 0 {
+			delete(c.tags, t)
+		}
+	}
+	delete(c.keyTags, k)
+}
+
+// Delete all items set with tag. Returns the number of deleted items.
+func (c *typedCache[K, V]) deleteTag(tag string) int {
+	var evictedItems []keyAndValue[K, V]
+	n := 0
+	c.mu.Lock()
+	for k := range c.tags[tag] {
+		v, evicted := c.deletekey(k, EvictionDeleted)
+		if evicted {
+			evictedItems = append(evictedItems, keyAndValue[K, V]{k, v, EvictionDeleted})
+		}
+		n++
+	}
+	c.mu.Unlock()
+	c.notify(evictedItems)
+	return n
+}
+
+// Returns the tags of k, or nil if it has none.
+func (c *typedCache[K, V]) getTags(k K) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, found := c.getkey(k); !found {
+		return nil
+	}
+	return append([]string(nil), c.keyTags[k]...)
+}
+
+// access records a hit for the eviction policy of a bounded cache. The
+// caller must hold c.mu for reading or writing.
+func (c *typedCache[K, V]) access(k K) {
+	if c.policy != nil {
+		c.pmu.Lock()
+		c.policy.access(k)
+		c.pmu.Unlock()
+	}
+}
+
+// notify runs the eviction callbacks. The legacy OnEvicted callback is not
+// called for overwritten items.
+func (c *typedCache[K, V]) notify(evicted []keyAndValue[K, V]) {
+	if len(evicted) == 0 {
+		return
+	}
+	c.mu.RLock()
+	onEvicted, onEvictedReason := c.onEvicted, c.onEvictedReason
+	c.mu.RUnlock()
+	for _, v := range evicted {
+		if onEvictedReason != nil {
+			onEvictedReason(v.key, v.value, v.reason)
+		}
+		if onEvicted != nil && v.reason != EvictionReplaced {
+			onEvicted(v.key, v.value)
+		}
 	}
 }
 
 // Add an item to the cache, replacing any existing item, using the default
 // expiration.
-func (c *cache) setDefault(k string, x interface{}) {
+func (c *typedCache[K, V]) setDefault(k K, x V) {
 	c.set(k, x, DefaultExpiration)
 }
 
 // Add an item to the cache only if an item doesn't already exist for the given
 // key, or if the existing item has expired. Returns an error otherwise.
-func (c *cache) add(k string, x interface{}, d time.Duration) error {
+func (c *typedCache[K, V]) add(k K, x V, d time.Duration) error {
 	c.mu.Lock()
 	_, found := c.getkey(k)
 	if found {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s already exists", k)
+		return fmt.Errorf("Item %v already exists", k)
 	}
-	c.setkvd(k, x, d)
+	evicted := c.setkvd(k, x, d)
 	c.mu.Unlock()
+	c.notify(evicted)
 	return nil
 }
 
 // Set a new value for the cache key only if it already exists, and the existing
 // item hasn't expired. Returns an error otherwise.
-func (c *cache) replace(k string, x interface{}, d time.Duration) error {
+func (c *typedCache[K, V]) replace(k K, x V, d time.Duration) error {
 	c.mu.Lock()
 	_, found := c.getkey(k)
 	if !found {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s doesn't exist", k)
+		return fmt.Errorf("Item %v doesn't exist", k)
 	}
-	c.setkvd(k, x, d)
+	evicted := c.setkvd(k, x, d)
 	c.mu.Unlock()
+	c.notify(evicted)
 	return nil
 }
 
-// Get an item from the cache. Returns the item or nil, and a bool indicating
+// Returns the existing item for k if it is found. Otherwise sets it to x
+// and returns x. The bool is true if the item was found.
+func (c *typedCache[K, V]) getOrSet(k K, x V, d time.Duration) (V, bool) {
+	c.mu.Lock()
+	if v, found := c.getkey(k); found {
+		c.access(k)
+		c.mu.Unlock()
+		atomic.AddUint64(&c.stats.hits, 1)
+		return v, true
+	}
+	evicted := c.setkvd(k, x, d)
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.misses, 1)
+	c.notify(evicted)
+	return x, false
+}
+
+// loadCall is a getOrLoad call in progress. Concurrent callers for the same
+// key wait for done and share val and err.
+type loadCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// Returns the item for k, calling load to compute and set it if it is not
+// found. load runs without the lock held, and only once at a time per key;
+// concurrent callers wait for its result. Errors are not cached.
+func (c *typedCache[K, V]) getOrLoad(k K, load func(K) (V, error), d time.Duration) (V, error) {
+	c.mu.Lock()
+	if v, found := c.getkey(k); found {
+		c.access(k)
+		c.mu.Unlock()
+		atomic.AddUint64(&c.stats.hits, 1)
+		return v, nil
+	}
+	atomic.AddUint64(&c.stats.misses, 1)
+	if call, ok := c.loading[k]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.val, call.err
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	if c.loading == nil {
+		c.loading = map[K]*loadCall[V]{}
+	}
+	c.loading[k] = call
+	c.mu.Unlock()
+
+	var evicted []keyAndValue[K, V]
+	start := time.Now()
+	defer func() {
+		// a panicking load must not leave the waiting callers blocked
+		r := recover()
+		if r != nil {
+			call.err = fmt.Errorf("gcache: load %v panicked: %v", k, r)
+		}
+		c.recordLoad(time.Since(start), call.err)
+		c.mu.Lock()
+		delete(c.loading, k)
+		if call.err == nil {
+			evicted = c.setkvd(k, call.val, d)
+		}
+		c.mu.Unlock()
+		close(call.done)
+		c.notify(evicted)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	call.val, call.err = load(k)
+	return call.val, call.err
+}
+
+// Sets k to the result of f, which is called with the current item, or nil
+// and false if it is not found. If f returns false as second result, the
+// item is deleted instead. f runs with the lock held and must not use the
+// cache; if it panics, the lock is released and the item left unchanged.
+func (c *typedCache[K, V]) compute(k K, f func(old V, exists bool) (V, bool), d time.Duration) (V, bool) {
+	var evicted []keyAndValue[K, V]
+	x, keep := func() (V, bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		old, exists := c.getkey(k)
+		x, keep := f(old, exists)
+		if keep {
+			evicted = c.setkvd(k, x, d)
+		} else if _, found := c.items[k]; found {
+			if v, ok := c.deletekey(k, EvictionDeleted); ok {
+				evicted = []keyAndValue[K, V]{{k, v, EvictionDeleted}}
+			}
+		}
+		return x, keep
+	}()
+	c.notify(evicted)
+	return x, keep
+}
+
+// Sets k to x only if it is found and its value equals old. old must be
+// comparable, otherwise it panics like ==, after releasing the lock.
+func (c *typedCache[K, V]) compareAndSwap(k K, old, x V, d time.Duration) bool {
+	var evicted []keyAndValue[K, V]
+	swapped := func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		v, found := c.getkey(k)
+		if !found || any(v) != any(old) {
+			return false
+		}
+		evicted = c.setkvd(k, x, d)
+		return true
+	}()
+	c.notify(evicted)
+	return swapped
+}
+
+// Get an item from the cache. Returns the item or the zero value, and a bool indicating
 // whether the key was found.
-func (c *cache) get(k string) (interface{}, bool) {
+func (c *typedCache[K, V]) get(k K) (V, bool) {
+	var zero V
 	c.mu.RLock()
 	// "Inlining" of get and Expired
 	item, found := c.items[k]
 	if !found {
 		c.mu.RUnlock()
-		return nil, false
+		atomic.AddUint64(&c.stats.misses, 1)
+		return zero, false
 	}
 	if item.Expiration > 0 {
 		if time.Now().UnixNano() > item.Expiration {
 			c.mu.RUnlock()
-			return nil, false
+			atomic.AddUint64(&c.stats.misses, 1)
+			return zero, false
 		}
 	}
+	c.access(k)
 	c.mu.RUnlock()
+	atomic.AddUint64(&c.stats.hits, 1)
 	return item.Object, true
 }
 
 // GetWithExpiration returns an item and its expiration time from the cache.
-// It returns the item or nil, the expiration time if one is set (if the item
+// It returns the item or the zero value, the expiration time if one is set (if the item
 // never expires a zero value for time.Time is returned), and a bool indicating
 // whether the key was found.
-func (c *cache) getWithExpiration(k string) (interface{}, time.Time, bool) {
+func (c *typedCache[K, V]) getWithExpiration(k K) (V, time.Time, bool) {
+	var zero V
 	c.mu.RLock()
 	// "Inlining" of get and Expired
 	item, found := c.items[k]
 	if !found {
 		c.mu.RUnlock()
-		return nil, time.Time{}, false
+		atomic.AddUint64(&c.stats.misses, 1)
+		return zero, time.Time{}, false
 	}
 
 	if item.Expiration > 0 {
 		if time.Now().UnixNano() > item.Expiration {
 			c.mu.RUnlock()
-			return nil, time.Time{}, false
+			atomic.AddUint64(&c.stats.misses, 1)
+			return zero, time.Time{}, false
 		}
 
 		// Return the item and the expiration time
+		c.access(k)
 		c.mu.RUnlock()
+		atomic.AddUint64(&c.stats.hits, 1)
 		return item.Object, time.Unix(0, item.Expiration), true
 	}
 
 	// If expiration <= 0 (i.e. no expiration time set) then return the item
 	// and a zeroed time.Time
+	c.access(k)
 	c.mu.RUnlock()
+	atomic.AddUint64(&c.stats.hits, 1)
 	return item.Object, time.Time{}, true
 }
 
-func (c *cache) getkey(k string) (interface{}, bool) {
+func (c *typedCache[K, V]) getkey(k K) (V, bool) {
+	var zero V
 	item, found := c.items[k]
 	if !found {
-		return nil, false
+		return zero, false
 	}
 	// "Inlining" of Expired
 	if item.Expiration > 0 {
 		if time.Now().UnixNano() > item.Expiration {
-			return nil, false
+			return zero, false
 		}
 	}
 	return item.Object, true
@@ -183,8 +547,8 @@ func (c *cache) getkey(k string) (interface{}, bool) {
 // uint8, uint32, or uint64, float32 or float64 by n. Returns an error if the
 // item's value is not an integer, if it was not found, or if it is not
 // possible to increment it by n. To retrieve the incremented value, use one
-// of the specialized methods, e.g. incrementInt64.
-func (c *cache) increment(k string, n int64) error {
+// of the specialized methods, e.g. IncrementInt64.
+func increment(c *cache, k string, n int64) error {
 	c.mu.Lock()
 	v, found := c.items[k]
 	if !found || v.Expired() {
@@ -231,8 +595,8 @@ func (c *cache) increment(k string, n int64) error {
 // item's value is not floating point, if it was not found, or if it is not
 // possible to increment it by n. Pass a negative number to decrement the
 // value. To retrieve the incremented value, use one of the specialized methods,
-// e.g. incrementFloat64.
-func (c *cache) incrementFloat(k string, n float64) error {
+// e.g. IncrementFloat64.
+func incrementFloat(c *cache, k string, n float64) error {
 	c.mu.Lock()
 	v, found := c.items[k]
 	if !found || v.Expired() {
@@ -253,298 +617,48 @@ func (c *cache) incrementFloat(k string, n float64) error {
 	return nil
 }
 
-// increment an item of type int by n. Returns an error if the item's value is
-// not an int, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementInt(k string, n int) (int, error) {
+// update replaces the value of an item with the result of f. Returns an
+// error if the item was not found, or the error of f.
+func (c *typedCache[K, V]) update(k K, f func(V) (V, error)) (V, error) {
+	var zero V
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type int8 by n. Returns an error if the item's value is
-// not an int8, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type int16 by n. Returns an error if the item's value is
-// not an int16, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementInt16(k string, n int16) (int16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type int32 by n. Returns an error if the item's value is
-// not an int32, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementInt32(k string, n int32) (int32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type int64 by n. Returns an error if the item's value is
-// not an int64, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uint by n. Returns an error if the item's value is
-// not an uint, or if it was not found. If there is no error, the incremented
-// value is returned.
-func (c *cache) incrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uintptr by n. Returns an error if the item's value
-// is not an uintptr, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uint8 by n. Returns an error if the item's value
-// is not an uint8, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementUint8(k string, n uint8) (uint8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uint16 by n. Returns an error if the item's value
-// is not an uint16, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementUint16(k string, n uint16) (uint16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uint32 by n. Returns an error if the item's value
-// is not an uint32, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementUint32(k string, n uint32) (uint32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type uint64 by n. Returns an error if the item's value
-// is not an uint64, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// increment an item of type float32 by n. Returns an error if the item's value
-// is not an float32, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementFloat32(k string, n float32) (float32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
+	item, found := c.items[k]
+	if !found || item.Expired() {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return zero, fmt.Errorf("Item %v not found", k)
 	}
-	rv, ok := v.Object.(float32)
-	if !ok {
+	x, err := f(item.Object)
+	if err != nil {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+		return zero, err
 	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
+	item.Object = x
+	c.items[k] = item
 	c.mu.Unlock()
-	return nv, nil
+	return x, nil
 }
 
-// increment an item of type float64 by n. Returns an error if the item's value
-// is not an float64, or if it was not found. If there is no error, the
-// incremented value is returned.
-func (c *cache) incrementFloat64(k string, n float64) (float64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+// updateNumber replaces the value of an item of type T with f(value).
+// Returns an error if the item's value is not a T, or if it was not found.
+func updateNumber[T Number](c *cache, k string, f func(T) T) (T, error) {
+	var res T
+	_, err := c.update(k, func(x interface{}) (interface{}, error) {
+		v, ok := x.(T)
+		if !ok {
+			return nil, fmt.Errorf("The value for %s is not an %T", k, v)
+		}
+		res = f(v)
+		return res, nil
+	})
+	return res, err
 }
 
 // decrement an item of type int, int8, int16, int32, int64, uintptr, uint,
 // uint8, uint32, or uint64, float32 or float64 by n. Returns an error if the
 // item's value is not an integer, if it was not found, or if it is not
 // possible to decrement it by n. To retrieve the decremented value, use one
-// of the specialized methods, e.g. decrementInt64.
-func (c *cache) decrement(k string, n int64) error {
+// of the specialized methods, e.g. DecrementInt64.
+func decrement(c *cache, k string, n int64) error {
 	// TODO: Implement increment and decrement more cleanly.
 	// (Cannot do increment(k, n*-1) for uints.)
 	c.mu.Lock()
@@ -593,8 +707,8 @@ func (c *cache) decrement(k string, n int64) error {
 // item's value is not floating point, if it was not found, or if it is not
 // possible to decrement it by n. Pass a negative number to decrement the
 // value. To retrieve the decremented value, use one of the specialized methods,
-// e.g. decrementFloat64.
-func (c *cache) decrementFloat(k string, n float64) error {
+// e.g. DecrementFloat64.
+func decrementFloat(c *cache, k string, n float64) error {
 	c.mu.Lock()
 	v, found := c.items[k]
 	if !found || v.Expired() {
@@ -615,352 +729,102 @@ func (c *cache) decrementFloat(k string, n float64) error {
 	return nil
 }
 
-// decrement an item of type int by n. Returns an error if the item's value is
-// not an int, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementInt(k string, n int) (int, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type int8 by n. Returns an error if the item's value is
-// not an int8, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type int16 by n. Returns an error if the item's value is
-// not an int16, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementInt16(k string, n int16) (int16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type int32 by n. Returns an error if the item's value is
-// not an int32, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementInt32(k string, n int32) (int32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type int64 by n. Returns an error if the item's value is
-// not an int64, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uint by n. Returns an error if the item's value is
-// not an uint, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uintptr by n. Returns an error if the item's value
-// is not an uintptr, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uint8 by n. Returns an error if the item's value is
-// not an uint8, or if it was not found. If there is no error, the decremented
-// value is returned.
-func (c *cache) decrementUint8(k string, n uint8) (uint8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uint16 by n. Returns an error if the item's value
-// is not an uint16, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementUint16(k string, n uint16) (uint16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uint32 by n. Returns an error if the item's value
-// is not an uint32, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementUint32(k string, n uint32) (uint32, error) {
+// Delete an item from the cache. Does nothing if the key is not in the cache.
+func (c *typedCache[K, V]) delete(k K) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
+	v, evicted := c.deletekey(k, EvictionDeleted)
 	c.mu.Unlock()
-	return nv, nil
-}
-
-// decrement an item of type uint64 by n. Returns an error if the item's value
-// is not an uint64, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
+	if evicted {
+		c.notify([]keyAndValue[K, V]{{k, v, EvictionDeleted}})
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
 }
 
-// decrement an item of type float32 by n. Returns an error if the item's value
-// is not an float32, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementFloat32(k string, n float32) (float32, error) {
+// Delete all items whose key matches. Returns the number of deleted items.
+func (c *typedCache[K, V]) deleteFunc(match func(K) bool) int {
+	var evictedItems []keyAndValue[K, V]
+	n := 0
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
-	}
-	rv, ok := v.Object.(float32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+	for k := range c.items {
+		if match(k) {
+			v, evicted := c.deletekey(k, EvictionDeleted)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue[K, V]{k, v, EvictionDeleted})
+			}
+			n++
+		}
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
 	c.mu.Unlock()
-	return nv, nil
+	c.notify(evictedItems)
+	return n
 }
 
-// decrement an item of type float64 by n. Returns an error if the item's value
-// is not an float64, or if it was not found. If there is no error, the
-// decremented value is returned.
-func (c *cache) decrementFloat64(k string, n float64) (float64, error) {
-	c.mu.Lock()
+// deletekey removes k and counts it as deleted or expired according to
+// reason. It returns the value and true if an eviction callback is set.
+func (c *typedCache[K, V]) deletekey(k K, reason EvictionReason) (V, bool) {
+	var zero V
 	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+	if !found {
+		return zero, false
 	}
-	rv, ok := v.Object.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
+	c.removekey(k)
+	if reason == EvictionExpired {
+		atomic.AddUint64(&c.stats.expirations, 1)
+	} else {
+		atomic.AddUint64(&c.stats.deletes, 1)
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-// Delete an item from the cache. Does nothing if the key is not in the cache.
-func (c *cache) delete(k string) {
-	c.mu.Lock()
-	v, evicted := c.deletekey(k)
-	c.mu.Unlock()
-	if evicted {
-		c.onEvicted(k, v)
+	if c.policy != nil {
+		c.pmu.Lock()
+		c.policy.remove(k)
+		c.pmu.Unlock()
 	}
-}
-
-func (c *cache) deletekey(k string) (interface{}, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
-			return v.Object, true
-		}
+	if c.onEvicted != nil || c.onEvictedReason != nil {
+		return v.Object, true
 	}
-	delete(c.items, k)
-	return nil, false
+	return zero, false
 }
 
-type keyAndValue struct {
-	key   string
-	value interface{}
+type keyAndValue[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
 }
 
-// Delete all expired items from the cache.
-func (c *cache) deleteExpired() {
-	var evictedItems []keyAndValue
+// Delete all expired items from the cache. Only expired items are visited,
+// and the lock is released after every expireBatch items.
+func (c *typedCache[K, V]) deleteExpired() {
 	now := time.Now().UnixNano()
-	c.mu.Lock()
-	for k, v := range c.items {
-		// "Inlining" of expired
-		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.deletekey(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
-			}
+	for {
+		evictedItems, more := c.deleteExpiredBatch(now)
+		c.notify(evictedItems)
+		if !more {
+			return
 		}
 	}
-	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
-	}
 }
 
 // Sets an (optional) function that is called with the key and value when an
 // item is evicted from the cache. (Including when it is deleted manually, but
 // not when it is overwritten.) Set to nil to disable.
-func (c *cache) addEvicted(f func(string, interface{})) {
+func (c *typedCache[K, V]) addEvicted(f func(K, V)) {
 	c.mu.Lock()
 	c.onEvicted = f
 	c.mu.Unlock()
 }
 
+// Sets an (optional) function that is called with the key, value and reason
+// whenever an item leaves the cache, including when it is overwritten. Set to
+// nil to disable.
+func (c *typedCache[K, V]) addEvictedReason(f func(K, V, EvictionReason)) {
+	c.mu.Lock()
+	c.onEvictedReason = f
+	c.mu.Unlock()
+}
+
 // Write the cache's items (using Gob) to an io.Writer.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
-func (c *cache) save(w io.Writer) (err error) {
+func (c *typedCache[K, V]) save(w io.Writer) (err error) {
 	enc := gob.NewEncoder(w)
 	defer func() {
 		if x := recover(); x != nil {
@@ -981,7 +845,7 @@ func (c *cache) save(w io.Writer) (err error) {
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
-func (c *cache) saveFile(fname string) error {
+func (c *typedCache[K, V]) saveFile(fname string) error {
 	fp, err := os.Create(fname)
 	if err != nil {
 		return err
@@ -995,10 +859,10 @@ func (c *cache) saveFile(fname string) error {
 }
 
 // Copies all unexpired items in the cache into a new map and returns it.
-func (c *cache) getItems() map[string]Item {
+func (c *typedCache[K, V]) getItems() map[K]TypedItem[V] {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	m := make(map[string]Item, len(c.items))
+	m := make(map[K]TypedItem[V], len(c.items))
 	now := time.Now().UnixNano()
 	for k, v := range c.items {
 		// "Inlining" of Expired
@@ -1014,7 +878,7 @@ func (c *cache) getItems() map[string]Item {
 
 // Returns the number of items in the cache. This may include items that have
 // expired, but have not yet been cleaned up.
-func (c *cache) getItemCount() int {
+func (c *typedCache[K, V]) getItemCount() int {
 	c.mu.RLock()
 	n := len(c.items)
 	c.mu.RUnlock()
@@ -1022,8 +886,19 @@ func (c *cache) getItemCount() int {
 }
 
 // Delete all items from the cache.
-func (c *cache) flush() {
+func (c *typedCache[K, V]) flush() {
 	c.mu.Lock()
-	c.items = map[string]Item{}
+	c.items = map[K]TypedItem[V]{}
+	if c.policy != nil {
+		c.pmu.Lock()
+		c.policy.reset()
+		c.pmu.Unlock()
+	}
+	if c.costs != nil {
+		c.costs = map[K]int64{}
+		c.cost = 0
+	}
+	c.tags, c.keyTags = nil, nil
+	c.expiry = nil
 	c.mu.Unlock()
 }
@@ -0,0 +1,182 @@
+package gcache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrSet(t *testing.T) {
+	tc := NewBucketCache(time.Millisecond, 0, 4)
+	x, found := tc.GetOrSet("a", 1, DefaultExpiration)
+	if found || x != 1 {
+		t.Error("unexpected result for a new key:", x, found)
+	}
+	x, found = tc.GetOrSet("a", 2, DefaultExpiration)
+	if !found || x != 1 {
+		t.Error("existing item was not returned:", x, found)
+	}
+
+	tc.GetOrSet("b", 1, NoExpiration)
+	<-time.After(5 * time.Millisecond)
+	if x, found := tc.GetOrSet("a", 3, DefaultExpiration); found || x != 3 {
+		t.Error("expired item was returned:", x, found)
+	}
+	if _, found := tc.Get("b"); !found {
+		t.Error("b should never expire")
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	var calls int32
+	load := func(k string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "value of " + k, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, err := tc.GetOrLoad("a", load, time.Hour)
+			if err != nil || x != "value of a" {
+				t.Error("unexpected result:", x, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("expected 1 load, got", n)
+	}
+	if _, exp, _ := tc.GetWithExpiration("a"); time.Until(exp) < 59*time.Minute {
+		t.Error("loaded item has the wrong expiration:", exp)
+	}
+	if s := tc.Stats(); s.Loads != 1 {
+		t.Error("expected the load to be recorded, got", s.Loads)
+	}
+
+	errLoad := errors.New("load failed")
+	_, err := tc.GetOrLoad("b", func(string) (interface{}, error) { return nil, errLoad }, DefaultExpiration)
+	if err != errLoad {
+		t.Error("expected errLoad, got", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("failed load was cached")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic of the loader was not propagated")
+			}
+		}()
+		tc.GetOrLoad("c", func(string) (interface{}, error) { panic("boom") }, DefaultExpiration)
+	}()
+	x, err := tc.GetOrLoad("c", func(string) (interface{}, error) { return 1, nil }, DefaultExpiration)
+	if err != nil || x != 1 {
+		t.Error("key stayed blocked after a panic:", x, err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	incr := func(old interface{}, exists bool) (interface{}, bool) {
+		if !exists {
+			return 1, true
+		}
+		return old.(int) + 1, true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tc.Compute("n", incr, NoExpiration)
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("n"); x != 100 {
+		t.Error("lost updates, n =", x)
+	}
+
+	x, keep := tc.Compute("n", func(old interface{}, exists bool) (interface{}, bool) {
+		return nil, false
+	}, DefaultExpiration)
+	if x != nil || keep {
+		t.Error("unexpected result:", x, keep)
+	}
+	if _, found := tc.Get("n"); found {
+		t.Error("n was not deleted")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	if tc.CompareAndSwap("a", nil, 1, DefaultExpiration) {
+		t.Error("swapped a missing key")
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	if tc.CompareAndSwap("a", 2, 3, DefaultExpiration) {
+		t.Error("swapped although the value did not match")
+	}
+	if !tc.CompareAndSwap("a", 1, 2, time.Millisecond) {
+		t.Error("did not swap a matching value")
+	}
+	if x, _ := tc.Get("a"); x != 2 {
+		t.Error("unexpected value", x)
+	}
+	<-time.After(5 * time.Millisecond)
+	if tc.CompareAndSwap("a", 2, 3, DefaultExpiration) {
+		t.Error("swapped an expired item")
+	}
+}
+
+func TestComputePanic(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 1)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", []int{1}, DefaultExpiration)
+	mustPanic := func(f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		f()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mustPanic(func() {
+			tc.Compute("a", func(old interface{}, exists bool) (interface{}, bool) {
+				panic("boom")
+			}, DefaultExpiration)
+		})
+		// uncomparable values
+		mustPanic(func() {
+			tc.CompareAndSwap("b", []int{1}, 2, DefaultExpiration)
+		})
+
+		// the shard is not left locked and a is unchanged
+		if x, _ := tc.Get("a"); x != 1 {
+			t.Error("unexpected value", x)
+		}
+		tc.Compute("a", func(old interface{}, exists bool) (interface{}, bool) {
+			return old.(int) + 1, true
+		}, DefaultExpiration)
+		if !tc.CompareAndSwap("a", 2, 3, DefaultExpiration) {
+			t.Error("did not swap a matching value")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shard still locked after a panic")
+	}
+}
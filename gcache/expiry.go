@@ -0,0 +1,120 @@
+package gcache
+
+// expiryEntry records that key was set to expire at exp. Entries are not
+// removed when the key is overwritten or deleted; they are skipped when they
+// no longer match the item, and dropped by compact.
+type expiryEntry[K comparable] struct {
+	exp int64
+	key K
+}
+
+// expiryHeap is a min-heap of expiration times, so that the janitor only
+// visits items that have expired instead of scanning the whole shard.
+type expiryHeap[K comparable] []expiryEntry[K]
+
+func (h *expiryHeap[K]) push(e expiryEntry[K]) {
+	*h = append(*h, e)
+	h.up(len(*h) - 1)
+}
+
+func (h *expiryHeap[K]) pop() expiryEntry[K] {
+	old := *h
+	n := len(old) - 1
+	e := old[0]
+	old[0] = old[n]
+	old[n] = expiryEntry[K]{}
+	*h = old[:n]
+	if n > 0 {
+		h.down(0)
+	}
+	return e
+}
+
+func (h expiryHeap[K]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h[parent].exp <= h[i].exp {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+func (h expiryHeap[K]) down(i int) {
+	n := len(h)
+	for {
+		min := i
+		if l := 2*i + 1; l < n && h[l].exp < h[min].exp {
+			min = l
+		}
+		if r := 2*i + 2; r < n && h[r].exp < h[min].exp {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		h[i], h[min] = h[min], h[i]
+		i = min
+	}
+}
+
+// Number of expired items deleted per lock acquisition, so that a large
+// cleanup does not block readers for long.
+const expireBatch = 1024
+
+// track records the expiration of an item that was just stored. The caller
+// must hold c.mu.
+func (c *typedCache[K, V]) track(k K, e int64) {
+	if e <= 0 {
+		return
+	}
+	c.expiry.push(expiryEntry[K]{exp: e, key: k})
+	// Overwritten and deleted items leave stale entries behind. Drop them
+	// once they outnumber the items, which keeps the amortized cost of a
+	// store constant.
+	if len(c.expiry) > 2*len(c.items)+expireBatch {
+		c.compact()
+	}
+}
+
+// compact removes stale entries and rebuilds the heap. The caller must hold
+// c.mu.
+func (c *typedCache[K, V]) compact() {
+	h := c.expiry[:0]
+	for _, e := range c.expiry {
+		if item, found := c.items[e.key]; found && item.Expiration == e.exp {
+			h = append(h, e)
+		}
+	}
+	for i := len(h); i < len(c.expiry); i++ {
+		c.expiry[i] = expiryEntry[K]{}
+	}
+	for i := len(h)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+	c.expiry = h
+}
+
+// deleteExpiredBatch deletes up to expireBatch items that expired before
+// now. It returns the items to notify and whether more may have expired.
+func (c *typedCache[K, V]) deleteExpiredBatch(now int64) ([]keyAndValue[K, V], bool) {
+	var evictedItems []keyAndValue[K, V]
+	c.mu.Lock()
+	for i := 0; i < expireBatch; i++ {
+		if len(c.expiry) == 0 || c.expiry[0].exp >= now {
+			c.mu.Unlock()
+			return evictedItems, false
+		}
+		e := c.expiry.pop()
+		if item, found := c.items[e.key]; !found || item.Expiration != e.exp {
+			continue
+		}
+		ov, evicted := c.deletekey(e.key, EvictionExpired)
+		if evicted {
+			evictedItems = append(evictedItems, keyAndValue[K, V]{e.key, ov, EvictionExpired})
+		}
+	}
+	c.mu.Unlock()
+	return evictedItems, true
+}
@@ -0,0 +1,79 @@
+package gcache
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpiryHeap(t *testing.T) {
+	var h expiryHeap[string]
+	exps := []int64{5, 3, 9, 1, 7, 3, 8}
+	for i, e := range exps {
+		h.push(expiryEntry[string]{exp: e, key: strconv.Itoa(i)})
+	}
+	sort.Slice(exps, func(i, j int) bool { return exps[i] < exps[j] })
+	for _, want := range exps {
+		if got := h.pop().exp; got != want {
+			t.Fatalf("popped %d, want %d", got, want)
+		}
+	}
+	if len(h) != 0 {
+		t.Error("heap is not empty")
+	}
+}
+
+func TestDeleteExpiredStaleEntries(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	tc.Set("extended", 1, time.Millisecond)
+	tc.Set("extended", 2, time.Hour)
+	tc.Set("persisted", 1, time.Millisecond)
+	tc.Set("persisted", 2, NoExpiration)
+	tc.Set("deleted", 1, time.Millisecond)
+	tc.Delete("deleted")
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+
+	if len(evicted) != 2 || evicted[0] != "deleted" || evicted[1] != "expired" {
+		t.Error("unexpected evictions:", evicted)
+	}
+	for _, k := range []string{"extended", "persisted"} {
+		if x, found := tc.Get(k); !found || x != 2 {
+			t.Error(k, "should not have expired:", x)
+		}
+	}
+	if n := len(tc.cs[0].expiry); n != 1 {
+		t.Error("expected only the entry of extended to be left, got", n)
+	}
+}
+
+func TestExpiryCompaction(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 10*expireBatch; i++ {
+		tc.Set("k", i, time.Hour)
+	}
+	c := tc.cs[0]
+	if n := len(c.expiry); n > 2+expireBatch {
+		t.Error("stale entries were not compacted, heap size", n)
+	}
+	tc.DeleteExpired()
+	if x, _ := tc.Get("k"); x != 10*expireBatch-1 {
+		t.Error("unexpected value after compaction:", x)
+	}
+
+	for i := 0; i < 3*expireBatch; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Millisecond)
+	}
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if n := tc.ItemsCount()[0]; n != 1 {
+		t.Error("expected 1 item after several batches, got", n)
+	}
+}
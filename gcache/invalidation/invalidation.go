@@ -0,0 +1,193 @@
+// Package invalidation keeps the local gcache.BucketCache of several
+// instances consistent: an instance that updates or deletes a record
+// publishes the key on a redis channel and every other instance drops it from
+// its local cache.
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/gcache"
+	"github.com/go-crt/golib/redis"
+	"github.com/go-crt/golib/xlog"
+)
+
+// Kinds of invalidation.
+const (
+	kindKeys   = "keys"
+	kindPrefix = "prefix"
+)
+
+type Options struct {
+	// Local is the cache to invalidate. Required.
+	Local *gcache.BucketCache
+	// Redis carries the invalidation messages. Required.
+	Redis *redis.Redis
+	// Channel is the redis channel shared by all instances. Defaults to
+	// "gcache:invalidate"; use one channel per cache.
+	Channel string
+	// InstanceID identifies this instance, so that it ignores its own
+	// messages. Defaults to the hostname, the pid and a random suffix.
+	InstanceID string
+	// FlushOnReconnect flushes the local cache after the subscription was
+	// lost and restored, since invalidations published in the meantime were
+	// missed. Otherwise stale items live until their TTL.
+	FlushOnReconnect bool
+	// OnInvalidate, if set, is called after a remote invalidation was
+	// applied, with the keys or prefixes and whether they are prefixes.
+	OnInvalidate func(names []string, prefix bool)
+	// SubscribeTimeout bounds how long New waits for the subscription to be
+	// confirmed by redis. Defaults to 5s.
+	SubscribeTimeout time.Duration
+}
+
+func (o *Options) checkOptions() error {
+	if o.Local == nil {
+		return errors.New("invalidation: local cache is required")
+	}
+	if o.Redis == nil {
+		return errors.New("invalidation: redis is required")
+	}
+	if o.Channel == "" {
+		o.Channel = "gcache:invalidate"
+	}
+	if o.InstanceID == "" {
+		o.InstanceID = instanceID()
+	}
+	if o.SubscribeTimeout == 0 {
+		o.SubscribeTimeout = 5 * time.Second
+	}
+	return nil
+}
+
+// message is the JSON payload published on the channel.
+type message struct {
+	Source string   `json:"src"`
+	Kind   string   `json:"kind"`
+	Names  []string `json:"names"`
+}
+
+// ErrSubscribeTimeout is returned by New when redis did not confirm the
+// subscription within Options.SubscribeTimeout.
+var ErrSubscribeTimeout = errors.New("invalidation: subscribe timeout")
+
+// Broadcaster publishes local invalidations and applies remote ones.
+type Broadcaster struct {
+	opts Options
+	sub  *redis.Subscriber
+}
+
+// New subscribes to opts.Channel and returns once redis has confirmed the
+// subscription, so that no invalidation published afterwards is missed. Call
+// Close to unsubscribe.
+func New(ctx *gin.Context, opts Options) (*Broadcaster, error) {
+	if err := opts.checkOptions(); err != nil {
+		return nil, err
+	}
+	b := &Broadcaster{opts: opts}
+	subscribed := make(chan struct{})
+	var once sync.Once
+	subOpts := &redis.SubscriberOptions{
+		Handler: b.handle,
+		OnSubscription: func(kind, channel string) {
+			if kind == "subscribe" && channel == opts.Channel {
+				once.Do(func() { close(subscribed) })
+			}
+		},
+	}
+	if opts.FlushOnReconnect {
+		subOpts.OnReconnect = opts.Local.Flush
+	}
+	b.sub = opts.Redis.NewSubscriber(subOpts)
+	if err := b.sub.Subscribe(ctx, opts.Channel); err != nil {
+		b.sub.Close()
+		return nil, err
+	}
+
+	timer := time.NewTimer(opts.SubscribeTimeout)
+	defer timer.Stop()
+	select {
+	case <-subscribed:
+		return b, nil
+	case <-timer.C:
+		b.sub.Close()
+		return nil, ErrSubscribeTimeout
+	}
+}
+
+// Invalidate deletes keys from the local cache and tells the other instances
+// to delete them too. Call it after updating or deleting the records in the
+// source of truth.
+func (b *Broadcaster) Invalidate(ctx *gin.Context, keys ...string) error {
+	for _, k := range keys {
+		b.opts.Local.Delete(k)
+	}
+	return b.publish(ctx, kindKeys, keys)
+}
+
+// InvalidatePrefix deletes all keys starting with one of prefixes, e.g. a
+// namespace like "user:", from the local cache and the other instances.
+func (b *Broadcaster) InvalidatePrefix(ctx *gin.Context, prefixes ...string) error {
+	for _, p := range prefixes {
+		b.opts.Local.DeleteByPrefix(p)
+	}
+	return b.publish(ctx, kindPrefix, prefixes)
+}
+
+func (b *Broadcaster) Close() error {
+	return b.sub.Close()
+}
+
+func (b *Broadcaster) publish(ctx *gin.Context, kind string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(message{Source: b.opts.InstanceID, Kind: kind, Names: names})
+	if err != nil {
+		return err
+	}
+	_, err = b.opts.Redis.Publish(ctx, b.opts.Channel, data)
+	return err
+}
+
+func (b *Broadcaster) handle(msg redis.Message) {
+	var m message
+	if err := json.Unmarshal(msg.Data, &m); err != nil {
+		xlog.WarnLogger(nil, "invalidation decode error: "+err.Error(), xlog.String("channel", msg.Channel))
+		return
+	}
+	if m.Source == b.opts.InstanceID {
+		return
+	}
+	switch m.Kind {
+	case kindKeys:
+		for _, k := range m.Names {
+			b.opts.Local.Delete(k)
+		}
+	case kindPrefix:
+		for _, p := range m.Names {
+			b.opts.Local.DeleteByPrefix(p)
+		}
+	default:
+		xlog.WarnLogger(nil, "invalidation unknown kind: "+m.Kind, xlog.String("channel", msg.Channel))
+		return
+	}
+	if b.opts.OnInvalidate != nil {
+		b.opts.OnInvalidate(m.Names, m.Kind == kindPrefix)
+	}
+}
+
+func instanceID() string {
+	host, _ := os.Hostname()
+	var r [4]byte
+	_, _ = rand.Read(r[:])
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(r[:]))
+}
@@ -0,0 +1,130 @@
+package invalidation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-crt/golib/gcache"
+	"github.com/go-crt/golib/redis"
+)
+
+func newRedis(t *testing.T) *redis.Redis {
+	r, err := redis.InitRedisClient(redis.RedisConf{
+		Service:     "invalidation",
+		Addr:        "127.0.0.1:6379",
+		MaxIdle:     10,
+		MaxActive:   20,
+		ConnTimeOut: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Do(nil, "PING"); err != nil {
+		t.Skip("redis not available: " + err.Error())
+	}
+	return r
+}
+
+type instance struct {
+	local *gcache.BucketCache
+	b     *Broadcaster
+	got   chan []string
+}
+
+func newInstance(t *testing.T, r *redis.Redis, channel string) *instance {
+	in := &instance{
+		local: gcache.NewBucketCache(0, 0, 4),
+		got:   make(chan []string, 10),
+	}
+	b, err := New(nil, Options{
+		Local:   in.local,
+		Redis:   r,
+		Channel: channel,
+		OnInvalidate: func(names []string, prefix bool) {
+			in.got <- names
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.b = b
+	t.Cleanup(func() { b.Close() })
+	return in
+}
+
+func (in *instance) wait(t *testing.T) []string {
+	select {
+	case names := <-in.got:
+		return names
+	case <-time.After(time.Second):
+		t.Fatal("invalidation timeout")
+	}
+	return nil
+}
+
+func TestBroadcaster(t *testing.T) {
+	r := newRedis(t)
+	a := newInstance(t, r, "TestBroadcaster")
+	// New returns once subscribed, invalidations right after it are received
+	b := newInstance(t, r, "TestBroadcaster")
+
+	for _, in := range []*instance{a, b} {
+		in.local.Set("user:1", 1, gcache.DefaultExpiration)
+		in.local.Set("user:2", 2, gcache.DefaultExpiration)
+		in.local.Set("order:1", 3, gcache.DefaultExpiration)
+	}
+
+	if err := a.b.Invalidate(nil, "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	// a updates the key right away; its own message must not delete it
+	a.local.Set("user:1", 10, gcache.DefaultExpiration)
+	if names := b.wait(t); len(names) != 1 || names[0] != "user:1" {
+		t.Error("unexpected invalidation", names)
+	}
+	if _, found := b.local.Get("user:1"); found {
+		t.Error("user:1 was not invalidated remotely")
+	}
+	if _, found := b.local.Get("user:2"); !found {
+		t.Error("user:2 should not have been invalidated")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if x, _ := a.local.Get("user:1"); x != 10 {
+		t.Error("instance applied its own invalidation")
+	}
+
+	if err := b.b.InvalidatePrefix(nil, "user:"); err != nil {
+		t.Fatal(err)
+	}
+	a.wait(t)
+	for _, in := range []*instance{a, b} {
+		if n := in.local.Stats().Items; n != 1 {
+			t.Error("expected only order:1 to be left, got", n, "items")
+		}
+	}
+
+	select {
+	case names := <-a.got:
+		t.Error("instance received its own invalidation", names)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewSubscribeTimeout(t *testing.T) {
+	r, err := redis.InitRedisClient(redis.RedisConf{
+		Service:     "invalidation",
+		Addr:        "127.0.0.1:1",
+		ConnTimeOut: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(nil, Options{
+		Local:            gcache.NewBucketCache(0, 0, 4),
+		Redis:            r,
+		SubscribeTimeout: 100 * time.Millisecond,
+	})
+	if err != ErrSubscribeTimeout {
+		t.Error("expected ErrSubscribeTimeout, got", err)
+	}
+}
@@ -0,0 +1,39 @@
+package loader
+
+import (
+	"github.com/go-crt/golib/gomcpack/mcpack"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Codec serializes values stored in redis.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes values with jsoniter, compatible with encoding/json.
+	JSONCodec Codec = jsonCodec{}
+	// McpackCodec encodes values with mcpack. Values must be structs or maps.
+	McpackCodec Codec = mcpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return jsoniter.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return jsoniter.Unmarshal(data, v)
+}
+
+type mcpackCodec struct{}
+
+func (mcpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return mcpack.Marshal(v)
+}
+
+func (mcpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return mcpack.Unmarshal(data, v)
+}
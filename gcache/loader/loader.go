@@ -0,0 +1,248 @@
+// Package loader implements the cache-aside pattern over a local
+// gcache.BucketCache and an optional redis second level: look in gcache, then
+// in redis, then call the loader and populate both.
+package loader
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/gcache"
+	"github.com/go-crt/golib/redis"
+	"github.com/go-crt/golib/xlog"
+)
+
+// ErrNotFound should be returned by a LoadFunc when the key does not exist in
+// the source of truth. The negative result is cached for NegativeTTL and Get
+// returns ErrNotFound for the key until then.
+var ErrNotFound = errors.New("loader: not found")
+
+// LoadFunc fetches the value for key from the source of truth, e.g. a DB.
+type LoadFunc[V any] func(ctx *gin.Context, key string) (V, error)
+
+type Options struct {
+	// Local is the first level cache. Required.
+	Local *gcache.BucketCache
+	// Redis is the optional second level cache shared by all instances.
+	Redis *redis.Redis
+	// RedisPrefix is prepended to keys stored in redis.
+	RedisPrefix string
+	// Codec serializes values stored in redis. Defaults to JSONCodec.
+	Codec Codec
+
+	// LocalTTL is how long a value is fresh in the local cache. Defaults to 1 minute.
+	LocalTTL time.Duration
+	// RedisTTL is how long a value lives in redis. Defaults to 10 minutes.
+	RedisTTL time.Duration
+	// NegativeTTL is how long ErrNotFound is cached. Defaults to 10 seconds.
+	NegativeTTL time.Duration
+	// StaleTTL is how long a value past LocalTTL may still be served while a
+	// single background refresh runs. 0 disables stale-while-revalidate.
+	StaleTTL time.Duration
+	// Jitter randomly extends every TTL by up to this fraction so that keys
+	// populated together do not expire together. Defaults to 0.1; negative
+	// disables it.
+	Jitter float64
+}
+
+func (o *Options) checkOptions() error {
+	if o.Local == nil {
+		return errors.New("loader: local cache is required")
+	}
+	if o.Codec == nil {
+		o.Codec = JSONCodec
+	}
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = time.Minute
+	}
+	if o.RedisTTL <= 0 {
+		o.RedisTTL = 10 * time.Minute
+	}
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = 10 * time.Second
+	}
+	if o.Jitter == 0 {
+		o.Jitter = 0.1
+	}
+	return nil
+}
+
+// redis values carry a one byte header so that cached misses can be told
+// apart from values.
+const (
+	headerNotFound byte = '0'
+	headerValue    byte = '1'
+)
+
+// entry is what the loader stores in the local cache. fresh is the UnixNano
+// time after which the entry is stale; the gcache expiration additionally
+// covers StaleTTL. refreshing guards against starting more than one
+// background refresh for a stale entry.
+type entry[V any] struct {
+	value      V
+	found      bool
+	fresh      int64
+	refreshing int32
+}
+
+type Loader[V any] struct {
+	opts  Options
+	load  LoadFunc[V]
+	group group
+}
+
+func New[V any](opts Options, load LoadFunc[V]) (*Loader[V], error) {
+	if err := opts.checkOptions(); err != nil {
+		return nil, err
+	}
+	return &Loader[V]{opts: opts, load: load}, nil
+}
+
+// Get returns the value for key. Concurrent misses for the same key share a
+// single load. A stale local value is returned immediately while one
+// background refresh runs.
+func (l *Loader[V]) Get(ctx *gin.Context, key string) (V, error) {
+	if x, found := l.opts.Local.Get(key); found {
+		e := x.(*entry[V])
+		if time.Now().UnixNano() > e.fresh && atomic.CompareAndSwapInt32(&e.refreshing, 0, 1) {
+			go l.refresh(copyContext(ctx), key, e)
+		}
+		return e.result()
+	}
+
+	x, err, _ := l.group.do(key, func() (interface{}, error) {
+		return l.fetch(ctx, key, true)
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return x.(*entry[V]).result()
+}
+
+// Delete removes key from the local cache and from redis.
+func (l *Loader[V]) Delete(ctx *gin.Context, key string) error {
+	l.opts.Local.Delete(key)
+	if l.opts.Redis == nil {
+		return nil
+	}
+	_, err := l.opts.Redis.Del(ctx, l.opts.RedisPrefix+key)
+	return err
+}
+
+// refresh reloads a stale entry. On failure the stale entry is kept and the
+// next Get retries.
+func (l *Loader[V]) refresh(ctx *gin.Context, key string, stale *entry[V]) {
+	_, err, _ := l.group.do(key, func() (interface{}, error) {
+		return l.fetch(ctx, key, false)
+	})
+	if err != nil {
+		atomic.StoreInt32(&stale.refreshing, 0)
+		xlog.WarnLogger(ctx, "loader refresh error: "+err.Error(), xlog.String("key", key))
+	}
+}
+
+// fetch looks in redis and then calls the loader, populating both levels.
+// A background refresh skips redis, since the redis copy is at least as old
+// as the stale local one.
+func (l *Loader[V]) fetch(ctx *gin.Context, key string, useRedis bool) (*entry[V], error) {
+	if useRedis && l.opts.Redis != nil {
+		if e, ok := l.getRedis(ctx, key); ok {
+			l.setLocal(key, e)
+			return e, nil
+		}
+	}
+
+	start := time.Now()
+	v, err := l.load(ctx, key)
+	if err != nil && err != ErrNotFound {
+		l.opts.Local.RecordLoad(key, time.Since(start), err)
+		return nil, err
+	}
+	l.opts.Local.RecordLoad(key, time.Since(start), nil)
+	e := &entry[V]{value: v, found: err == nil}
+	l.setLocal(key, e)
+	l.setRedis(ctx, key, e)
+	return e, nil
+}
+
+func (l *Loader[V]) getRedis(ctx *gin.Context, key string) (*entry[V], bool) {
+	data, err := l.opts.Redis.Get(ctx, l.opts.RedisPrefix+key)
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	e := &entry[V]{}
+	switch data[0] {
+	case headerNotFound:
+	case headerValue:
+		if err := l.opts.Codec.Unmarshal(data[1:], &e.value); err != nil {
+			xlog.WarnLogger(ctx, "loader decode error: "+err.Error(), xlog.String("key", key))
+			return nil, false
+		}
+		e.found = true
+	default:
+		return nil, false
+	}
+	return e, true
+}
+
+func (l *Loader[V]) setRedis(ctx *gin.Context, key string, e *entry[V]) {
+	if l.opts.Redis == nil {
+		return
+	}
+	data := []byte{headerNotFound}
+	ttl := l.opts.NegativeTTL
+	if e.found {
+		b, err := l.opts.Codec.Marshal(e.value)
+		if err != nil {
+			xlog.WarnLogger(ctx, "loader encode error: "+err.Error(), xlog.String("key", key))
+			return
+		}
+		data = append([]byte{headerValue}, b...)
+		ttl = l.opts.RedisTTL
+	}
+	ms := l.jitter(ttl).Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	if _, err := l.opts.Redis.Do(ctx, "SET", l.opts.RedisPrefix+key, data, "PX", ms); err != nil {
+		xlog.WarnLogger(ctx, "loader set redis error: "+err.Error(), xlog.String("key", key))
+	}
+}
+
+func (l *Loader[V]) setLocal(key string, e *entry[V]) {
+	ttl, stale := l.opts.LocalTTL, l.opts.StaleTTL
+	if !e.found {
+		ttl, stale = l.opts.NegativeTTL, 0
+	}
+	ttl = l.jitter(ttl)
+	e.fresh = time.Now().Add(ttl).UnixNano()
+	l.opts.Local.Set(key, e, ttl+stale)
+}
+
+func (l *Loader[V]) jitter(d time.Duration) time.Duration {
+	if l.opts.Jitter <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(int64(float64(d)*l.opts.Jitter)+1))
+}
+
+func (e *entry[V]) result() (V, error) {
+	if !e.found {
+		var zero V
+		return zero, ErrNotFound
+	}
+	return e.value, nil
+}
+
+// copyContext returns a copy of ctx that is safe to use after the request
+// has finished, as required by gin for goroutines.
+func copyContext(ctx *gin.Context) *gin.Context {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Copy()
+}
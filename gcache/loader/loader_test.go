@@ -0,0 +1,181 @@
+package loader
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/gcache"
+	"github.com/go-crt/golib/redis"
+)
+
+type user struct {
+	Id   int64  `json:"id" mcpack:"id"`
+	Name string `json:"name" mcpack:"name"`
+}
+
+func newRedis(t *testing.T) *redis.Redis {
+	r, err := redis.InitRedisClient(redis.RedisConf{
+		Service:     "loader",
+		Addr:        "127.0.0.1:6379",
+		MaxIdle:     10,
+		MaxActive:   20,
+		ConnTimeOut: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Do(nil, "PING"); err != nil {
+		t.Skip("redis not available: " + err.Error())
+	}
+	return r
+}
+
+func TestLoaderSingleflight(t *testing.T) {
+	var calls int32
+	l, err := New(Options{Local: gcache.NewBucketCache(0, 0, 4)}, func(ctx *gin.Context, key string) (user, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return user{Id: 1, Name: key}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := l.Get(nil, "alice")
+			if err != nil || u.Name != "alice" {
+				t.Error("unexpected result:", u, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("expected 1 load, got", n)
+	}
+}
+
+func TestLoaderNegativeAndError(t *testing.T) {
+	var calls int32
+	errDB := errors.New("db down")
+	local := gcache.NewBucketCache(0, 0, 4)
+	l, _ := New(Options{Local: local, NegativeTTL: 50 * time.Millisecond, Jitter: -1},
+		func(ctx *gin.Context, key string) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			if key == "down" {
+				return "", errDB
+			}
+			return "", ErrNotFound
+		})
+
+	for i := 0; i < 3; i++ {
+		if _, err := l.Get(nil, "missing"); err != ErrNotFound {
+			t.Error("expected ErrNotFound, got", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("negative result was not cached, loads:", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, _ = l.Get(nil, "missing")
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error("negative result did not expire, loads:", n)
+	}
+
+	// errors other than ErrNotFound are not cached
+	_, err := l.Get(nil, "down")
+	_, err = l.Get(nil, "down")
+	if err != errDB {
+		t.Error("expected errDB, got", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Error("error result was cached, loads:", n)
+	}
+	if s := local.Stats(); s.Loads != 4 || s.LoadErrors != 2 {
+		t.Errorf("unexpected load stats: %d loads, %d errors", s.Loads, s.LoadErrors)
+	}
+}
+
+func TestLoaderStaleWhileRevalidate(t *testing.T) {
+	var version int32
+	l, _ := New(Options{
+		Local:    gcache.NewBucketCache(0, 0, 4),
+		LocalTTL: 20 * time.Millisecond,
+		StaleTTL: time.Second,
+		Jitter:   -1,
+	}, func(ctx *gin.Context, key string) (int32, error) {
+		return atomic.AddInt32(&version, 1), nil
+	})
+
+	if v, _ := l.Get(nil, "k"); v != 1 {
+		t.Fatal("expected 1, got", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// stale value is served while the refresh runs in background
+	if v, _ := l.Get(nil, "k"); v != 1 {
+		t.Error("expected stale 1, got", v)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if v, _ := l.Get(nil, "k"); v == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("value was not refreshed")
+}
+
+func TestLoaderRedis(t *testing.T) {
+	r := newRedis(t)
+	defer r.Close()
+
+	for name, codec := range map[string]Codec{"json": JSONCodec, "mcpack": McpackCodec} {
+		var calls int32
+		load := func(ctx *gin.Context, key string) (user, error) {
+			atomic.AddInt32(&calls, 1)
+			if key == "nobody" {
+				return user{}, ErrNotFound
+			}
+			return user{Id: 42, Name: key}, nil
+		}
+		opts := Options{Redis: r, RedisPrefix: "TestLoaderRedis:" + name + ":", Codec: codec}
+		_, _ = r.Del(nil, opts.RedisPrefix+"bob", opts.RedisPrefix+"nobody")
+
+		opts.Local = gcache.NewBucketCache(0, 0, 4)
+		l1, _ := New(opts, load)
+		u, err := l1.Get(nil, "bob")
+		if err != nil || u.Id != 42 {
+			t.Error(name, "unexpected result:", u, err)
+		}
+		_, _ = l1.Get(nil, "nobody")
+
+		// another instance with an empty local cache reads through redis
+		opts.Local = gcache.NewBucketCache(0, 0, 4)
+		l2, _ := New(opts, load)
+		u, err = l2.Get(nil, "bob")
+		if err != nil || u != (user{Id: 42, Name: "bob"}) {
+			t.Error(name, "unexpected result from redis:", u, err)
+		}
+		if _, err = l2.Get(nil, "nobody"); err != ErrNotFound {
+			t.Error(name, "expected cached ErrNotFound, got", err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Error(name, "expected 2 loads, got", n)
+		}
+
+		if err := l2.Delete(nil, "bob"); err != nil {
+			t.Error(name, err)
+		}
+		if data, _ := r.Get(nil, opts.RedisPrefix+"bob"); data != nil {
+			t.Error(name, "redis key was not deleted")
+		}
+		_, _ = r.Del(nil, opts.RedisPrefix+"nobody")
+	}
+}
@@ -0,0 +1,44 @@
+package loader
+
+import "sync"
+
+// call is an in-flight or completed load for a key.
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// group collapses concurrent loads of the same key into one, like
+// golang.org/x/sync/singleflight without the forget/channel variants.
+type group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// do runs fn once for all concurrent callers with the same key. shared
+// reports whether the result was produced by another caller.
+func (g *group) do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,106 @@
+// Package metrics exports gcache statistics to Prometheus. It is a separate
+// module so that golib itself does not depend on the Prometheus client.
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/go-crt/golib/gcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsSource is implemented by *gcache.BucketCache.
+type StatsSource interface {
+	Stats() gcache.CacheStats
+}
+
+// Collector is a prometheus.Collector that reports the stats of the caches
+// registered with Add. Every metric is labeled by cache name and shard, so
+// that hot or skewed shards are visible.
+type Collector struct {
+	mu     sync.RWMutex
+	caches map[string]StatsSource
+
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	sets        *prometheus.Desc
+	deletes     *prometheus.Desc
+	expirations *prometheus.Desc
+	evictions   *prometheus.Desc
+	loads       *prometheus.Desc
+	loadErrors  *prometheus.Desc
+	loadSeconds *prometheus.Desc
+	items       *prometheus.Desc
+}
+
+// NewCollector returns a collector whose metrics are prefixed with
+// namespace, e.g. "myapp" yields myapp_gcache_hits_total.
+func NewCollector(namespace string) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "gcache", name), help, []string{"cache", "shard"}, nil)
+	}
+	return &Collector{
+		caches:      map[string]StatsSource{},
+		hits:        desc("hits_total", "Number of reads that found an item."),
+		misses:      desc("misses_total", "Number of reads that found no item or an expired one."),
+		sets:        desc("sets_total", "Number of items written."),
+		deletes:     desc("deletes_total", "Number of items deleted."),
+		expirations: desc("expirations_total", "Number of expired items removed."),
+		evictions:   desc("evictions_total", "Number of items evicted to stay within the size bounds."),
+		loads:       desc("loads_total", "Number of loads from the source of truth."),
+		loadErrors:  desc("load_errors_total", "Number of loads that failed."),
+		loadSeconds: desc("load_seconds_total", "Total time spent loading, in seconds."),
+		items:       desc("items", "Current number of items, including expired items not cleaned up yet."),
+	}
+}
+
+// Add registers cache under name, replacing any cache with the same name.
+func (c *Collector) Add(name string, cache StatsSource) {
+	c.mu.Lock()
+	c.caches[name] = cache
+	c.mu.Unlock()
+}
+
+// Remove unregisters the cache with the given name.
+func (c *Collector) Remove(name string) {
+	c.mu.Lock()
+	delete(c.caches, name)
+	c.mu.Unlock()
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.expirations
+	ch <- c.evictions
+	ch <- c.loads
+	ch <- c.loadErrors
+	ch <- c.loadSeconds
+	ch <- c.items
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, cache := range c.caches {
+		for i, s := range cache.Stats().Shards {
+			shard := strconv.Itoa(i)
+			counter := func(d *prometheus.Desc, v float64) {
+				ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, name, shard)
+			}
+			counter(c.hits, float64(s.Hits))
+			counter(c.misses, float64(s.Misses))
+			counter(c.sets, float64(s.Sets))
+			counter(c.deletes, float64(s.Deletes))
+			counter(c.expirations, float64(s.Expirations))
+			counter(c.evictions, float64(s.Evictions))
+			counter(c.loads, float64(s.Loads))
+			counter(c.loadErrors, float64(s.LoadErrors))
+			counter(c.loadSeconds, s.LoadTime.Seconds())
+			ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(s.Items), name, shard)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/go-crt/golib/gcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	tc := gcache.NewBucketCache(0, 0, 2)
+	tc.Set("a", 1, gcache.DefaultExpiration)
+	tc.Get("a")
+	tc.Get("b")
+
+	c := NewCollector("test")
+	c.Add("users", tc)
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := map[string]float64{}
+	for _, mf := range mfs {
+		if len(mf.GetMetric()) != 2 {
+			t.Errorf("%s: expected one metric per shard, got %d", mf.GetName(), len(mf.GetMetric()))
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "cache" && l.GetValue() != "users" {
+					t.Error("unexpected cache label", l.GetValue())
+				}
+			}
+			if m.Counter != nil {
+				totals[mf.GetName()] += m.Counter.GetValue()
+			} else {
+				totals[mf.GetName()] += m.Gauge.GetValue()
+			}
+		}
+	}
+	for name, want := range map[string]float64{
+		"test_gcache_hits_total":   1,
+		"test_gcache_misses_total": 1,
+		"test_gcache_sets_total":   1,
+		"test_gcache_items":        1,
+	} {
+		if totals[name] != want {
+			t.Errorf("%s = %v, want %v", name, totals[name], want)
+		}
+	}
+
+	c.Remove("users")
+	if mfs, _ := reg.Gather(); len(mfs) != 0 {
+		t.Error("removed cache is still collected")
+	}
+}
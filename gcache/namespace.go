@@ -0,0 +1,87 @@
+package gcache
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TypedNamespace groups keys under a common name and generation. Invalidate
+// starts a new generation in O(1): the keys of the previous generations are
+// no longer visible and are removed in the background.
+//
+// Keys are stored in the cache as name + "\x00" + generation + "\x00" + key.
+type TypedNamespace[V any] struct {
+	sc   *typedShardedCache[string, V]
+	name string
+	gen  uint64
+}
+
+// Namespace is a namespace of a BucketCache.
+type Namespace = TypedNamespace[interface{}]
+
+// Namespace returns the namespace with the given name. All calls with the
+// same name return the same Namespace, so they share its generation.
+func (sc *shardedCache) Namespace(name string) *Namespace {
+	return NamespaceOf[interface{}](sc, name)
+}
+
+// NamespaceOf returns the namespace with the given name of a cache with
+// string keys, like the Namespace method of BucketCache.
+func NamespaceOf[V any](c Buckets[string, V], name string) *TypedNamespace[V] {
+	sc := c.sharded()
+	if ns, ok := sc.namespaces.Load(name); ok {
+		return ns.(*TypedNamespace[V])
+	}
+	ns, _ := sc.namespaces.LoadOrStore(name, &TypedNamespace[V]{sc: sc, name: name})
+	return ns.(*TypedNamespace[V])
+}
+
+func (ns *TypedNamespace[V]) Name() string {
+	return ns.name
+}
+
+// Generation returns the current generation, which starts at 0 and is
+// incremented by every Invalidate.
+func (ns *TypedNamespace[V]) Generation() uint64 {
+	return atomic.LoadUint64(&ns.gen)
+}
+
+func (ns *TypedNamespace[V]) prefix(gen uint64) string {
+	return ns.name + "\x00" + strconv.FormatUint(gen, 10) + "\x00"
+}
+
+// Key returns the cache key of k in the current generation, for use with the
+// methods of the cache that Namespace does not wrap.
+func (ns *TypedNamespace[V]) Key(k string) string {
+	return ns.prefix(ns.Generation()) + k
+}
+
+func (ns *TypedNamespace[V]) Set(k string, x V, d time.Duration) {
+	ns.sc.Set(ns.Key(k), x, d)
+}
+
+func (ns *TypedNamespace[V]) SetWithTags(k string, x V, d time.Duration, tags ...string) {
+	ns.sc.SetWithTags(ns.Key(k), x, d, tags...)
+}
+
+func (ns *TypedNamespace[V]) Get(k string) (V, bool) {
+	return ns.sc.Get(ns.Key(k))
+}
+
+func (ns *TypedNamespace[V]) Delete(k string) {
+	ns.sc.Delete(ns.Key(k))
+}
+
+// Invalidate makes all keys of the namespace invisible by starting a new
+// generation, and deletes the items of the previous generation in a
+// background goroutine. An item set concurrently with Invalidate may land
+// in the previous generation after it was cleaned up; it is never visible
+// and stays until it expires or is evicted.
+func (ns *TypedNamespace[V]) Invalidate() {
+	prefix := ns.prefix(atomic.AddUint64(&ns.gen, 1) - 1)
+	go ns.sc.DeleteFunc(func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
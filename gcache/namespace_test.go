@@ -0,0 +1,54 @@
+package gcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	users := tc.Namespace("user")
+	if tc.Namespace("user") != users {
+		t.Fatal("Namespace returned different instances for the same name")
+	}
+	orders := tc.Namespace("order")
+
+	users.Set("42", "alice", DefaultExpiration)
+	orders.Set("42", "book", DefaultExpiration)
+	if x, found := users.Get("42"); !found || x != "alice" {
+		t.Error("unexpected user 42:", x, found)
+	}
+	if x, _ := tc.Get(users.Key("42")); x != "alice" {
+		t.Error("Key does not match the stored key")
+	}
+
+	users.Invalidate()
+	if users.Generation() != 1 {
+		t.Error("expected generation 1, got", users.Generation())
+	}
+	if _, found := users.Get("42"); found {
+		t.Error("user 42 is visible after Invalidate")
+	}
+	if x, _ := orders.Get("42"); x != "book" {
+		t.Error("Invalidate affected another namespace")
+	}
+
+	users.Set("42", "bob", DefaultExpiration)
+	if x, _ := users.Get("42"); x != "bob" {
+		t.Error("unexpected user 42 in the new generation:", x)
+	}
+
+	// the previous generation is deleted in the background
+	deadline := time.Now().Add(time.Second)
+	for tc.Stats().Items != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := tc.Stats().Items; n != 2 {
+		t.Error("previous generation was not cleaned up, items:", n)
+	}
+
+	users.Delete("42")
+	if _, found := users.Get("42"); found {
+		t.Error("user 42 was not deleted")
+	}
+}
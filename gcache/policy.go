@@ -0,0 +1,418 @@
+package gcache
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// EvictionPolicy selects which entry a size-bounded cache evicts when it is
+// full.
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evicts the least recently used entry.
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evicts the least frequently used entry, the oldest first
+	// among entries with the same frequency.
+	PolicyLFU
+	// PolicyTinyLFU is W-TinyLFU: new entries go to a small LRU window and
+	// are only admitted to the main SLRU region if a frequency sketch shows
+	// they are used more often than the entry they would replace. It keeps
+	// one-off keys from flushing the hot set.
+	PolicyTinyLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case PolicyTinyLFU:
+		return "tinylfu"
+	}
+	return "unknown"
+}
+
+// policy tracks key usage for a size-bounded cache. Implementations are not
+// safe for concurrent use; the cache serializes calls.
+type policy[K comparable] interface {
+	// add records a key that was just inserted.
+	add(k K)
+	// access records a hit on an existing key.
+	access(k K)
+	// remove forgets a key that left the cache.
+	remove(k K)
+	// victim returns the key that should be evicted next. It may return a
+	// key that was just added, which means the new entry is not admitted.
+	victim() (K, bool)
+	// reset forgets all keys.
+	reset()
+}
+
+// newPolicy returns the policy p. hash is only used by PolicyTinyLFU.
+func newPolicy[K comparable](p EvictionPolicy, capacity int, hash func(K) uint64) policy[K] {
+	switch p {
+	case PolicyLFU:
+		return newLFU[K]()
+	case PolicyTinyLFU:
+		return newTinyLFU(capacity, hash)
+	}
+	return newLRU[K]()
+}
+
+type lruPolicy[K comparable] struct {
+	ll    *list.List
+	elems map[K]*list.Element
+}
+
+func newLRU[K comparable]() *lruPolicy[K] {
+	return &lruPolicy[K]{ll: list.New(), elems: map[K]*list.Element{}}
+}
+
+func (p *lruPolicy[K]) add(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.elems[k] = p.ll.PushFront(k)
+}
+
+func (p *lruPolicy[K]) access(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy[K]) remove(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, k)
+	}
+}
+
+func (p *lruPolicy[K]) victim() (K, bool) {
+	if e := p.ll.Back(); e != nil {
+		return e.Value.(K), true
+	}
+	var zero K
+	return zero, false
+}
+
+func (p *lruPolicy[K]) reset() {
+	p.ll.Init()
+	p.elems = map[K]*list.Element{}
+}
+
+// lfuEntry is an element of the lfu min-heap, ordered by frequency and then
+// by the time of the last access.
+type lfuEntry[K comparable] struct {
+	key   K
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+type lfuHeap[K comparable] []*lfuEntry[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap[K]) Push(x interface{}) {
+	e := x.(*lfuEntry[K])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap[K]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+type lfuPolicy[K comparable] struct {
+	h     lfuHeap[K]
+	elems map[K]*lfuEntry[K]
+	tick  uint64
+	// added is the key inserted last. It is not chosen as victim, otherwise
+	// a new entry, having the lowest frequency, would always evict itself.
+	added K
+}
+
+func newLFU[K comparable]() *lfuPolicy[K] {
+	return &lfuPolicy[K]{elems: map[K]*lfuEntry[K]{}}
+}
+
+func (p *lfuPolicy[K]) add(k K) {
+	if _, ok := p.elems[k]; ok {
+		p.access(k)
+		return
+	}
+	p.tick++
+	e := &lfuEntry[K]{key: k, freq: 1, tick: p.tick}
+	p.elems[k] = e
+	p.added = k
+	heap.Push(&p.h, e)
+}
+
+func (p *lfuPolicy[K]) access(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.tick++
+		e.freq++
+		e.tick = p.tick
+		heap.Fix(&p.h, e.index)
+	}
+}
+
+func (p *lfuPolicy[K]) remove(k K) {
+	if e, ok := p.elems[k]; ok {
+		heap.Remove(&p.h, e.index)
+		delete(p.elems, k)
+	}
+}
+
+func (p *lfuPolicy[K]) victim() (K, bool) {
+	if len(p.h) == 0 {
+		var zero K
+		return zero, false
+	}
+	if p.h[0].key != p.added || len(p.h) == 1 {
+		return p.h[0].key, true
+	}
+	// the second smallest element is one of the root's children
+	i := 1
+	if len(p.h) > 2 && p.h.Less(2, 1) {
+		i = 2
+	}
+	return p.h[i].key, true
+}
+
+func (p *lfuPolicy[K]) reset() {
+	p.h = nil
+	p.elems = map[K]*lfuEntry[K]{}
+	var zero K
+	p.added = zero
+}
+
+// Segments of the W-TinyLFU policy.
+const (
+	segWindow = iota
+	segProbation
+	segProtected
+)
+
+type tinyLFUEntry[K comparable] struct {
+	key K
+	seg int
+}
+
+// tinyLFUPolicy implements W-TinyLFU with a 1% LRU window in front of a
+// segmented LRU main region (20% probation, 80% protected). Segment sizes are
+// relative to the current number of entries so that the policy also works
+// for caches bounded by cost only.
+type tinyLFUPolicy[K comparable] struct {
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	elems     map[K]*list.Element
+	sketch    *cmSketch[K]
+	// candidate is the key that most recently overflowed from the window
+	// into probation. It has to prove that it is used more often than the
+	// probation victim to stay in the cache.
+	candidate    K
+	hasCandidate bool
+}
+
+func newTinyLFU[K comparable](capacity int, hash func(K) uint64) *tinyLFUPolicy[K] {
+	return &tinyLFUPolicy[K]{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		elems:     map[K]*list.Element{},
+		sketch:    newCMSketch(capacity, hash),
+	}
+}
+
+func (p *tinyLFUPolicy[K]) add(k K) {
+	p.sketch.increment(k)
+	if _, ok := p.elems[k]; ok {
+		p.touch(k)
+		return
+	}
+	p.elems[k] = p.window.PushFront(&tinyLFUEntry[K]{key: k, seg: segWindow})
+
+	windowSize := len(p.elems) / 100
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	for p.window.Len() > windowSize {
+		entry := p.window.Remove(p.window.Back()).(*tinyLFUEntry[K])
+		entry.seg = segProbation
+		p.elems[entry.key] = p.probation.PushFront(entry)
+		p.candidate, p.hasCandidate = entry.key, true
+	}
+}
+
+func (p *tinyLFUPolicy[K]) access(k K) {
+	p.sketch.increment(k)
+	p.touch(k)
+}
+
+// touch moves k to the front of its segment, promoting probation entries to
+// protected and demoting the protected tail when protected grows too big.
+func (p *tinyLFUPolicy[K]) touch(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*tinyLFUEntry[K])
+	switch entry.seg {
+	case segWindow:
+		p.window.MoveToFront(e)
+	case segProtected:
+		p.protected.MoveToFront(e)
+	case segProbation:
+		p.probation.Remove(e)
+		entry.seg = segProtected
+		p.elems[k] = p.protected.PushFront(entry)
+		if max := (p.probation.Len() + p.protected.Len()) * 8 / 10; p.protected.Len() > max {
+			demoted := p.protected.Remove(p.protected.Back()).(*tinyLFUEntry[K])
+			demoted.seg = segProbation
+			p.elems[demoted.key] = p.probation.PushFront(demoted)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K]) remove(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	switch e.Value.(*tinyLFUEntry[K]).seg {
+	case segWindow:
+		p.window.Remove(e)
+	case segProbation:
+		p.probation.Remove(e)
+	case segProtected:
+		p.protected.Remove(e)
+	}
+	delete(p.elems, k)
+	if p.hasCandidate && p.candidate == k {
+		var zero K
+		p.candidate, p.hasCandidate = zero, false
+	}
+}
+
+// victim evicts either the probation LRU entry or the candidate that just
+// left the window, whichever the frequency sketch estimates to be used less.
+func (p *tinyLFUPolicy[K]) victim() (K, bool) {
+	var victim *list.Element
+	if victim = p.probation.Back(); victim == nil {
+		if victim = p.protected.Back(); victim == nil {
+			if victim = p.window.Back(); victim == nil {
+				var zero K
+				return zero, false
+			}
+		}
+	}
+	vk := victim.Value.(*tinyLFUEntry[K]).key
+
+	ck := p.candidate
+	if e, ok := p.elems[ck]; !p.hasCandidate || !ok || ck == vk || e.Value.(*tinyLFUEntry[K]).seg != segProbation {
+		return vk, true
+	}
+	if p.sketch.estimate(ck) > p.sketch.estimate(vk) {
+		return vk, true
+	}
+	return ck, true
+}
+
+func (p *tinyLFUPolicy[K]) reset() {
+	p.window.Init()
+	p.probation.Init()
+	p.protected.Init()
+	p.elems = map[K]*list.Element{}
+	p.sketch.reset()
+	var zero K
+	p.candidate, p.hasCandidate = zero, false
+}
+
+// cmSketch is a count-min sketch with 4 rows of saturating 8 bit counters.
+// All counters are halved after every 10*width increments so that the
+// frequencies reflect recent history.
+type cmSketch[K comparable] struct {
+	rows      [4][]uint8
+	mask      uint64
+	hash      func(K) uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch[K comparable](capacity int, hash func(K) uint64) *cmSketch[K] {
+	width := 1024
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch[K]{
+		mask:    uint64(width - 1),
+		hash:    hash,
+		resetAt: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch[K]) increment(k K) {
+	h := s.hash(k)
+	for i := range s.rows {
+		idx := (h + uint64(i)*(h>>32)) & s.mask
+		if s.rows[i][idx] < 255 {
+			s.rows[i][idx]++
+		}
+	}
+	if s.additions++; s.additions >= s.resetAt {
+		s.age()
+	}
+}
+
+func (s *cmSketch[K]) estimate(k K) uint8 {
+	h := s.hash(k)
+	min := uint8(255)
+	for i := range s.rows {
+		if v := s.rows[i][(h+uint64(i)*(h>>32))&s.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *cmSketch[K]) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *cmSketch[K]) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,157 @@
+package gcache
+
+import (
+	"strconv"
+	"testing"
+)
+
+type evictionRecord struct {
+	key    string
+	reason EvictionReason
+}
+
+func newBoundedCache(policy EvictionPolicy, maxEntries int) (*BucketCache, *[]evictionRecord) {
+	tc := NewBucketCacheWithOptions(Options{MaxEntries: maxEntries, Policy: policy})
+	var evicted []evictionRecord
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictionReason) {
+		evicted = append(evicted, evictionRecord{k, reason})
+	})
+	return tc, &evicted
+}
+
+func TestBoundedLRU(t *testing.T) {
+	tc, evicted := newBoundedCache(PolicyLRU, 3)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a")
+	tc.Set("d", 4, DefaultExpiration)
+
+	if _, found := tc.Get("b"); found {
+		t.Error("b should have been evicted as least recently used")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, found := tc.Get(k); !found {
+			t.Error(k, "should still be cached")
+		}
+	}
+	if len(*evicted) != 1 || (*evicted)[0] != (evictionRecord{"b", EvictionCapacity}) {
+		t.Error("unexpected evictions:", *evicted)
+	}
+}
+
+func TestBoundedLFU(t *testing.T) {
+	tc, _ := newBoundedCache(PolicyLFU, 3)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	for i := 0; i < 3; i++ {
+		tc.Get("a")
+		tc.Get("c")
+	}
+	tc.Get("b")
+	tc.Set("d", 4, DefaultExpiration)
+
+	if _, found := tc.Get("b"); found {
+		t.Error("b should have been evicted as least frequently used")
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a should still be cached")
+	}
+}
+
+func TestBoundedTinyLFU(t *testing.T) {
+	tc, _ := newBoundedCache(PolicyTinyLFU, 100)
+	for i := 0; i < 100; i++ {
+		tc.Set("hot"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 100; i++ {
+			tc.Get("hot" + strconv.Itoa(i))
+		}
+	}
+	// a scan of one-off keys must not flush the frequently used ones
+	for i := 0; i < 1000; i++ {
+		tc.Set("scan"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	hits := 0
+	for i := 0; i < 100; i++ {
+		if _, found := tc.Get("hot" + strconv.Itoa(i)); found {
+			hits++
+		}
+	}
+	if hits < 90 {
+		t.Error("expected most hot keys to survive the scan, got", hits)
+	}
+	if n := tc.ItemsCount()[0]; n > 100 {
+		t.Error("cache exceeded its bound:", n)
+	}
+}
+
+func TestBoundedCost(t *testing.T) {
+	tc := NewBucketCacheWithOptions(Options{
+		MaxCost: 10,
+		Cost: func(k string, x interface{}) int64 {
+			return int64(len(x.(string)))
+		},
+	})
+	tc.Set("a", "1234", DefaultExpiration)
+	tc.Set("b", "1234", DefaultExpiration)
+	tc.Set("c", "1234", DefaultExpiration)
+	if _, found := tc.Get("a"); found {
+		t.Error("a should have been evicted by cost")
+	}
+	// replacing an item updates its cost
+	tc.Set("b", "1", DefaultExpiration)
+	tc.Set("d", "12345", DefaultExpiration)
+	for _, k := range []string{"b", "c", "d"} {
+		if _, found := tc.Get(k); !found {
+			t.Error(k, "should still be cached")
+		}
+	}
+}
+
+func TestBoundedShards(t *testing.T) {
+	tc := NewBucketCacheWithOptions(Options{Shards: 4, MaxEntries: 40})
+	for i := 0; i < 1000; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	for i, n := range tc.ItemsCount() {
+		if n > 10 {
+			t.Error("shard", i, "exceeded its bound:", n)
+		}
+	}
+}
+
+func TestOnEvictedWithReason(t *testing.T) {
+	tc, evicted := newBoundedCache(PolicyLRU, 10)
+	legacy := 0
+	tc.OnEvicted(func(string, interface{}) { legacy++ })
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Replace("a", 3, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("b", 1, 1)
+	for _, found := tc.Get("b"); found; _, found = tc.Get("b") {
+	}
+	tc.DeleteExpired()
+
+	want := []evictionRecord{
+		{"a", EvictionReplaced},
+		{"a", EvictionReplaced},
+		{"a", EvictionDeleted},
+		{"b", EvictionExpired},
+	}
+	if len(*evicted) != len(want) {
+		t.Fatal("unexpected evictions:", *evicted)
+	}
+	for i := range want {
+		if (*evicted)[i] != want[i] {
+			t.Error("eviction", i, "got", (*evicted)[i], "want", want[i])
+		}
+	}
+	if legacy != 2 {
+		t.Error("OnEvicted should not be called for replaced items, calls:", legacy)
+	}
+}
@@ -1,14 +1,12 @@
 package gcache
 
 import (
-	"crypto/rand"
 	"encoding/gob"
 	"fmt"
 	"io"
-	"math"
-	"math/big"
-	insecurerand "math/rand"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,11 +28,25 @@ const (
 //
 // See cache_test.go for a few benchmarks.
 
-type shardedCache struct {
-	seed    uint32
+// typedShardedCache is the implementation of every cache of this package: a
+// set of buckets, each with its own map and lock, selected by the hash of the
+// key. Cache, ShardedCache and BucketCache are thin wrappers around it.
+type typedShardedCache[K comparable, V any] struct {
+	hash    func(K) uint32
 	m       uint32
-	cs      []*cache
-	janitor *shardedJanitor
+	cs      []*typedCache[K, V]
+	janitor *janitor
+
+	namespaces sync.Map
+}
+
+// shardedCache is the typedShardedCache of a BucketCache. It adds the
+// operations that only make sense for string keys and interface{} values.
+type shardedCache struct {
+	*typedShardedCache[string, interface{}]
+
+	snapshotMu  sync.Mutex
+	snapshotter *snapshotter
 }
 
 // djb2 with better shuffling. 5x faster than FNV with the hash.Hash overhead.
@@ -69,201 +81,378 @@ func djb33(seed uint32, k string) uint32 {
 	return d ^ (d >> 16)
 }
 
-func (sc *shardedCache) bucket(k string) *cache {
+func (sc *typedShardedCache[K, V]) bucket(k K) *typedCache[K, V] {
 	if sc.m == 1 {
 		return sc.cs[0]
 	}
-	return sc.cs[djb33(sc.seed, k)%sc.m]
+	return sc.cs[sc.hash(k)%sc.m]
+}
+
+func (sc *typedShardedCache[K, V]) sharded() *typedShardedCache[K, V] {
+	return sc
 }
-func (sc *shardedCache) SetRecover(k string, x interface{}, e int64) {
+
+func (sc *typedShardedCache[K, V]) SetRecover(k K, x V, e int64) {
 	sc.bucket(k).setRecover(k, x, e)
 }
 
-func (sc *shardedCache) Set(k string, x interface{}, d time.Duration) {
+func (sc *typedShardedCache[K, V]) Set(k K, x V, d time.Duration) {
 	sc.bucket(k).set(k, x, d)
 }
 
-func (sc *shardedCache) SetDefault(k string, x interface{}) {
+// SetWithTags adds an item like Set and indexes it under tags, so that it
+// can be deleted with DeleteByTag. Setting the key again replaces its tags.
+// Tags are not saved in snapshots.
+func (sc *typedShardedCache[K, V]) SetWithTags(k K, x V, d time.Duration, tags ...string) {
+	sc.bucket(k).setWithTags(k, x, d, tags)
+}
+
+// Tags returns the tags of the item k, or nil if it is not found or has no
+// tags.
+func (sc *typedShardedCache[K, V]) Tags(k K) []string {
+	return sc.bucket(k).getTags(k)
+}
+
+func (sc *typedShardedCache[K, V]) SetDefault(k K, x V) {
 	sc.bucket(k).set(k, x, DefaultExpiration)
 }
 
-func (sc *shardedCache) Add(k string, x interface{}, d time.Duration) error {
+func (sc *typedShardedCache[K, V]) Add(k K, x V, d time.Duration) error {
 	return sc.bucket(k).add(k, x, d)
 }
 
-func (sc *shardedCache) Replace(k string, x interface{}, d time.Duration) error {
+func (sc *typedShardedCache[K, V]) Replace(k K, x V, d time.Duration) error {
 	return sc.bucket(k).replace(k, x, d)
 }
 
-func (sc *shardedCache) Get(k string) (interface{}, bool) {
+// GetOrSet returns the existing item for k if it is found. Otherwise it sets
+// k to x and returns x. The bool is true if the item was found.
+func (sc *typedShardedCache[K, V]) GetOrSet(k K, x V, d time.Duration) (V, bool) {
+	return sc.bucket(k).getOrSet(k, x, d)
+}
+
+// GetOrLoad returns the item for k. If it is not found, load is called to
+// compute it and the result is set with duration d. Concurrent calls for the
+// same key share one call of load, which runs without the shard lock held.
+// Errors are returned to all waiting callers but not cached.
+func (sc *typedShardedCache[K, V]) GetOrLoad(k K, load func(k K) (V, error), d time.Duration) (V, error) {
+	return sc.bucket(k).getOrLoad(k, load, d)
+}
+
+// Compute atomically sets k to the result of f, which is called with the
+// current item, or the zero value and false if it is not found. If f returns
+// false as second result, the item is deleted instead. f runs with the shard
+// lock held and must not use the cache.
+func (sc *typedShardedCache[K, V]) Compute(k K, f func(old V, exists bool) (V, bool), d time.Duration) (V, bool) {
+	return sc.bucket(k).compute(k, f, d)
+}
+
+// CompareAndSwap sets k to x only if it is found and its value equals old.
+// It panics if the values are not comparable.
+func (sc *typedShardedCache[K, V]) CompareAndSwap(k K, old, x V, d time.Duration) bool {
+	return sc.bucket(k).compareAndSwap(k, old, x, d)
+}
+
+func (sc *typedShardedCache[K, V]) Get(k K) (V, bool) {
 	return sc.bucket(k).get(k)
 }
 
-func (sc *shardedCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+func (sc *typedShardedCache[K, V]) GetWithExpiration(k K) (V, time.Time, bool) {
 	return sc.bucket(k).getWithExpiration(k)
 }
 
+func (sc *typedShardedCache[K, V]) Delete(k K) {
+	sc.bucket(k).delete(k)
+}
+
+// DeleteFunc deletes all items whose key matches and returns the number of
+// deleted items. It scans every shard.
+func (sc *typedShardedCache[K, V]) DeleteFunc(match func(k K) bool) int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.deleteFunc(match)
+	}
+	return n
+}
+
+// DeleteByTag deletes all items set with tag and returns the number of
+// deleted items. Unlike DeleteFunc it only visits the tagged items.
+func (sc *typedShardedCache[K, V]) DeleteByTag(tag string) int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.deleteTag(tag)
+	}
+	return n
+}
+
+func (sc *typedShardedCache[K, V]) DeleteExpired() {
+	for _, v := range sc.cs {
+		v.deleteExpired()
+	}
+}
+
+func (sc *typedShardedCache[K, V]) OnEvicted(f func(K, V)) {
+	for _, v := range sc.cs {
+		v.addEvicted(f)
+	}
+}
+
+// OnEvictedWithReason sets a function that is called whenever an item leaves
+// the cache, with the reason it left. Unlike OnEvicted it is also called for
+// overwritten items. Both callbacks may be set at the same time.
+func (sc *typedShardedCache[K, V]) OnEvictedWithReason(f func(K, V, EvictionReason)) {
+	for _, v := range sc.cs {
+		v.addEvictedReason(f)
+	}
+}
+
+// Returns the unexpired items of every shard.
+func (sc *typedShardedCache[K, V]) Items() []map[K]TypedItem[V] {
+	res := make([]map[K]TypedItem[V], len(sc.cs))
+	for i, v := range sc.cs {
+		res[i] = v.getItems()
+	}
+	return res
+}
+
+func (sc *typedShardedCache[K, V]) ItemsCount() []int {
+	res := make([]int, len(sc.cs))
+	for i, v := range sc.cs {
+		res[i] = v.getItemCount()
+	}
+	return res
+}
+
+func (sc *typedShardedCache[K, V]) Flush() {
+	for _, v := range sc.cs {
+		v.flush()
+	}
+}
+
+// increment an item of type int, int8, int16, int32, int64, uintptr, uint,
+// uint8, uint32, or uint64, float32 or float64 by n. Returns an error if the
+// item's value is not an integer, if it was not found, or if it is not
+// possible to increment it by n. To retrieve the incremented value, use one
+// of the specialized methods, e.g. IncrementInt64.
 func (sc *shardedCache) Increment(k string, n int64) error {
-	return sc.bucket(k).increment(k, n)
+	return increment(sc.bucket(k), k, n)
 }
 
+// increment an item of type int by n. Returns an error if the item's value is
+// not an int, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementInt(k string, n int) (int, error) {
-	return sc.bucket(k).incrementInt(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int) int { return v + n })
 }
 
+// increment an item of type int8 by n. Returns an error if the item's value is
+// not an int8, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementInt8(k string, n int8) (int8, error) {
-	return sc.bucket(k).incrementInt8(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int8) int8 { return v + n })
 }
 
+// increment an item of type int16 by n. Returns an error if the item's value is
+// not an int16, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementInt16(k string, n int16) (int16, error) {
-	return sc.bucket(k).incrementInt16(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int16) int16 { return v + n })
 }
 
+// increment an item of type int32 by n. Returns an error if the item's value is
+// not an int32, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementInt32(k string, n int32) (int32, error) {
-	return sc.bucket(k).incrementInt32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int32) int32 { return v + n })
 }
 
+// increment an item of type int64 by n. Returns an error if the item's value is
+// not an int64, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementInt64(k string, n int64) (int64, error) {
-	return sc.bucket(k).incrementInt64(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int64) int64 { return v + n })
 }
 
+// increment an item of type uint by n. Returns an error if the item's value is
+// not an uint, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUint(k string, n uint) (uint, error) {
-	return sc.bucket(k).incrementUint(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint) uint { return v + n })
 }
 
+// increment an item of type uintptr by n. Returns an error if the item's value is
+// not an uintptr, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
-	return sc.bucket(k).incrementUintptr(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uintptr) uintptr { return v + n })
 }
 
+// increment an item of type uint8 by n. Returns an error if the item's value is
+// not an uint8, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUint8(k string, n uint8) (uint8, error) {
-	return sc.bucket(k).incrementUint8(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint8) uint8 { return v + n })
 }
 
+// increment an item of type uint16 by n. Returns an error if the item's value is
+// not an uint16, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUint16(k string, n uint16) (uint16, error) {
-	return sc.bucket(k).incrementUint16(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint16) uint16 { return v + n })
 }
 
+// increment an item of type uint32 by n. Returns an error if the item's value is
+// not an uint32, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUint32(k string, n uint32) (uint32, error) {
-	return sc.bucket(k).incrementUint32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint32) uint32 { return v + n })
 }
 
+// increment an item of type uint64 by n. Returns an error if the item's value is
+// not an uint64, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementUint64(k string, n uint64) (uint64, error) {
-	return sc.bucket(k).incrementUint64(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint64) uint64 { return v + n })
 }
 
+// increment an item of type float32 or float64 by n. Returns an error if the
+// item's value is not floating point, if it was not found, or if it is not
+// possible to increment it by n. Pass a negative number to decrement the
+// value. To retrieve the incremented value, use one of the specialized methods,
+// e.g. IncrementFloat64.
 func (sc *shardedCache) IncrementFloat(k string, n float64) error {
-	return sc.bucket(k).incrementFloat(k, n)
+	return incrementFloat(sc.bucket(k), k, n)
 }
 
+// increment an item of type float32 by n. Returns an error if the item's value is
+// not an float32, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementFloat32(k string, n float32) (float32, error) {
-	return sc.bucket(k).incrementFloat32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v float32) float32 { return v + n })
 }
 
+// increment an item of type float64 by n. Returns an error if the item's value is
+// not an float64, or if it was not found. If there is no error, the incremented
+// value is returned.
 func (sc *shardedCache) IncrementFloat64(k string, n float64) (float64, error) {
-	return sc.bucket(k).incrementFloat64(k, n)
+	return updateNumber(sc.bucket(k), k, func(v float64) float64 { return v + n })
 }
 
+// decrement an item of type int, int8, int16, int32, int64, uintptr, uint,
+// uint8, uint32, or uint64, float32 or float64 by n. Returns an error if the
+// item's value is not an integer, if it was not found, or if it is not
+// possible to decrement it by n. To retrieve the decremented value, use one
+// of the specialized methods, e.g. DecrementInt64.
 func (sc *shardedCache) Decrement(k string, n int64) error {
-	return sc.bucket(k).decrement(k, n)
+	return decrement(sc.bucket(k), k, n)
 }
 
+// decrement an item of type int by n. Returns an error if the item's value is
+// not an int, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementInt(k string, n int) (int, error) {
-	return sc.bucket(k).decrementInt(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int) int { return v - n })
 }
 
+// decrement an item of type int8 by n. Returns an error if the item's value is
+// not an int8, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementInt8(k string, n int8) (int8, error) {
-	return sc.bucket(k).decrementInt8(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int8) int8 { return v - n })
 }
 
+// decrement an item of type int16 by n. Returns an error if the item's value is
+// not an int16, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementInt16(k string, n int16) (int16, error) {
-	return sc.bucket(k).decrementInt16(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int16) int16 { return v - n })
 }
 
+// decrement an item of type int32 by n. Returns an error if the item's value is
+// not an int32, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementInt32(k string, n int32) (int32, error) {
-	return sc.bucket(k).decrementInt32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int32) int32 { return v - n })
 }
 
+// decrement an item of type int64 by n. Returns an error if the item's value is
+// not an int64, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementInt64(k string, n int64) (int64, error) {
-	return sc.bucket(k).decrementInt64(k, n)
+	return updateNumber(sc.bucket(k), k, func(v int64) int64 { return v - n })
 }
 
+// decrement an item of type uint by n. Returns an error if the item's value is
+// not an uint, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUint(k string, n uint) (uint, error) {
-	return sc.bucket(k).decrementUint(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint) uint { return v - n })
 }
 
+// decrement an item of type uintptr by n. Returns an error if the item's value is
+// not an uintptr, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
-	return sc.bucket(k).decrementUintptr(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uintptr) uintptr { return v - n })
 }
 
+// decrement an item of type uint8 by n. Returns an error if the item's value is
+// not an uint8, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUint8(k string, n uint8) (uint8, error) {
-	return sc.bucket(k).decrementUint8(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint8) uint8 { return v - n })
 }
 
+// decrement an item of type uint16 by n. Returns an error if the item's value is
+// not an uint16, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUint16(k string, n uint16) (uint16, error) {
-	return sc.bucket(k).decrementUint16(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint16) uint16 { return v - n })
 }
 
+// decrement an item of type uint32 by n. Returns an error if the item's value is
+// not an uint32, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUint32(k string, n uint32) (uint32, error) {
-	return sc.bucket(k).decrementUint32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint32) uint32 { return v - n })
 }
 
+// decrement an item of type uint64 by n. Returns an error if the item's value is
+// not an uint64, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementUint64(k string, n uint64) (uint64, error) {
-	return sc.bucket(k).decrementUint64(k, n)
+	return updateNumber(sc.bucket(k), k, func(v uint64) uint64 { return v - n })
 }
 
+// decrement an item of type float32 or float64 by n. Returns an error if the
+// item's value is not floating point, if it was not found, or if it is not
+// possible to decrement it by n. Pass a negative number to decrement the
+// value. To retrieve the decremented value, use one of the specialized methods,
+// e.g. DecrementFloat64.
 func (sc *shardedCache) DecrementFloat(k string, n float64) error {
-	return sc.bucket(k).decrementFloat(k, n)
+	return decrementFloat(sc.bucket(k), k, n)
 }
 
+// decrement an item of type float32 by n. Returns an error if the item's value is
+// not an float32, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementFloat32(k string, n float32) (float32, error) {
-	return sc.bucket(k).decrementFloat32(k, n)
+	return updateNumber(sc.bucket(k), k, func(v float32) float32 { return v - n })
 }
 
+// decrement an item of type float64 by n. Returns an error if the item's value is
+// not an float64, or if it was not found. If there is no error, the decremented
+// value is returned.
 func (sc *shardedCache) DecrementFloat64(k string, n float64) (float64, error) {
-	return sc.bucket(k).decrementFloat64(k, n)
-}
-
-func (sc *shardedCache) Delete(k string) {
-	sc.bucket(k).delete(k)
-}
-
-func (sc *shardedCache) DeleteExpired() {
-	for _, v := range sc.cs {
-		v.deleteExpired()
-	}
-}
-
-func (sc *shardedCache) OnEvicted(f func(string, interface{})) {
-	for _, v := range sc.cs {
-		v.addEvicted(f)
-	}
+	return updateNumber(sc.bucket(k), k, func(v float64) float64 { return v - n })
 }
 
-// Returns the items in the cache. This may include items that have expired,
-// but have not yet been cleaned up. If this is significant, the Expiration
-// fields of the items should be checked. Note that explicit synchronization
-// is needed to use a cache and its corresponding Items() return values at
-// the same time, as the maps are shared.
-func (sc *shardedCache) Items() []map[string]Item {
-	res := make([]map[string]Item, len(sc.cs))
-	for i, v := range sc.cs {
-		res[i] = v.getItems()
-	}
-	return res
-}
-
-func (sc *shardedCache) ItemsCount() []int {
-	res := make([]int, len(sc.cs))
-	for i, v := range sc.cs {
-		res[i] = v.getItemCount()
-	}
-	return res
-}
-
-func (sc *shardedCache) Flush() {
-	for _, v := range sc.cs {
-		v.flush()
-	}
+// DeleteByPrefix deletes all items whose key starts with prefix and returns
+// the number of deleted items. It scans every shard.
+func (sc *shardedCache) DeleteByPrefix(prefix string) int {
+	return sc.DeleteFunc(func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
 }
 
 func (sc *shardedCache) SaveFile(fname string) error {
@@ -300,57 +489,92 @@ func (sc *shardedCache) Load(r io.Reader) error {
 	return err
 }
 
-type shardedJanitor struct {
+type janitor struct {
 	Interval time.Duration
 	stop     chan bool
 }
 
-func (j *shardedJanitor) Run(sc *shardedCache) {
-	j.stop = make(chan bool)
-	tick := time.Tick(j.Interval)
+func (j *janitor) Run(deleteExpired func()) {
+	tick := time.NewTicker(j.Interval)
+	defer tick.Stop()
 	for {
 		select {
-		case <-tick:
-			sc.DeleteExpired()
+		case <-tick.C:
+			deleteExpired()
 		case <-j.stop:
 			return
 		}
 	}
 }
 
-func stopShardedJanitor(sc *BucketCache) {
-	sc.janitor.stop <- true
-}
-
-func runShardedJanitor(sc *shardedCache, ci time.Duration) {
-	j := &shardedJanitor{
+// runJanitor deletes the expired items of sc every ci. The janitor only
+// references sc, so that the wrapper returned to the user can be garbage
+// collected and its finalizer can call stopJanitor.
+func runJanitor[K comparable, V any](sc *typedShardedCache[K, V], ci time.Duration) {
+	j := &janitor{
 		Interval: ci,
+		stop:     make(chan bool),
 	}
 	sc.janitor = j
-	go j.Run(sc)
+	go j.Run(sc.DeleteExpired)
 }
 
-func newShardedCache(n int, de time.Duration) *shardedCache {
-	max := big.NewInt(0).SetUint64(uint64(math.MaxUint32))
-	rnd, err := rand.Int(rand.Reader, max)
-	var seed uint32
-	if err != nil {
-		os.Stderr.Write([]byte("WARNING: go-cache's newShardedCache failed to read from the system CSPRNG (/dev/urandom or equivalent.) Your system's security may be compromised. Continuing with an insecure seed.\n"))
-		seed = insecurerand.Uint32()
-	} else {
-		seed = uint32(rnd.Uint64())
+func (sc *typedShardedCache[K, V]) stopJanitor() {
+	sc.janitor.stop <- true
+}
+
+// bound makes every shard size-bounded, splitting the limits evenly.
+func (sc *typedShardedCache[K, V]) bound(o TypedOptions[K, V]) {
+	n := len(sc.cs)
+	maxEntries := (o.MaxEntries + n - 1) / n
+	maxCost := (o.MaxCost + int64(n) - 1) / int64(n)
+	cost := o.Cost
+	if cost == nil {
+		cost = func(K, V) int64 { return 1 }
 	}
-	sc := &shardedCache{
-		seed: seed,
-		m:    uint32(n),
-		cs:   make([]*cache, n),
+	var hash func(K) uint64
+	if o.Policy == PolicyTinyLFU {
+		if hash = sketchHash(o.Hash); hash == nil {
+			var zero K
+			panic(fmt.Sprintf("gcache: PolicyTinyLFU needs a Hash for key type %T", zero))
+		}
 	}
-	for i := 0; i < n; i++ {
-		c := &cache{
-			defaultExpiration: de,
-			items:             map[string]Item{},
+	for _, c := range sc.cs {
+		c.maxEntries = maxEntries
+		c.policy = newPolicy(o.Policy, maxEntries, hash)
+		if maxCost > 0 {
+			c.maxCost = maxCost
+			c.costFunc = cost
+			c.costs = map[K]int64{}
 		}
-		sc.cs[i] = c
+	}
+}
+
+// newTypedShardedCache returns the cache described by o, without a janitor.
+func newTypedShardedCache[K comparable, V any](o TypedOptions[K, V]) *typedShardedCache[K, V] {
+	if o.DefaultExpiration == 0 {
+		o.DefaultExpiration = -1
+	}
+	if o.Shards <= 0 {
+		o.Shards = 1
+	}
+	if o.Hash == nil {
+		o.Hash = defaultHash[K]()
+	}
+	if o.Hash == nil && o.Shards > 1 {
+		var zero K
+		panic(fmt.Sprintf("gcache: no default hash for key type %T", zero))
+	}
+	sc := &typedShardedCache[K, V]{
+		hash: o.Hash,
+		m:    uint32(o.Shards),
+		cs:   make([]*typedCache[K, V], o.Shards),
+	}
+	for i := range sc.cs {
+		sc.cs[i] = newTypedCache[K, V](o.DefaultExpiration)
+	}
+	if o.MaxEntries > 0 || o.MaxCost > 0 {
+		sc.bound(o)
 	}
 	return sc
 }
@@ -0,0 +1,84 @@
+package gcache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Benchmarks of the janitor on large caches. DeleteExpired used to walk
+// every item under the write lock; it now only visits expired items.
+
+const benchEntries = 1 << 20
+
+func newLargeCache(b *testing.B, shards int) *BucketCache {
+	b.Helper()
+	tc := NewBucketCache(time.Hour, 0, shards)
+	for i := 0; i < benchEntries; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	return tc
+}
+
+// BenchmarkDeleteExpiredNothingExpired measures a janitor run over 1M items
+// of which none has expired.
+func BenchmarkDeleteExpiredNothingExpired(b *testing.B) {
+	tc := newLargeCache(b, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.DeleteExpired()
+	}
+}
+
+// BenchmarkDeleteExpiredOnePercent measures a janitor run over 1M items of
+// which 1% has expired.
+func BenchmarkDeleteExpiredOnePercent(b *testing.B) {
+	tc := newLargeCache(b, 16)
+	past := time.Now().Add(-time.Second).UnixNano()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < benchEntries/100; j++ {
+			tc.SetRecover("expired"+strconv.Itoa(j), j, past)
+		}
+		b.StartTimer()
+		tc.DeleteExpired()
+	}
+}
+
+// BenchmarkGetDuringDeleteExpired measures the latency of reads while the
+// janitor runs continuously over 1M items.
+func BenchmarkGetDuringDeleteExpired(b *testing.B) {
+	tc := newLargeCache(b, 16)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				tc.DeleteExpired()
+			}
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get(strconv.Itoa(i % benchEntries))
+	}
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+}
+
+// BenchmarkSetExpiring measures the cost of tracking expirations on writes.
+func BenchmarkSetExpiring(b *testing.B) {
+	tc := newLargeCache(b, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Set(strconv.Itoa(i%benchEntries), i, DefaultExpiration)
+	}
+}
@@ -0,0 +1,491 @@
+package gcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-crt/golib/gomcpack/mcpack"
+)
+
+// Snapshot file format, version 1. All integers are big endian.
+//
+//	header: magic "GCSN" | version uint8 | codec name length uint8 | codec name
+//	chunk:  payload length uint32 | crc32c(payload) uint32 | payload
+//	end:    a chunk header with length 0 and crc 0 | number of entries uint64
+//
+// A payload is a sequence of entries:
+//
+//	key length uvarint | key | expiration varint | value length uvarint | value
+//
+// Every chunk is checked separately, so chunks can be decoded in parallel,
+// and a file that was cut short is detected by the missing end marker.
+const (
+	snapshotMagic     = "GCSN"
+	snapshotVersion   = 1
+	snapshotChunkSize = 64 << 10
+)
+
+var (
+	ErrSnapshotFormat  = errors.New("gcache: not a snapshot file")
+	ErrSnapshotVersion = errors.New("gcache: unsupported snapshot version")
+	ErrSnapshotCorrupt = errors.New("gcache: snapshot checksum mismatch")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotCodec encodes the values of a snapshot. The name is stored in the
+// snapshot so that it is not decoded with a different codec.
+type SnapshotCodec interface {
+	Name() string
+	Marshal(x interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// GobCodec returns a codec that encodes values with encoding/gob. If sample
+// is nil, values are encoded as interface{} and their types must be
+// registered with gob.Register, as for SaveFile. Otherwise all values must
+// have the type of sample and need not be registered.
+func GobCodec(sample interface{}) SnapshotCodec {
+	typ := typeOf(sample)
+	return &valueCodec{
+		name: "gob",
+		typ:  typ,
+		marshal: func(x interface{}) ([]byte, error) {
+			var b bytes.Buffer
+			var err error
+			if typ == nil {
+				err = gob.NewEncoder(&b).Encode(&x)
+			} else {
+				err = gob.NewEncoder(&b).Encode(x)
+			}
+			return b.Bytes(), err
+		},
+		unmarshal: func(data []byte, v interface{}) error {
+			return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+		},
+	}
+}
+
+// JSONCodec returns a codec that encodes values with encoding/json. All values
+// must have the type of sample; if sample is nil they are decoded as
+// interface{}, i.e. objects become map[string]interface{}.
+func JSONCodec(sample interface{}) SnapshotCodec {
+	return &valueCodec{
+		name:      "json",
+		typ:       typeOf(sample),
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+}
+
+// McpackCodec returns a codec that encodes values with mcpack. All values
+// must have the type of sample, which has to be a struct, a map or a pointer
+// to a struct.
+func McpackCodec(sample interface{}) SnapshotCodec {
+	return &valueCodec{
+		name:      "mcpack",
+		typ:       typeOf(sample),
+		marshal:   mcpack.Marshal,
+		unmarshal: mcpack.Unmarshal,
+	}
+}
+
+func typeOf(sample interface{}) reflect.Type {
+	if sample == nil {
+		return nil
+	}
+	return reflect.TypeOf(sample)
+}
+
+type valueCodec struct {
+	name      string
+	typ       reflect.Type
+	marshal   func(x interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+func (c *valueCodec) Name() string {
+	return c.name
+}
+
+func (c *valueCodec) Marshal(x interface{}) ([]byte, error) {
+	if c.typ != nil && reflect.TypeOf(x) != c.typ {
+		return nil, fmt.Errorf("%s codec: value of type %T, expected %s", c.name, x, c.typ)
+	}
+	return c.marshal(x)
+}
+
+// Unmarshal decodes into a new value of the sample type. For a pointer type
+// the value is decoded into the pointed-to struct so that codecs which do not
+// allocate pointers, like mcpack, work as well.
+func (c *valueCodec) Unmarshal(data []byte) (interface{}, error) {
+	if c.typ == nil {
+		var x interface{}
+		err := c.unmarshal(data, &x)
+		return x, err
+	}
+	if c.typ.Kind() == reflect.Ptr {
+		v := reflect.New(c.typ.Elem())
+		err := c.unmarshal(data, v.Interface())
+		return v.Interface(), err
+	}
+	v := reflect.New(c.typ)
+	err := c.unmarshal(data, v.Interface())
+	return v.Elem().Interface(), err
+}
+
+// SnapshotOptions configures SaveSnapshot, LoadSnapshot and StartSnapshots.
+type SnapshotOptions struct {
+	// Codec encodes the values. Defaults to GobCodec(nil).
+	Codec SnapshotCodec
+	// Parallelism is the number of goroutines that decode chunks while
+	// loading. Defaults to runtime.NumCPU().
+	Parallelism int
+	// OnError is called with the errors of background saves and loads.
+	OnError func(error)
+}
+
+func (o *SnapshotOptions) checkOptions() {
+	if o.Codec == nil {
+		o.Codec = GobCodec(nil)
+	}
+	if o.Parallelism <= 0 {
+		o.Parallelism = runtime.NumCPU()
+	}
+}
+
+// SaveSnapshot writes the unexpired items to w. Shards are written one after
+// the other, so only one shard is copied at a time and the other shards stay
+// writable.
+func (sc *shardedCache) SaveSnapshot(w io.Writer, opts SnapshotOptions) error {
+	opts.checkOptions()
+	name := opts.Codec.Name()
+	if len(name) > 255 {
+		return fmt.Errorf("gcache: codec name %q too long", name)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+	bw.WriteByte(byte(len(name)))
+	bw.WriteString(name)
+
+	var count uint64
+	chunk := make([]byte, 0, snapshotChunkSize)
+	var tmp [binary.MaxVarintLen64]byte
+	for _, c := range sc.cs {
+		for k, v := range c.getItems() {
+			data, err := opts.Codec.Marshal(v.Object)
+			if err != nil {
+				return fmt.Errorf("gcache: encode %s: %w", k, err)
+			}
+			chunk = append(chunk, tmp[:binary.PutUvarint(tmp[:], uint64(len(k)))]...)
+			chunk = append(chunk, k...)
+			chunk = append(chunk, tmp[:binary.PutVarint(tmp[:], v.Expiration)]...)
+			chunk = append(chunk, tmp[:binary.PutUvarint(tmp[:], uint64(len(data)))]...)
+			chunk = append(chunk, data...)
+			count++
+			if len(chunk) >= snapshotChunkSize {
+				if err := writeChunk(bw, chunk); err != nil {
+					return err
+				}
+				chunk = chunk[:0]
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := writeChunk(bw, chunk); err != nil {
+			return err
+		}
+	}
+
+	var end [16]byte
+	binary.BigEndian.PutUint64(end[8:], count)
+	bw.Write(end[:])
+	return bw.Flush()
+}
+
+func writeChunk(w io.Writer, chunk []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(chunk)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(chunk, crcTable))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(chunk)
+	return err
+}
+
+// SaveSnapshotFile writes a snapshot to a temporary file next to fname and
+// renames it to fname once it is complete, so that a crash during the save
+// leaves the previous snapshot intact. The directory is synced after the
+// rename so that the new snapshot survives a crash as well.
+func (sc *shardedCache) SaveSnapshotFile(fname string, opts SnapshotOptions) error {
+	fp, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	err = sc.SaveSnapshot(fp, opts)
+	if err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, fname)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(fname))
+}
+
+func syncDir(dir string) error {
+	fp, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = fp.Sync()
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// LoadSnapshot adds the unexpired items of a snapshot to the cache. Items
+// that already exist in the cache are kept. Chunks are decoded by
+// opts.Parallelism goroutines. If an error is returned, the items of the
+// chunks read before the error may have been added.
+func (sc *shardedCache) LoadSnapshot(r io.Reader, opts SnapshotOptions) error {
+	opts.checkOptions()
+	br := bufio.NewReader(r)
+
+	var hdr [6]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil || string(hdr[:4]) != snapshotMagic {
+		return ErrSnapshotFormat
+	}
+	if hdr[4] != snapshotVersion {
+		return ErrSnapshotVersion
+	}
+	name := make([]byte, hdr[5])
+	if _, err := io.ReadFull(br, name); err != nil {
+		return ErrSnapshotFormat
+	}
+	if string(name) != opts.Codec.Name() {
+		return fmt.Errorf("gcache: snapshot encoded with %s, not %s", name, opts.Codec.Name())
+	}
+
+	chunks := make(chan []byte, opts.Parallelism)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		count    uint64
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				n, err := sc.loadChunk(chunk, opts.Codec)
+				if err != nil {
+					setErr(err)
+				}
+				mu.Lock()
+				count += n
+				mu.Unlock()
+			}
+		}()
+	}
+
+	want, err := readChunks(br, chunks)
+	close(chunks)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if count != want {
+		return fmt.Errorf("gcache: snapshot has %d entries, expected %d", count, want)
+	}
+	return nil
+}
+
+// readChunks sends the verified chunks of r to chunks and returns the number
+// of entries recorded after the end marker.
+func readChunks(r io.Reader, chunks chan<- []byte) (uint64, error) {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return 0, fmt.Errorf("gcache: snapshot truncated: %w", err)
+		}
+		size := binary.BigEndian.Uint32(hdr[:4])
+		sum := binary.BigEndian.Uint32(hdr[4:])
+		if size == 0 {
+			if sum != 0 {
+				return 0, ErrSnapshotCorrupt
+			}
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, fmt.Errorf("gcache: snapshot truncated: %w", err)
+		}
+		if crc32.Checksum(chunk, crcTable) != sum {
+			return 0, ErrSnapshotCorrupt
+		}
+		chunks <- chunk
+	}
+	var count [8]byte
+	if _, err := io.ReadFull(r, count[:]); err != nil {
+		return 0, fmt.Errorf("gcache: snapshot truncated: %w", err)
+	}
+	return binary.BigEndian.Uint64(count[:]), nil
+}
+
+// loadChunk decodes the entries of a chunk and returns how many it read,
+// including expired ones that were skipped.
+func (sc *shardedCache) loadChunk(chunk []byte, codec SnapshotCodec) (uint64, error) {
+	var n uint64
+	now := time.Now().UnixNano()
+	for len(chunk) > 0 {
+		klen, i := binary.Uvarint(chunk)
+		if i <= 0 || uint64(len(chunk)-i) < klen {
+			return n, ErrSnapshotCorrupt
+		}
+		chunk = chunk[i:]
+		k := string(chunk[:klen])
+		chunk = chunk[klen:]
+
+		e, i := binary.Varint(chunk)
+		if i <= 0 {
+			return n, ErrSnapshotCorrupt
+		}
+		chunk = chunk[i:]
+
+		vlen, i := binary.Uvarint(chunk)
+		if i <= 0 || uint64(len(chunk)-i) < vlen {
+			return n, ErrSnapshotCorrupt
+		}
+		chunk = chunk[i:]
+		data := chunk[:vlen]
+		chunk = chunk[vlen:]
+		n++
+
+		if e > 0 && now > e {
+			continue
+		}
+		x, err := codec.Unmarshal(data)
+		if err != nil {
+			return n, fmt.Errorf("gcache: decode %s: %w", k, err)
+		}
+		sc.SetRecover(k, x, e)
+	}
+	return n, nil
+}
+
+func (sc *shardedCache) LoadSnapshotFile(fname string, opts SnapshotOptions) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return sc.LoadSnapshot(fp, opts)
+}
+
+// LoadSnapshotFileAsync loads the snapshot in the background, so that the
+// cache can serve requests at startup while it is warmed up. Items set in
+// the meantime take precedence over the snapshot. The returned channel
+// receives the result of the load; a missing file is not an error.
+func (sc *shardedCache) LoadSnapshotFileAsync(fname string, opts SnapshotOptions) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		err := sc.LoadSnapshotFile(fname, opts)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+		done <- err
+	}()
+	return done
+}
+
+type snapshotter struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartSnapshots saves a snapshot to fname every interval until
+// StopSnapshots is called. Errors are passed to opts.OnError. A running
+// snapshotter is stopped first, unless interval is not positive, in which
+// case an error is returned and nothing changes.
+func (sc *shardedCache) StartSnapshots(fname string, interval time.Duration, opts SnapshotOptions) error {
+	if interval <= 0 {
+		return fmt.Errorf("gcache: snapshot interval %v must be positive", interval)
+	}
+	sc.StopSnapshots()
+	s := &snapshotter{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	sc.snapshotMu.Lock()
+	sc.snapshotter = s
+	sc.snapshotMu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := sc.SaveSnapshotFile(fname, opts); err != nil && opts.OnError != nil {
+					opts.OnError(err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopSnapshots stops the periodic snapshots started by StartSnapshots and
+// waits for a running save to finish.
+func (sc *shardedCache) StopSnapshots() {
+	sc.snapshotMu.Lock()
+	s := sc.snapshotter
+	sc.snapshotter = nil
+	sc.snapshotMu.Unlock()
+	if s != nil {
+		close(s.stop)
+		<-s.done
+	}
+}
@@ -0,0 +1,206 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type snapshotUser struct {
+	Id   int64  `json:"id" mcpack:"id"`
+	Name string `json:"name" mcpack:"name"`
+}
+
+func TestSnapshotCodecs(t *testing.T) {
+	for _, tt := range []struct {
+		codec SnapshotCodec
+		value interface{}
+	}{
+		{GobCodec(nil), "untyped"},
+		{GobCodec(snapshotUser{}), snapshotUser{1, "gob"}},
+		{GobCodec(&snapshotUser{}), &snapshotUser{2, "gob ptr"}},
+		{JSONCodec(snapshotUser{}), snapshotUser{3, "json"}},
+		{JSONCodec(nil), map[string]interface{}{"name": "json map"}},
+		{McpackCodec(&snapshotUser{}), &snapshotUser{4, "mcpack"}},
+	} {
+		tc := NewBucketCache(DefaultExpiration, 0, 4)
+		for i := 0; i < 100; i++ {
+			tc.Set(strconv.Itoa(i), tt.value, DefaultExpiration)
+		}
+
+		var buf bytes.Buffer
+		if err := tc.SaveSnapshot(&buf, SnapshotOptions{Codec: tt.codec}); err != nil {
+			t.Fatal(tt.codec.Name(), err)
+		}
+		oc := NewBucketCache(DefaultExpiration, 0, 8)
+		if err := oc.LoadSnapshot(&buf, SnapshotOptions{Codec: tt.codec, Parallelism: 3}); err != nil {
+			t.Fatal(tt.codec.Name(), err)
+		}
+		if n := oc.Stats().Items; n != 100 {
+			t.Error(tt.codec.Name(), "expected 100 items, got", n)
+		}
+		x, found := oc.Get("42")
+		if !found {
+			t.Fatal(tt.codec.Name(), "42 was not loaded")
+		}
+		if !snapshotEqual(x, tt.value) {
+			t.Errorf("%s: got %#v, want %#v", tt.codec.Name(), x, tt.value)
+		}
+	}
+}
+
+func snapshotEqual(a, b interface{}) bool {
+	switch b := b.(type) {
+	case *snapshotUser:
+		a, ok := a.(*snapshotUser)
+		return ok && *a == *b
+	case map[string]interface{}:
+		a, ok := a.(map[string]interface{})
+		return ok && a["name"] == b["name"]
+	}
+	return a == b
+}
+
+func TestSnapshotManyChunks(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 16)
+	for i := 0; i < 20000; i++ {
+		tc.Set(strconv.Itoa(i), strconv.Itoa(i), DefaultExpiration)
+	}
+	tc.Set("expired", "x", time.Millisecond)
+	tc.Set("expiring", "x", 20*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := tc.SaveSnapshot(&buf, SnapshotOptions{Codec: JSONCodec("")}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() < 2*snapshotChunkSize {
+		t.Fatal("expected several chunks, snapshot size", buf.Len())
+	}
+	time.Sleep(25 * time.Millisecond)
+
+	oc := NewBucketCache(DefaultExpiration, 0, 16)
+	oc.Set("7", "newer", DefaultExpiration)
+	if err := oc.LoadSnapshot(&buf, SnapshotOptions{Codec: JSONCodec("")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := oc.Stats().Items; n != 20000 {
+		t.Error("expected 20000 items, got", n)
+	}
+	if x, _ := oc.Get("7"); x != "newer" {
+		t.Error("existing item was overwritten by the snapshot:", x)
+	}
+	if _, found := oc.Get("expiring"); found {
+		t.Error("expired item was loaded")
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	tc := NewBucketCache(DefaultExpiration, 0, 2)
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	var buf bytes.Buffer
+	if err := tc.SaveSnapshot(&buf, SnapshotOptions{Codec: JSONCodec(0)}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-30] ^= 0xff
+	err := New(0, 0).LoadSnapshot(bytes.NewReader(flipped), SnapshotOptions{Codec: JSONCodec(0)})
+	if err != ErrSnapshotCorrupt {
+		t.Error("expected ErrSnapshotCorrupt, got", err)
+	}
+
+	err = New(0, 0).LoadSnapshot(bytes.NewReader(data[:len(data)-10]), SnapshotOptions{Codec: JSONCodec(0)})
+	if err == nil {
+		t.Error("truncated snapshot was loaded")
+	}
+
+	err = New(0, 0).LoadSnapshot(bytes.NewReader(data), SnapshotOptions{Codec: GobCodec(0)})
+	if err == nil {
+		t.Error("snapshot was decoded with a different codec")
+	}
+
+	err = New(0, 0).LoadSnapshot(bytes.NewReader([]byte("not a snapshot")), SnapshotOptions{})
+	if err != ErrSnapshotFormat {
+		t.Error("expected ErrSnapshotFormat, got", err)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "cache.snapshot")
+	opts := SnapshotOptions{Codec: GobCodec(0)}
+
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	tc.Set("a", 1, DefaultExpiration)
+	if err := tc.SaveSnapshotFile(fname, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed save leaves the previous snapshot in place
+	tc.Set("b", "not an int", DefaultExpiration)
+	if err := tc.SaveSnapshotFile(fname, opts); err == nil {
+		t.Error("expected an encoding error")
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Error("temporary file was not removed:", files)
+	}
+
+	oc := NewBucketCache(DefaultExpiration, 0, 4)
+	if err := <-oc.LoadSnapshotFileAsync(fname, opts); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := oc.Get("a"); x != 1 {
+		t.Error("a was not loaded:", x)
+	}
+	if err := <-oc.LoadSnapshotFileAsync(filepath.Join(dir, "missing"), opts); err != nil {
+		t.Error("a missing snapshot should not be an error:", err)
+	}
+}
+
+func TestStartSnapshots(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	tc := NewBucketCache(DefaultExpiration, 0, 4)
+	tc.Set("a", "1", DefaultExpiration)
+
+	errs := make(chan error, 10)
+	opts := SnapshotOptions{
+		Codec:   JSONCodec(""),
+		OnError: func(err error) { errs <- err },
+	}
+	if err := tc.StartSnapshots(fname, 0, opts); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	if err := tc.StartSnapshots(fname, 10*time.Millisecond, opts); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(35 * time.Millisecond)
+	tc.StopSnapshots()
+	tc.StopSnapshots()
+
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.LoadSnapshotFile(fname, SnapshotOptions{Codec: JSONCodec("")}); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := oc.Get("a"); x != "1" {
+		t.Error("a was not saved:", x)
+	}
+	if err := oc.LoadSnapshotFile(fname+"x", SnapshotOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected ErrNotExist, got", err)
+	}
+	if files, _ := filepath.Glob(fname + ".tmp*"); len(files) > 0 {
+		t.Error("temporary files left behind:", files)
+	}
+}
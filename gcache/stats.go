@@ -0,0 +1,128 @@
+package gcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// counters are the per-shard statistics. They are updated atomically so that
+// reads, which only hold the shard's read lock, can count hits and misses.
+type counters struct {
+	hits        uint64
+	misses      uint64
+	sets        uint64
+	deletes     uint64
+	expirations uint64
+	evictions   uint64
+	loads       uint64
+	loadErrors  uint64
+	loadNanos   uint64
+}
+
+// Stats is a snapshot of the counters of a cache or of one of its shards.
+// Counters only grow; compute rates from the difference of two snapshots.
+type Stats struct {
+	// Hits and Misses count Get and GetWithExpiration calls. Reading an
+	// expired item that was not cleaned up yet is a miss.
+	Hits   uint64
+	Misses uint64
+	// Sets counts items written by Set, Add, Replace and SetRecover.
+	Sets uint64
+	// Deletes counts items removed with Delete.
+	Deletes uint64
+	// Expirations counts expired items removed by DeleteExpired or the
+	// janitor.
+	Expirations uint64
+	// Evictions counts items evicted to keep a size-bounded cache within
+	// its limits.
+	Evictions uint64
+	// Loads, LoadErrors and LoadTime are reported with RecordLoad by a
+	// loader that populates the cache, e.g. gcache/loader.
+	Loads      uint64
+	LoadErrors uint64
+	LoadTime   time.Duration
+	// Items is the current number of items, including expired items that
+	// were not cleaned up yet.
+	Items int
+}
+
+// HitRatio returns Hits / (Hits + Misses), or 0 if there were no reads.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// AvgLoadTime returns the mean duration of a load, or 0 if nothing was loaded.
+func (s Stats) AvgLoadTime() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+func (s *Stats) add(o Stats) {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Sets += o.Sets
+	s.Deletes += o.Deletes
+	s.Expirations += o.Expirations
+	s.Evictions += o.Evictions
+	s.Loads += o.Loads
+	s.LoadErrors += o.LoadErrors
+	s.LoadTime += o.LoadTime
+	s.Items += o.Items
+}
+
+// CacheStats holds the totals of a cache and the stats of each shard, which
+// show whether the keys are spread evenly over the shards.
+type CacheStats struct {
+	Stats
+	Shards []Stats
+}
+
+func (c *typedCache[K, V]) getStats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.stats.hits),
+		Misses:      atomic.LoadUint64(&c.stats.misses),
+		Sets:        atomic.LoadUint64(&c.stats.sets),
+		Deletes:     atomic.LoadUint64(&c.stats.deletes),
+		Expirations: atomic.LoadUint64(&c.stats.expirations),
+		Evictions:   atomic.LoadUint64(&c.stats.evictions),
+		Loads:       atomic.LoadUint64(&c.stats.loads),
+		LoadErrors:  atomic.LoadUint64(&c.stats.loadErrors),
+		LoadTime:    time.Duration(atomic.LoadUint64(&c.stats.loadNanos)),
+		Items:       c.getItemCount(),
+	}
+}
+
+func (c *typedCache[K, V]) recordLoad(d time.Duration, err error) {
+	atomic.AddUint64(&c.stats.loads, 1)
+	if err != nil {
+		atomic.AddUint64(&c.stats.loadErrors, 1)
+	}
+	if d > 0 {
+		atomic.AddUint64(&c.stats.loadNanos, uint64(d))
+	}
+}
+
+// Stats returns a snapshot of the counters of every shard and their totals.
+// The shards are read one after the other, so the snapshot is not atomic
+// across shards.
+func (sc *typedShardedCache[K, V]) Stats() CacheStats {
+	s := CacheStats{Shards: make([]Stats, len(sc.cs))}
+	for i, c := range sc.cs {
+		s.Shards[i] = c.getStats()
+		s.Stats.add(s.Shards[i])
+	}
+	return s
+}
+
+// RecordLoad reports that loading the value for k from the source of truth
+// took d and failed with err, if not nil. The load is counted on the shard
+// that holds k.
+func (sc *typedShardedCache[K, V]) RecordLoad(k K, d time.Duration, err error) {
+	sc.bucket(k).recordLoad(d, err)
+}
@@ -0,0 +1,80 @@
+package gcache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tc := NewBucketCacheWithOptions(Options{Shards: 4, MaxEntries: 8})
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Set("e", 1, time.Millisecond)
+	tc.Get("e")
+	tc.GetWithExpiration("missing")
+	tc.Delete("missing")
+	time.Sleep(5 * time.Millisecond)
+	tc.Get("e")
+	tc.DeleteExpired()
+
+	s := tc.Stats()
+	if s.Sets != 11 {
+		t.Error("expected 11 sets, got", s.Sets)
+	}
+	if s.Hits != 1 || s.Misses != 2 {
+		t.Errorf("expected 1 hit and 2 misses, got %d and %d", s.Hits, s.Misses)
+	}
+	if s.Expirations+s.Evictions != 11-uint64(s.Items) {
+		t.Errorf("%d items left after %d expirations and %d evictions", s.Items, s.Expirations, s.Evictions)
+	}
+	if s.Deletes != 0 {
+		t.Error("deleting a missing key should not count, got", s.Deletes)
+	}
+	if len(s.Shards) != 4 {
+		t.Fatal("expected 4 shards, got", len(s.Shards))
+	}
+	var sets uint64
+	for _, shard := range s.Shards {
+		sets += shard.Sets
+	}
+	if sets != s.Sets {
+		t.Errorf("shard sets add up to %d, total is %d", sets, s.Sets)
+	}
+	if r := s.HitRatio(); r < 0.33 || r > 0.34 {
+		t.Error("unexpected hit ratio", r)
+	}
+
+	tc.Set("d", 1, DefaultExpiration)
+	tc.Delete("d")
+	if s := tc.Stats(); s.Deletes != 1 {
+		t.Error("expected 1 delete, got", s.Deletes)
+	}
+}
+
+func TestStatsRecordLoad(t *testing.T) {
+	tc := NewBucketCache(0, 0, 2)
+	tc.RecordLoad("a", 10*time.Millisecond, nil)
+	tc.RecordLoad("b", 30*time.Millisecond, errors.New("failed"))
+
+	s := tc.Stats()
+	if s.Loads != 2 || s.LoadErrors != 1 {
+		t.Errorf("expected 2 loads and 1 error, got %d and %d", s.Loads, s.LoadErrors)
+	}
+	if s.AvgLoadTime() != 20*time.Millisecond {
+		t.Error("unexpected average load time", s.AvgLoadTime())
+	}
+}
+
+func BenchmarkShardedCacheGetStats(b *testing.B) {
+	tc := NewBucketCache(DefaultExpiration, 0, 16)
+	tc.Set("foo", "bar", DefaultExpiration)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tc.Get("foo")
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package gcache
+
+import (
+	"crypto/rand"
+	"hash/maphash"
+	"math"
+	"math/big"
+	insecurerand "math/rand"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Number is the set of types that Increment and Decrement work with.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// TypedOptions configures a cache created with NewCacheWithOptions,
+// NewShardedCacheWithOptions or, as Options, NewBucketCacheWithOptions.
+type TypedOptions[K comparable, V any] struct {
+	// DefaultExpiration is used by Set with DefaultExpiration. 0 means the
+	// items never expire.
+	DefaultExpiration time.Duration
+	// CleanupInterval is how often the janitor deletes expired items. 0
+	// disables the janitor.
+	CleanupInterval time.Duration
+	// Shards is the number of buckets. Defaults to 1.
+	Shards int
+	// Hash selects the bucket of a key. It may be nil for string and
+	// integer keys, and for other keys if there is one bucket and the
+	// policy is not PolicyTinyLFU.
+	Hash func(K) uint32
+
+	// MaxEntries bounds the number of items, 0 means no bound. The bound is
+	// split evenly across the shards.
+	MaxEntries int
+	// MaxCost bounds the total cost of the items as computed by Cost, 0
+	// means no bound. The bound is split evenly across the shards.
+	MaxCost int64
+	// Cost returns the cost of an item, e.g. its size in bytes. Defaults to
+	// 1 per item.
+	Cost func(k K, x V) int64
+	// Policy selects the entry to evict when a bound is reached. Defaults to
+	// PolicyLRU.
+	Policy EvictionPolicy
+}
+
+// Cache is a type-safe single bucket cache. It has the same expiration,
+// janitor, eviction, stats, tag and OnEvicted semantics as BucketCache, but
+// Get returns a V instead of an interface{}.
+type Cache[K comparable, V any] struct {
+	*typedShardedCache[K, V]
+}
+
+// NewCache returns a cache with a given default expiration duration and
+// cleanup interval. If the expiration duration is less than one (or
+// NoExpiration), the items in the cache never expire (by default), and must
+// be deleted manually. If the cleanup interval is less than one, expired
+// items are not deleted from the cache before calling DeleteExpired.
+func NewCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration) *Cache[K, V] {
+	return NewCacheWithOptions(TypedOptions[K, V]{
+		DefaultExpiration: defaultExpiration,
+		CleanupInterval:   cleanupInterval,
+	})
+}
+
+// NewCacheWithOptions returns a single bucket cache that is optionally
+// bounded like NewBucketCacheWithOptions. o.Shards is ignored.
+func NewCacheWithOptions[K comparable, V any](o TypedOptions[K, V]) *Cache[K, V] {
+	o.Shards = 1
+	sc := newTypedShardedCache(o)
+	C := &Cache[K, V]{sc}
+	if o.CleanupInterval > 0 {
+		runJanitor(sc, o.CleanupInterval)
+		runtime.SetFinalizer(C, (*Cache[K, V]).stopJanitor)
+	}
+	return C
+}
+
+// Copies all unexpired items in the cache into a new map and returns it.
+func (c *Cache[K, V]) Items() map[K]TypedItem[V] {
+	return c.cs[0].getItems()
+}
+
+// Returns the number of items in the cache. This may include items that have
+// expired, but have not yet been cleaned up.
+func (c *Cache[K, V]) ItemCount() int {
+	return c.cs[0].getItemCount()
+}
+
+// ShardedCache is a type-safe cache split into buckets, each with its own
+// map and lock, like BucketCache.
+type ShardedCache[K comparable, V any] struct {
+	*typedShardedCache[K, V]
+}
+
+// NewShardedCache returns a cache with shardnum buckets. hash selects the
+// bucket of a key; it may be nil for string and integer keys.
+func NewShardedCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration, shardnum int, hash func(K) uint32) *ShardedCache[K, V] {
+	return NewShardedCacheWithOptions(TypedOptions[K, V]{
+		DefaultExpiration: defaultExpiration,
+		CleanupInterval:   cleanupInterval,
+		Shards:            shardnum,
+		Hash:              hash,
+	})
+}
+
+// NewShardedCacheWithOptions returns a sharded cache that is optionally
+// bounded like NewBucketCacheWithOptions.
+func NewShardedCacheWithOptions[K comparable, V any](o TypedOptions[K, V]) *ShardedCache[K, V] {
+	sc := newTypedShardedCache(o)
+	SC := &ShardedCache[K, V]{sc}
+	if o.CleanupInterval > 0 {
+		runJanitor(sc, o.CleanupInterval)
+		runtime.SetFinalizer(SC, (*ShardedCache[K, V]).stopJanitor)
+	}
+	return SC
+}
+
+// defaultHash returns a hash function for string and integer key types, and
+// nil for any other key type.
+func defaultHash[K comparable]() func(K) uint32 {
+	var zero K
+	switch any(zero).(type) {
+	case string:
+		seed := hashSeed()
+		return func(k K) uint32 {
+			return djb33(seed, any(k).(string))
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
+		return func(k K) uint32 {
+			// Fibonacci hashing spreads sequential ids over the buckets
+			s := toUint64(any(k)) * 11400714819323198485
+			return uint32(s >> 32)
+		}
+	}
+	return nil
+}
+
+func hashSeed() uint32 {
+	max := big.NewInt(0).SetUint64(uint64(math.MaxUint32))
+	rnd, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		os.Stderr.Write([]byte("WARNING: go-cache's newShardedCache failed to read from the system CSPRNG (/dev/urandom or equivalent.) Your system's security may be compromised. Continuing with an insecure seed.\n"))
+		return insecurerand.Uint32()
+	}
+	return uint32(rnd.Uint64())
+}
+
+// sketchHash returns the 64 bit hash that the frequency sketch of
+// PolicyTinyLFU uses, or nil if there is no hash for the key type.
+func sketchHash[K comparable](hash func(K) uint32) func(K) uint64 {
+	var zero K
+	if _, ok := any(zero).(string); ok {
+		seed := maphash.MakeSeed()
+		return func(k K) uint64 {
+			var h maphash.Hash
+			h.SetSeed(seed)
+			h.WriteString(any(k).(string))
+			return h.Sum64()
+		}
+	}
+	if hash == nil {
+		return nil
+	}
+	return func(k K) uint64 {
+		return uint64(hash(k)) * 11400714819323198485
+	}
+}
+
+func toUint64(k interface{}) uint64 {
+	switch v := k.(type) {
+	case int:
+		return uint64(v)
+	case int8:
+		return uint64(v)
+	case int16:
+		return uint64(v)
+	case int32:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case uintptr:
+		return uint64(v)
+	}
+	return 0
+}
+
+// Buckets is implemented by Cache, ShardedCache and BucketCache and lets
+// Increment, Decrement and NamespaceOf work with all of them.
+type Buckets[K comparable, V any] interface {
+	sharded() *typedShardedCache[K, V]
+}
+
+// Increment an item by n and return the new value. Returns an error if the
+// item was not found or has expired.
+func Increment[K comparable, V Number](c Buckets[K, V], k K, n V) (V, error) {
+	return c.sharded().bucket(k).update(k, func(v V) (V, error) { return v + n, nil })
+}
+
+// Decrement an item by n and return the new value. Returns an error if the
+// item was not found or has expired.
+func Decrement[K comparable, V Number](c Buckets[K, V], k K, n V) (V, error) {
+	return c.sharded().bucket(k).update(k, func(v V) (V, error) { return v - n, nil })
+}
@@ -0,0 +1,245 @@
+package gcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTypedCache(t *testing.T) {
+	tc := NewCache[string, *TestStruct](DefaultExpiration, 0)
+
+	if v, found := tc.Get("a"); found || v != nil {
+		t.Error("Getting a found value that shouldn't exist:", v)
+	}
+	tc.Set("a", &TestStruct{Num: 1}, DefaultExpiration)
+	if v, found := tc.Get("a"); !found || v.Num != 1 {
+		t.Error("a was not found or has the wrong value:", v)
+	}
+
+	if err := tc.Add("a", &TestStruct{Num: 2}, DefaultExpiration); err == nil {
+		t.Error("Add of an existing key succeeded")
+	}
+	if err := tc.Replace("b", &TestStruct{Num: 2}, DefaultExpiration); err == nil {
+		t.Error("Replace of a missing key succeeded")
+	}
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v *TestStruct) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("b", &TestStruct{Num: 2}, 10*time.Millisecond)
+	<-time.After(20 * time.Millisecond)
+	if _, found := tc.Get("b"); found {
+		t.Error("b should have expired")
+	}
+	if _, _, found := tc.GetWithExpiration("b"); found {
+		t.Error("b should have expired")
+	}
+	tc.DeleteExpired()
+	tc.Delete("a")
+	if len(evicted) != 2 || evicted[0] != "b" || evicted[1] != "a" {
+		t.Error("unexpected evictions:", evicted)
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Error("cache should be empty, has", n)
+	}
+}
+
+func TestTypedIncrement(t *testing.T) {
+	tc := NewCache[string, uint8](DefaultExpiration, 0)
+	if _, err := Increment[string, uint8](tc, "n", 1); err == nil {
+		t.Error("Increment of a missing key succeeded")
+	}
+	tc.Set("n", 254, DefaultExpiration)
+	if v, err := Increment[string, uint8](tc, "n", 1); err != nil || v != 255 {
+		t.Error("unexpected result:", v, err)
+	}
+	if v, err := Decrement[string, uint8](tc, "n", 5); err != nil || v != 250 {
+		t.Error("unexpected result:", v, err)
+	}
+
+	type score float64
+	sc := NewShardedCache[int64, score](DefaultExpiration, 0, 8, nil)
+	sc.Set(42, 1.5, DefaultExpiration)
+	if v, err := Increment[int64, score](sc, 42, 1); err != nil || v != 2.5 {
+		t.Error("unexpected result:", v, err)
+	}
+}
+
+func TestTypedShardedCache(t *testing.T) {
+	sc := NewShardedCache[string, int](DefaultExpiration, time.Millisecond, 13, nil)
+	for i, k := range shardedKeys {
+		sc.Set(k, i, DefaultExpiration)
+	}
+	for i, k := range shardedKeys {
+		if v, found := sc.Get(k); !found || v != i {
+			t.Error(k, "was not found or has the wrong value:", v)
+		}
+	}
+	total := 0
+	for _, n := range sc.ItemsCount() {
+		total += n
+	}
+	if total != len(shardedKeys) {
+		t.Error("unexpected item count:", total)
+	}
+
+	sc.Set("short", 1, 5*time.Millisecond)
+	<-time.After(30 * time.Millisecond)
+	total = 0
+	for _, items := range sc.Items() {
+		total += len(items)
+		if _, found := items["short"]; found {
+			t.Error("janitor did not delete the expired item")
+		}
+	}
+	if total != len(shardedKeys) {
+		t.Error("unexpected item count:", total)
+	}
+}
+
+func TestTypedShardedCacheCustomHash(t *testing.T) {
+	type key struct{ a, b int }
+	defer func() {
+		if recover() == nil {
+			t.Error("NewShardedCache without hash should panic for struct keys")
+		}
+	}()
+	sc := NewShardedCache[key, string](DefaultExpiration, 0, 4, func(k key) uint32 { return uint32(k.a) })
+	sc.Set(key{1, 2}, "x", DefaultExpiration)
+	if v, _ := sc.Get(key{1, 2}); v != "x" {
+		t.Error("unexpected value:", v)
+	}
+	NewShardedCache[key, string](DefaultExpiration, 0, 4, nil)
+}
+
+func BenchmarkTypedCacheGet(b *testing.B) {
+	tc := NewCache[string, string](DefaultExpiration, 0)
+	tc.Set("foo", "bar", DefaultExpiration)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foo")
+	}
+}
+
+func BenchmarkTypedShardedCacheSet(b *testing.B) {
+	sc := NewShardedCache[string, int](DefaultExpiration, 0, 16, nil)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sc.Set(keys[i%len(keys)], i, DefaultExpiration)
+	}
+}
+
+func TestTypedCacheBounded(t *testing.T) {
+	tc := NewCacheWithOptions(TypedOptions[int, string]{MaxEntries: 2})
+	var evicted []int
+	tc.OnEvictedWithReason(func(k int, v string, reason EvictionReason) {
+		if reason == EvictionCapacity {
+			evicted = append(evicted, k)
+		}
+	})
+	tc.Set(1, "a", DefaultExpiration)
+	tc.Set(2, "b", DefaultExpiration)
+	tc.Get(1)
+	tc.Set(3, "c", DefaultExpiration)
+	if len(evicted) != 1 || evicted[0] != 2 {
+		t.Error("unexpected evictions:", evicted)
+	}
+	if s := tc.Stats(); s.Evictions != 1 || s.Sets != 3 || s.Hits != 1 || s.Items != 2 {
+		t.Errorf("unexpected stats: %+v", s.Stats)
+	}
+
+	type key struct{ a, b int }
+	sc := NewShardedCacheWithOptions(TypedOptions[key, int]{
+		Shards:     4,
+		Hash:       func(k key) uint32 { return uint32(k.a) },
+		MaxEntries: 100,
+		Policy:     PolicyTinyLFU,
+	})
+	for i := 0; i < 1000; i++ {
+		sc.Set(key{i, i}, i, DefaultExpiration)
+	}
+	total := 0
+	for _, n := range sc.ItemsCount() {
+		total += n
+	}
+	if total > 100 {
+		t.Error("bound not enforced:", total)
+	}
+}
+
+func TestTypedCacheAtomic(t *testing.T) {
+	tc := NewShardedCache[string, int](DefaultExpiration, 0, 4, nil)
+	loads := 0
+	load := func(k string) (int, error) {
+		loads++
+		return len(k), nil
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := tc.GetOrLoad("abc", load, DefaultExpiration); err != nil || v != 3 {
+			t.Error("unexpected result:", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Error("load was called", loads, "times")
+	}
+	if v, found := tc.GetOrSet("abc", 5, DefaultExpiration); !found || v != 3 {
+		t.Error("unexpected result:", v, found)
+	}
+	tc.Compute("abc", func(old int, exists bool) (int, bool) {
+		return old * 2, true
+	}, DefaultExpiration)
+	if !tc.CompareAndSwap("abc", 6, 7, DefaultExpiration) || tc.CompareAndSwap("abc", 6, 8, DefaultExpiration) {
+		t.Error("CompareAndSwap did not compare the value")
+	}
+	if v, _ := tc.Get("abc"); v != 7 {
+		t.Error("unexpected value:", v)
+	}
+}
+
+func TestTypedCacheTagsAndNamespaces(t *testing.T) {
+	tc := NewCache[string, *TestStruct](DefaultExpiration, 0)
+	tc.SetWithTags("a", &TestStruct{Num: 1}, DefaultExpiration, "t")
+	tc.SetWithTags("b", &TestStruct{Num: 2}, DefaultExpiration, "t")
+	tc.Set("c", &TestStruct{Num: 3}, DefaultExpiration)
+	if n := tc.DeleteByTag("t"); n != 2 || tc.ItemCount() != 1 {
+		t.Error("unexpected result of DeleteByTag:", n, tc.ItemCount())
+	}
+
+	ns := NamespaceOf[*TestStruct](tc, "users")
+	if ns != NamespaceOf[*TestStruct](tc, "users") {
+		t.Error("NamespaceOf returned a different namespace for the same name")
+	}
+	ns.Set("1", &TestStruct{Num: 4}, DefaultExpiration)
+	if v, found := ns.Get("1"); !found || v.Num != 4 {
+		t.Error("unexpected value:", v)
+	}
+	ns.Invalidate()
+	if _, found := ns.Get("1"); found {
+		t.Error("key is visible after Invalidate")
+	}
+}
+
+func TestTypedCacheExpiryHeap(t *testing.T) {
+	tc := NewCache[int, int](DefaultExpiration, 0)
+	for i := 0; i < 10; i++ {
+		tc.Set(i, i, time.Duration(i+1)*time.Millisecond)
+	}
+	tc.Set(10, 10, NoExpiration)
+	if n := len(tc.cs[0].expiry); n != 10 {
+		t.Error("unexpected number of heap entries:", n)
+	}
+	<-time.After(20 * time.Millisecond)
+	tc.DeleteExpired()
+	if n := tc.ItemCount(); n != 1 {
+		t.Error("unexpected item count:", n)
+	}
+	if s := tc.Stats(); s.Expirations != 10 {
+		t.Error("unexpected expirations:", s.Expirations)
+	}
+}
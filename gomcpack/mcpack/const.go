@@ -30,3 +30,29 @@ const (
 
 	MAX_SHORT_VITEM_LEN = 255
 )
+
+// mcpack v1, still spoken by some legacy services. All integers are little
+// endian:
+//
+//	pack: tag "PCK\0" | version uint32 | item count uint32 | content size uint32 | items
+//	item: type uint32 | key size uint32 | content size uint32 | key | content
+//
+// Key sizes and string contents include the trailing 0x00, array elements
+// have no key. The content of an object or array is its item count uint32
+// followed by its items. The pack itself is the top level object, so a v1
+// document is always an object. v1 has no bool, float, date or null items.
+const (
+	MCPACKV1_OBJECT = 0x02
+	MCPACKV1_ARRAY  = 0x04
+	MCPACKV1_BINARY = 0x10
+	MCPACKV1_STRING = 0x20
+	MCPACKV1_INT32  = 0x41
+	MCPACKV1_UINT32 = 0x42
+	MCPACKV1_INT64  = 0x43
+	MCPACKV1_UINT64 = 0x44
+
+	MCPACKV1_TAG         = "PCK\x00"
+	MCPACKV1_VERSION     = 1
+	MCPACKV1_HEADER_LEN  = 16
+	MCPACKV1_ITEM_HEADER = 12
+)
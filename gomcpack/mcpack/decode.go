@@ -2,8 +2,11 @@ package mcpack
 
 import (
 	"bytes"
+	"encoding"
 	"errors"
+	"fmt"
 	"reflect"
+	"time"
 	//"runtime"
 )
 
@@ -12,7 +15,15 @@ var (
 	errUnexpectedEnd = errors.New("unexpected end")
 )
 
+// Unmarshal decodes data, which may be an mcpack v2 item or a v1 pack, into
+// the value pointed to by v.
 func Unmarshal(data []byte, v interface{}) error {
+	if isV1(data) {
+		var err error
+		if data, err = v1ToV2(data); err != nil {
+			return err
+		}
+	}
 	var d decodeState
 	d.init(data)
 	return d.unmarshal(v)
@@ -73,12 +84,14 @@ func (d *decodeState) unmarshal(v interface{}) (err error) {
 
 // indirect walks down v allocating pointers as needed,
 // until it gets to a non-pointer.
-// if it encounters an Unmarshaler, indirect stops and returns that.
+// if it encounters an Unmarshaler or encoding.TextUnmarshaler, indirect
+// stops and returns that. time.Time is decoded from MCPACKV2_DATE instead of
+// its UnmarshalText method.
 // if decodingNull is true, indirect stops at the last pointer so that
 // it can be set to nil.
-func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (Unmarshaler, reflect.Value) {
+func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
 	if !v.IsValid() {
-		return nil, reflect.Value{}
+		return nil, nil, reflect.Value{}
 	}
 	// If v is a named type and is addressable
 	// start with its address, so that is the type has pointer
@@ -109,19 +122,24 @@ func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (Unmarshaler,
 		if v.IsNil() {
 			// nil pointer
 			if d.data[d.off] == MCPACKV2_NULL {
-				return nil, v
+				return nil, nil, v
 			}
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 
 		if v.Type().NumMethod() > 0 {
 			if u, ok := v.Interface().(Unmarshaler); ok {
-				return u, reflect.Value{}
+				return u, nil, reflect.Value{}
+			}
+			if v.Type() != timePtrType {
+				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+					return nil, u, reflect.Value{}
+				}
 			}
 		}
 		v = v.Elem()
 	}
-	return nil, v
+	return nil, nil, v
 }
 
 func (d *decodeState) value(v reflect.Value) {
@@ -130,13 +148,17 @@ func (d *decodeState) value(v reflect.Value) {
 		return
 	}
 
-	u, pv := d.indirect(v, false)
+	u, ut, pv := d.indirect(v, false)
 	if u != nil {
 		if err := u.UnmarshalMCPACK(d.next()); err != nil {
 			d.error(err)
 		}
 		return
 	}
+	if ut != nil {
+		d.text(ut)
+		return
+	}
 
 	v = pv
 
@@ -175,6 +197,8 @@ func (d *decodeState) value(v reflect.Value) {
 		d.float(v)
 	case MCPACKV2_DOUBLE:
 		d.double(v)
+	case MCPACKV2_DATE:
+		d.date(v)
 	case MCPACKV2_NULL:
 		d.null(v)
 	}
@@ -229,7 +253,7 @@ func (d *decodeState) next() []byte {
 	case MCPACKV2_DOUBLE:
 		vlen = 8
 	case MCPACKV2_DATE:
-		// FIXME
+		vlen = 8
 	case MCPACKV2_NULL:
 		vlen = 1
 	}
@@ -761,6 +785,56 @@ func (d *decodeState) doubleInterface() interface{} {
 	return val
 }
 
+// type(1) | name length(1) | raw name bytes | 0x00 | nanoseconds since
+// the Unix epoch(8)
+func (d *decodeState) date(v reflect.Value) {
+	val := d.dateInterface()
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(val))
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(val))
+	default:
+		d.error(fmt.Errorf("mcpack: cannot unmarshal date into %v", v.Type()))
+	}
+}
+
+func (d *decodeState) dateInterface() interface{} {
+	d.off += 1 // type
+
+	klen := int(Uint8(d.data[d.off:]))
+	d.off += 1 // name length
+
+	d.off += klen
+
+	val := Int64(d.data[d.off:])
+	d.off += 8 // value
+
+	return time.Unix(0, val)
+}
+
+// text decodes a string item with u. Null items leave u unchanged.
+func (d *decodeState) text(u encoding.TextUnmarshaler) {
+	typ := d.data[d.off]
+	item := d.next()
+	var val []byte
+	switch typ {
+	case MCPACKV2_STRING:
+		klen := int(item[1])
+		val = item[6+klen : len(item)-1]
+	case MCPACKV2_SHORT_STRING:
+		klen := int(item[1])
+		val = item[3+klen : len(item)-1]
+	case MCPACKV2_NULL:
+		return
+	default:
+		d.error(fmt.Errorf("mcpack: cannot unmarshal item of type 0x%02x into %T", typ, u))
+	}
+	if err := u.UnmarshalText(val); err != nil {
+		d.error(err)
+	}
+}
+
 func (d *decodeState) valueInterface() interface{} {
 	switch d.data[d.off] {
 	case MCPACKV2_OBJECT:
@@ -797,6 +871,8 @@ func (d *decodeState) valueInterface() interface{} {
 		return d.floatInterface()
 	case MCPACKV2_DOUBLE:
 		return d.doubleInterface()
+	case MCPACKV2_DATE:
+		return d.dateInterface()
 	case MCPACKV2_NULL:
 		return d.nullInterface()
 	}
@@ -977,7 +1053,7 @@ func (d *decodeState) key() []byte {
 	switch d.data[d.off] {
 	case MCPACKV2_INT8, MCPACKV2_INT16, MCPACKV2_INT32, MCPACKV2_INT64,
 		MCPACKV2_UINT8, MCPACKV2_UINT16, MCPACKV2_UINT32, MCPACKV2_UINT64,
-		MCPACKV2_BOOL, MCPACKV2_FLOAT, MCPACKV2_DOUBLE, MCPACKV2_NULL:
+		MCPACKV2_BOOL, MCPACKV2_FLOAT, MCPACKV2_DOUBLE, MCPACKV2_DATE, MCPACKV2_NULL:
 		kstart = 2 // type + klen
 	case MCPACKV2_SHORT_BINARY, MCPACKV2_SHORT_STRING:
 		kstart = 3 // type + klen + vlen(1)
@@ -1,9 +1,10 @@
-package mcpack_test
+package mcpack
 
 import (
 	"bytes"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type unmarshalTest struct {
@@ -99,3 +100,78 @@ func TestUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalOmitted(t *testing.T) {
+	data, err := Marshal(&C{Chs: make([]chan int, 2), B: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c C
+	if err := Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.B != 1 || len(c.Chs) != 0 {
+		t.Errorf("got %+v", c)
+	}
+
+	data, err = Marshal(&O{B: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o O
+	if err := Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o != (O{B: 2}) {
+		t.Errorf("got %+v", o)
+	}
+}
+
+func TestUnmarshalHooks(t *testing.T) {
+	in := hooks{When: time.Unix(1500000000, 123), Level: 1, Price: 105}
+	data, err := Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := hooks{Zero: time.Now()}
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.When.Equal(in.When) || !out.Zero.IsZero() || out.Level != 1 || out.Price != 105 {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	var i interface{}
+	if err := Unmarshal(data, &i); err != nil {
+		t.Fatal(err)
+	}
+	m := i.(map[string]interface{})
+	if when, ok := m["When"].(time.Time); !ok || !when.Equal(in.When) {
+		t.Errorf("got %#v, want %v", m["When"], in.When)
+	}
+
+	bad, _ := Marshal(map[string]string{"Level": "medium"})
+	if err := Unmarshal(bad, &out); err == nil {
+		t.Error("expected UnmarshalText error")
+	}
+	date, _ := Marshal(in.When)
+	var s string
+	if err := Unmarshal(date, &s); err == nil {
+		t.Error("expected error for date into string")
+	}
+}
+
+func TestUnmarshalTimePtr(t *testing.T) {
+	when := time.Unix(1500000000, 123)
+	data, err := Marshal(&timePtrs{P: &when})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out timePtrs
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.P == nil || !out.P.Equal(when) || out.Nil != nil {
+		t.Errorf("got %+v, want P %v", out, when)
+	}
+}
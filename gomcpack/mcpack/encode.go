@@ -1,15 +1,26 @@
 package mcpack
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 )
 
+// Marshaler is the interface implemented by types that can marshal
+// themselves into an mcpack item. The key of the returned item, if any, is
+// replaced by the name of the field or map entry holding the value.
+type Marshaler interface {
+	MarshalMCPACK() ([]byte, error)
+}
+
 func Marshal(v interface{}) ([]byte, error) {
 	e := &encodeState{}
 	err := e.marshal(v)
@@ -19,6 +30,35 @@ func Marshal(v interface{}) ([]byte, error) {
 	return e.data[:e.off], nil
 }
 
+// EncoderOptions configures MarshalWithOptions and NewEncoderWithOptions.
+type EncoderOptions struct {
+	// Version is the protocol version to encode, 1 or 2. Defaults to 2.
+	// Only objects can be encoded in v1, and only if they hold no bool,
+	// float or date; null members are left out.
+	Version int
+}
+
+// MarshalWithOptions is like Marshal, but encodes the protocol version of
+// opts. Unmarshal detects the version itself.
+func MarshalWithOptions(v interface{}, opts EncoderOptions) ([]byte, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return opts.convert(data)
+}
+
+// convert converts data, a v2 item, to the version of o.
+func (o EncoderOptions) convert(data []byte) ([]byte, error) {
+	switch o.Version {
+	case 0, 2:
+		return data, nil
+	case 1:
+		return v2ToV1(data)
+	}
+	return nil, fmt.Errorf("mcpack: unsupported version %d", o.Version)
+}
+
 type encodeState struct {
 	data    []byte
 	off     int
@@ -69,7 +109,12 @@ func (e *encodeState) resizeIfNeeded(n int) {
 	}
 }
 
-func (e *encodeState) marshal(v interface{}) (err error) {
+func (e *encodeState) marshal(v interface{}) error {
+	return e.marshalItem("", v)
+}
+
+// marshalItem encodes v as an item named k.
+func (e *encodeState) marshalItem(k string, v interface{}) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
@@ -81,10 +126,235 @@ func (e *encodeState) marshal(v interface{}) (err error) {
 			err = r.(error)
 		}
 	}()
-	e.reflectValue("", reflect.ValueOf(v))
+	e.reflectValue(k, reflect.ValueOf(v))
 	return nil
 }
 
+// type(1) | name length(1) | raw name bytes | 0x00 | 0x00
+func (e *encodeState) null(k string) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 1)
+
+	e.setType(MCPACKV2_NULL)
+	e.setKey(k, e.setKeyLen(k))
+
+	e.data[e.off] = 0
+	e.off++
+}
+
+func (e *encodeState) bool(k string, v bool) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 1)
+
+	e.setType(MCPACKV2_BOOL)
+	e.setKey(k, e.setKeyLen(k))
+
+	if v {
+		e.data[e.off] = 1
+	} else {
+		e.data[e.off] = 0
+	}
+	e.off++
+}
+
+// type(1) | name length(1) | raw name bytes | 0x00 | value bytes
+func (e *encodeState) int32(k string, v int32) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 4)
+
+	e.setType(MCPACKV2_INT32)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutInt32(e.data[e.off:], v)
+	e.off += 4
+}
+
+func (e *encodeState) int64(k string, v int64) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
+
+	e.setType(MCPACKV2_INT64)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutInt64(e.data[e.off:], v)
+	e.off += 8
+}
+
+func (e *encodeState) uint32(k string, v uint32) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 4)
+
+	e.setType(MCPACKV2_UINT32)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutUint32(e.data[e.off:], v)
+	e.off += 4
+}
+
+func (e *encodeState) uint64(k string, v uint64) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
+
+	e.setType(MCPACKV2_UINT64)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutUint64(e.data[e.off:], v)
+	e.off += 8
+}
+
+func (e *encodeState) float32(k string, v float32) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 4)
+
+	e.setType(MCPACKV2_FLOAT)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutFloat32(e.data[e.off:], v)
+	e.off += 4
+}
+
+func (e *encodeState) float64(k string, v float64) {
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
+
+	e.setType(MCPACKV2_DOUBLE)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutFloat64(e.data[e.off:], v)
+	e.off += 8
+}
+
+var (
+	minDate = time.Unix(0, math.MinInt64)
+	maxDate = time.Unix(0, math.MaxInt64)
+)
+
+// type(1) | name length(1) | raw name bytes | 0x00 | nanoseconds since the
+// Unix epoch(8)
+func (e *encodeState) date(k string, v time.Time) {
+	if v.Before(minDate) || v.After(maxDate) {
+		panic(fmt.Errorf("mcpack: time %v out of date range", v))
+	}
+	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
+
+	e.setType(MCPACKV2_DATE)
+	e.setKey(k, e.setKeyLen(k))
+
+	PutInt64(e.data[e.off:], v.UnixNano())
+	e.off += 8
+}
+
+func (e *encodeState) string(k string, v string) {
+	//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value | 0x00
+	//max(short_vitem, long_vitem)
+	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + len(v) + 1)
+
+	vlen := len(v) + 1
+	if vlen < MAX_SHORT_VITEM_LEN {
+		//type(1) | klen(1) | vlen(1) | key(len(k)) | 0x00 | value | 0x00
+		//type(1)
+		e.setType(MCPACKV2_SHORT_STRING)
+		//klen(1)
+		l := e.setKeyLen(k)
+		//vlen(1)
+		PutUint8(e.data[e.off:], uint8(vlen))
+		e.off++
+		//key(k[0:l]) | 0x00
+		e.setKey(k, l)
+	} else {
+		//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value | 0x00
+		//type(1)
+		e.setType(MCPACKV2_STRING)
+		//klen(l)
+		l := e.setKeyLen(k)
+		//vlen(4)
+		PutUint32(e.data[e.off:], uint32(vlen))
+		e.off += 4
+		//key(k[:l]) | 0x00
+		e.setKey(k, l)
+	}
+
+	//value | 0x00
+	e.off += copy(e.data[e.off:], v)
+	e.data[e.off] = 0
+	e.off++
+}
+
+func (e *encodeState) binary(k string, v []byte) {
+	//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value
+	//max(short_vitem, long_vitem)
+	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + len(v))
+
+	vlen := len(v)
+	if vlen <= MAX_SHORT_VITEM_LEN {
+		//type(1) | klen(1) | vlen(1) | key(len(k)) | 0x00 | value
+		//type(1)
+		e.setType(MCPACKV2_SHORT_BINARY)
+		//klen(1)
+		l := e.setKeyLen(k)
+		//vlen(1)
+		PutUint8(e.data[e.off:], uint8(vlen))
+		e.off++
+		//key(k[:l])) | 0x00
+		e.setKey(k, l)
+	} else {
+		//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value
+		//type(1)
+		e.setType(MCPACKV2_BINARY)
+		//klen(1)
+		l := e.setKeyLen(k)
+		//vlen(4)
+		PutUint32(e.data[e.off:], uint32(vlen))
+		e.off += 4
+		//key(k[0:l]) | 0x00
+		e.setKey(k, l)
+	}
+	//value
+	e.off += copy(e.data[e.off:], v)
+}
+
+// beginContainer writes the header of an object or array and returns the
+// positions endContainer needs to fill in the content length and the member
+// number.
+// type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | member number(4)
+func (e *encodeState) beginContainer(typ byte, k string) (vlenpos, vpos int) {
+	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + 4)
+	//type(1)
+	e.setType(typ)
+	//klen(1)
+	l := e.setKeyLen(k)
+	//vlen defer
+	vlenpos = e.off
+	e.off += 4
+	//key(k[:l]) | 0x00
+	e.setKey(k, l)
+	//vpos defer
+	vpos = e.off
+	//count(4) defer
+	e.off += 4
+	return
+}
+
+func (e *encodeState) endContainer(vlenpos, vpos, n int) {
+	//vlen
+	PutInt32(e.data[vlenpos:], int32(e.off-vpos))
+	//count
+	PutInt32(e.data[vpos:], int32(n))
+}
+
+// rawItem writes item, a single encoded item, renamed to k.
+func (e *encodeState) rawItem(k string, item []byte) {
+	if len(item) < 2 {
+		panic(errTruncated)
+	}
+	hlen, err := headerLen(item[0])
+	if err != nil {
+		panic(err)
+	}
+	if len(item) < hlen || itemLen(item[:hlen]) != len(item) {
+		panic(errors.New("mcpack: expected exactly one item"))
+	}
+	klen := int(item[1])
+	e.resizeIfNeeded(hlen + len(k) + 1 + len(item))
+	e.setType(item[0])
+	l := e.setKeyLen(k)
+	e.off += copy(e.data[e.off:], item[2:hlen])
+	e.setKey(k, l)
+	e.off += copy(e.data[e.off:], item[hlen+klen:])
+}
+
 func (e *encodeState) reflectValue(k string, v reflect.Value) {
 	valueEncoder(v)(e, k, v)
 }
@@ -131,7 +401,31 @@ func typeEncoder(t reflect.Type) encoderFunc {
 	return f
 }
 
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+	timePtrType       = reflect.PtrTo(timeType)
+)
+
 func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	if t.Implements(marshalerType) {
+		return marshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(marshalerType) {
+		return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	// time.Time is a date rather than the text of MarshalText
+	if t == timeType || t == timePtrType {
+		return timeEncoder
+	}
+	if t.Implements(textMarshalerType) {
+		return textMarshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(textMarshalerType) {
+		return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
+	}
+
 	switch t.Kind() {
 	case reflect.Bool:
 		return boolEncoder
@@ -180,217 +474,145 @@ func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
 	}
 }
 
-func unsupportedTypeEncoder(e *encodeState, k string, v reflect.Value) {
+func marshalerEncoder(e *encodeState, k string, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		nilEncoder(e, k, v)
+		return
+	}
+	m := v.Interface().(Marshaler)
+	b, err := m.MarshalMCPACK()
+	if err != nil {
+		panic(fmt.Errorf("mcpack: error calling MarshalMCPACK for type %v: %w", v.Type(), err))
+	}
+	e.rawItem(k, b)
 }
 
-func invalidValueEncoder(e *encodeState, k string, v reflect.Value) {
+func addrMarshalerEncoder(e *encodeState, k string, v reflect.Value) {
+	marshalerEncoder(e, k, v.Addr())
 }
 
-func nilEncoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 1)
-
-	e.setType(MCPACKV2_NULL)
-	e.setKey(k, e.setKeyLen(k))
+func textMarshalerEncoder(e *encodeState, k string, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		nilEncoder(e, k, v)
+		return
+	}
+	m := v.Interface().(encoding.TextMarshaler)
+	b, err := m.MarshalText()
+	if err != nil {
+		panic(fmt.Errorf("mcpack: error calling MarshalText for type %v: %w", v.Type(), err))
+	}
+	e.string(k, string(b))
+}
 
-	e.data[e.off] = 0
-	e.off++
+func addrTextMarshalerEncoder(e *encodeState, k string, v reflect.Value) {
+	textMarshalerEncoder(e, k, v.Addr())
 }
 
-func boolEncoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 1)
+// The zero time is encoded as null, since it cannot be represented as a
+// date.
+func timeEncoder(e *encodeState, k string, v reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.null(k)
+			return
+		}
+		v = v.Elem()
+	}
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		e.null(k)
+		return
+	}
+	e.date(k, t)
+}
 
-	e.setType(MCPACKV2_BOOL)
-	e.setKey(k, e.setKeyLen(k))
+// condAddrEncoder uses canAddrEnc if the value is addressable, so that
+// methods with pointer receivers are found, and elseEnc otherwise.
+type condAddrEncoder struct {
+	canAddrEnc, elseEnc encoderFunc
+}
 
-	if v.Bool() {
-		e.data[e.off] = 1
+func (ce *condAddrEncoder) encode(e *encodeState, k string, v reflect.Value) {
+	if v.CanAddr() {
+		ce.canAddrEnc(e, k, v)
 	} else {
-		e.data[e.off] = 0
+		ce.elseEnc(e, k, v)
 	}
-	e.off++
 }
 
-// type(1) | name length(1) | raw name bytes | 0x00 | value bytes
-func int8Encoder(e *encodeState, k string, v reflect.Value) {
-	// unsupported in libmcpack, uint32 employed
-	/*e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
+func newCondAddrEncoder(canAddrEnc, elseEnc encoderFunc) encoderFunc {
+	enc := &condAddrEncoder{canAddrEnc: canAddrEnc, elseEnc: elseEnc}
+	return enc.encode
+}
 
-	e.setType(MCPACKV2_INT8)
-	e.setKey(k, e.setKeyLen(k))
+func unsupportedTypeEncoder(e *encodeState, k string, v reflect.Value) {
+}
+
+func invalidValueEncoder(e *encodeState, k string, v reflect.Value) {
+}
 
-	PutInt8(e.data[e.off:], int8(v.Int()))
-	e.off += 1*/
+func nilEncoder(e *encodeState, k string, v reflect.Value) {
+	e.null(k)
+}
 
-	int32Encoder(e, k, v)
+func boolEncoder(e *encodeState, k string, v reflect.Value) {
+	e.bool(k, v.Bool())
 }
 
 // type(1) | name length(1) | raw name bytes | 0x00 | value bytes
-func int16Encoder(e *encodeState, k string, v reflect.Value) {
+func int8Encoder(e *encodeState, k string, v reflect.Value) {
 	// unsupported in libmcpack, int32 employed
-	/*e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_INT16)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutInt16(e.data[e.off:], int16(v.Int()))
-	e.off += 2*/
+	e.int32(k, int32(v.Int()))
+}
 
-	int32Encoder(e, k, v)
+// type(1) | name length(1) | raw name bytes | 0x00 | value bytes
+func int16Encoder(e *encodeState, k string, v reflect.Value) {
+	// unsupported in libmcpack, int32 employed
+	e.int32(k, int32(v.Int()))
 }
 
 // type(1) | name length(1) | raw name bytes | 0x00 | value bytes
 func int32Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_INT32)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutInt32(e.data[e.off:], int32(v.Int()))
-	e.off += 4
+	e.int32(k, int32(v.Int()))
 }
 
 // type(1) | name length(1) | raw name bytes | 0x00 | value bytes
 func int64Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_INT64)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutInt64(e.data[e.off:], v.Int())
-	e.off += 8
+	e.int64(k, v.Int())
 }
 
 func uint8Encoder(e *encodeState, k string, v reflect.Value) {
 	// unsupported in libmcpack, uint32 employed
-	/*e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_UINT8)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutUint8(e.data[e.off:], uint8(v.Uint()))
-	e.off += 1*/
-
-	uint32Encoder(e, k, v)
+	e.uint32(k, uint32(v.Uint()))
 }
 
 func uint16Encoder(e *encodeState, k string, v reflect.Value) {
 	// unsupported in libmcpack, uint32 employed
-	/*e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_UINT16)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutUint16(e.data[e.off:], uint16(v.Uint()))
-	e.off += 2*/
-
-	uint32Encoder(e, k, v)
+	e.uint32(k, uint32(v.Uint()))
 }
-func uint32Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_UINT32)
-	e.setKey(k, e.setKeyLen(k))
 
-	PutUint32(e.data[e.off:], uint32(v.Uint()))
-	e.off += 4
+func uint32Encoder(e *encodeState, k string, v reflect.Value) {
+	e.uint32(k, uint32(v.Uint()))
 }
-func uint64Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
 
-	e.setType(MCPACKV2_UINT64)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutUint64(e.data[e.off:], uint64(v.Uint()))
-	e.off += 8
+func uint64Encoder(e *encodeState, k string, v reflect.Value) {
+	e.uint64(k, v.Uint())
 }
 
 func float32Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 4)
-
-	e.setType(MCPACKV2_FLOAT)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutFloat32(e.data[e.off:], float32(v.Float()))
-	e.off += 4
+	e.float32(k, float32(v.Float()))
 }
 
 func float64Encoder(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + len(k) + 1 + 8)
-
-	e.setType(MCPACKV2_DOUBLE)
-	e.setKey(k, e.setKeyLen(k))
-
-	PutFloat64(e.data[e.off:], v.Float())
-	e.off += 8
+	e.float64(k, v.Float())
 }
 
 func stringEncoder(e *encodeState, k string, v reflect.Value) {
-	//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value | 0x00
-	//max(short_vitem, long_vitem)
-	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + v.Len() + 1)
-
-	vlen := len(v.String()) + 1
-	if vlen < MAX_SHORT_VITEM_LEN {
-		//type(1) | klen(1) | vlen(1) | key(len(k)) | 0x00 | value | 0x00
-		//type(1)
-		e.setType(MCPACKV2_SHORT_STRING)
-		//klen(1)
-		l := e.setKeyLen(k)
-		//vlen(1)
-		PutUint8(e.data[e.off:], uint8(vlen))
-		e.off++
-		//key(k[0:l]) | 0x00
-		e.setKey(k, l)
-	} else {
-		//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value | 0x00
-		//type(1)
-		e.setType(MCPACKV2_STRING)
-		//klen(l)
-		l := e.setKeyLen(k)
-		//vlen(4)
-		PutUint32(e.data[e.off:], uint32(vlen))
-		e.off += 4
-		//key(k[:l]) | 0x00
-		e.setKey(k, l)
-	}
-
-	//value | 0x00
-	e.off += copy(e.data[e.off:], v.String())
-	e.data[e.off] = 0
-	e.off++
+	e.string(k, v.String())
 }
 
 func binaryEncoder(e *encodeState, k string, v reflect.Value) {
-	//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value
-	//max(short_vitem, long_vitem)
-	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + v.Len())
-
-	vlen := len(v.Bytes())
-	if vlen <= MAX_SHORT_VITEM_LEN {
-		//type(1) | klen(1) | vlen(1) | key(len(k)) | 0x00 | value
-		//type(1)
-		e.setType(MCPACKV2_SHORT_BINARY)
-		//klen(1)
-		l := e.setKeyLen(k)
-		//vlen(1)
-		PutUint8(e.data[e.off:], uint8(vlen))
-		e.off++
-		//key(k[:l])) | 0x00
-		e.setKey(k, l)
-	} else {
-		//type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | value
-		//type(1)
-		e.setType(MCPACKV2_BINARY)
-		//klen(1)
-		l := e.setKeyLen(k)
-		//vlen(4)
-		PutUint32(e.data[e.off:], uint32(vlen))
-		e.off += 4
-		//key(k[0:l]) | 0x00
-		e.setKey(k, l)
-	}
-	//value
-	e.off += copy(e.data[e.off:], v.Bytes())
+	e.binary(k, v.Bytes())
 }
 
 func interfaceEncoder(e *encodeState, k string, v reflect.Value) {
@@ -407,32 +629,21 @@ type structEncoder struct {
 }
 
 func (se *structEncoder) encode(e *encodeState, k string, v reflect.Value) {
-	// type(1) | klen(1) | vlen(4) | key(len(k)) | 0x00 | field number(4)
-	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + 4)
-	//type(1)
-	e.setType(MCPACKV2_OBJECT)
-	//klen(1)
-	l := e.setKeyLen(k)
-	//vlen defer
-	vlenpos := e.off
-	e.off += 4
-	//key(k[:l]) | 0x00
-	e.setKey(k, l)
-	//vpos defer
-	vpos := e.off
-	//count(4)
-	PutInt32(e.data[e.off:], int32(len(se.fields)))
-	e.off += 4
-	//elem
+	vlenpos, vpos := e.beginContainer(MCPACKV2_OBJECT, k)
+	//elem, unsupported types write nothing and are not counted
+	n := 0
 	for i, f := range se.fields {
 		fv := fieldByIndex(v, f.index)
 		if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
 			continue
 		}
+		off := e.off
 		se.fieldEncs[i](e, f.name, fv)
+		if e.off != off {
+			n++
+		}
 	}
-	//vlen
-	PutInt32(e.data[vlenpos:], int32(e.off-vpos))
+	e.endContainer(vlenpos, vpos, n)
 }
 
 func newStructEncoder(t reflect.Type) encoderFunc {
@@ -452,26 +663,16 @@ type mapEncoder struct {
 }
 
 func (me *mapEncoder) encode(e *encodeState, k string, v reflect.Value) {
-	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + 4)
-	//type(1)
-	e.setType(MCPACKV2_OBJECT)
-	//klen(1)
-	l := e.setKeyLen(k)
-	//vlen defer
-	vlenpos := e.off
-	e.off += 4
-	//key(k[:l]) | 0x00
-	e.setKey(k, l)
-	//vpos defer
-	vpos := e.off
-	PutInt32(e.data[e.off:], int32(len(v.MapKeys())))
-	e.off += 4
-
+	vlenpos, vpos := e.beginContainer(MCPACKV2_OBJECT, k)
+	n := 0
 	for _, k := range v.MapKeys() {
+		off := e.off
 		me.elemEnc(e, k.String(), v.MapIndex(k))
+		if e.off != off {
+			n++
+		}
 	}
-	//vlen
-	PutInt32(e.data[vlenpos:], int32(e.off-vpos))
+	e.endContainer(vlenpos, vpos, n)
 }
 
 func newMapEncoder(t reflect.Type) encoderFunc {
@@ -503,29 +704,16 @@ type arrayEncoder struct {
 }
 
 func (ae *arrayEncoder) encode(e *encodeState, k string, v reflect.Value) {
-	// type(1) | klen(1) | vlen(4) | key(len(0)) | 0x00 | field
-	// number(4)
-	e.resizeIfNeeded(1 + 1 + 4 + len(k) + 1 + 4)
-	//type(1)
-	e.setType(MCPACKV2_ARRAY)
-	//klen(k[:l])
-	l := e.setKeyLen(k)
-	//vlen defer
-	vlenpos := e.off
-	e.off += 4
-	//key(k[:l]) | 0x00
-	e.setKey(k, l)
-	//vpos defer
-	vpos := e.off
-	//count(4)
-	PutInt32(e.data[e.off:], int32(v.Len()))
-	e.off += 4
-
+	vlenpos, vpos := e.beginContainer(MCPACKV2_ARRAY, k)
+	n := 0
 	for i := 0; i < v.Len(); i++ {
+		off := e.off
 		ae.elemEnc(e, "", v.Index(i))
+		if e.off != off {
+			n++
+		}
 	}
-	//vlen
-	PutInt32(e.data[vlenpos:], int32(e.off-vpos))
+	e.endContainer(vlenpos, vpos, n)
 }
 
 func newArrayEncoder(t reflect.Type) encoderFunc {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+	"time"
 )
 
 type marshalTest struct {
@@ -44,6 +45,17 @@ type Y struct {
 	Empty []string
 }
 
+type O struct {
+	A string `mcpack:",omitempty"`
+	B int32
+}
+
+type C struct {
+	Ch  chan int
+	Chs []chan int
+	B   int32
+}
+
 type E struct {
 	Beta map[string]string
 }
@@ -87,6 +99,21 @@ var marshalTests = []marshalTest{
 		},
 	},
 	getTestsKeyTooLongE(),
+	{
+		// omitted fields are not counted
+		in: &O{B: 1},
+		out: []byte{MCPACKV2_OBJECT, 0, 12, 0, 0, 0,
+			1, 0, 0, 0,
+			MCPACKV2_INT32, 2, 'B', 0, 1, 0, 0, 0},
+	},
+	{
+		// unsupported values are not written nor counted
+		in: &C{Chs: make([]chan int, 2), B: 1},
+		out: []byte{MCPACKV2_OBJECT, 0, 26, 0, 0, 0,
+			2, 0, 0, 0,
+			MCPACKV2_ARRAY, 4, 4, 0, 0, 0, 'C', 'h', 's', 0, 0, 0, 0, 0,
+			MCPACKV2_INT32, 2, 'B', 0, 1, 0, 0, 0},
+	},
 }
 
 func getTestslongVItemW() marshalTest {
@@ -166,3 +193,102 @@ func TestMarshal(t *testing.T) {
 
 	}
 }
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	switch l {
+	case 0:
+		return []byte("low"), nil
+	case 1:
+		return []byte("high"), nil
+	}
+	return nil, fmt.Errorf("invalid level %d", int(l))
+}
+
+func (l *level) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 0
+	case "high":
+		*l = 1
+	default:
+		return fmt.Errorf("invalid level %q", b)
+	}
+	return nil
+}
+
+// cents is encoded as a decimal string, e.g. "1.05".
+type cents int64
+
+func (c *cents) MarshalMCPACK() ([]byte, error) {
+	return Marshal(fmt.Sprintf("%d.%02d", int64(*c)/100, int64(*c)%100))
+}
+
+func (c *cents) UnmarshalMCPACK(b []byte) error {
+	var s string
+	if err := Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var units, frac int64
+	if _, err := fmt.Sscanf(s, "%d.%02d", &units, &frac); err != nil {
+		return err
+	}
+	*c = cents(units*100 + frac)
+	return nil
+}
+
+type hooks struct {
+	When  time.Time
+	Zero  time.Time
+	Level level
+	Price cents
+}
+
+func TestMarshalHooks(t *testing.T) {
+	when := time.Unix(1500000000, 123)
+	got, err := Marshal(&hooks{When: when, Level: 1, Price: 105})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{MCPACKV2_OBJECT, 0, 55, 0, 0, 0,
+		4, 0, 0, 0,
+		MCPACKV2_DATE, 5, 'W', 'h', 'e', 'n', 0}
+	want = append(want, make([]byte, 8)...)
+	PutInt64(want[len(want)-8:], when.UnixNano())
+	want = append(want, MCPACKV2_NULL, 5, 'Z', 'e', 'r', 'o', 0, 0,
+		MCPACKV2_SHORT_STRING, 6, 5, 'L', 'e', 'v', 'e', 'l', 0, 'h', 'i', 'g', 'h', 0,
+		MCPACKV2_SHORT_STRING, 6, 5, 'P', 'r', 'i', 'c', 'e', 0, '1', '.', '0', '5', 0)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+
+	if _, err := Marshal(&hooks{Level: 2}); err == nil {
+		t.Error("expected MarshalText error")
+	}
+	if _, err := Marshal(&hooks{When: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)}); err == nil {
+		t.Error("expected out of range error")
+	}
+}
+
+type timePtrs struct {
+	P   *time.Time
+	Nil *time.Time
+}
+
+func TestMarshalTimePtr(t *testing.T) {
+	when := time.Unix(1500000000, 123)
+	got, err := Marshal(&timePtrs{P: &when})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{MCPACKV2_OBJECT, 0, 23, 0, 0, 0,
+		2, 0, 0, 0,
+		MCPACKV2_DATE, 2, 'P', 0}
+	want = append(want, make([]byte, 8)...)
+	PutInt64(want[len(want)-8:], when.UnixNano())
+	want = append(want, MCPACKV2_NULL, 4, 'N', 'i', 'l', 0, 0)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,703 @@
+// Code generated by "mcpackgen -type=genAll,genInner -output=gen_mcpack_test.go"; DO NOT EDIT.
+
+package mcpack
+
+import (
+	"time"
+)
+
+// MarshalMCPACK implements Marshaler.
+func (v *genAll) MarshalMCPACK() ([]byte, error) {
+	var w Writer
+	v.writeMCPACK(&w, "")
+	return w.Bytes()
+}
+
+func (v *genAll) writeMCPACK(w *Writer, k string) {
+	w.BeginObject(k)
+	w.Bool("B", v.B)
+	w.Int64("I", int64(v.I))
+	w.Int32("I8", int32(v.I8))
+	w.Int32("I16", int32(v.I16))
+	w.Int32("I32", v.I32)
+	w.Int64("I64", v.I64)
+	w.Uint64("U", uint64(v.U))
+	w.Uint32("U8", uint32(v.U8))
+	w.Uint32("U16", uint32(v.U16))
+	w.Uint32("U32", v.U32)
+	w.Uint64("U64", v.U64)
+	w.Float32("F32", v.F32)
+	w.Float64("F64", v.F64)
+	w.String("s", v.S)
+	w.String("LongS", v.LongS)
+	w.Binary("Bin", v.Bin)
+	w.Binary("LongBin", v.LongBin)
+	w.BeginArray("Bytes")
+	for i1 := range v.Bytes {
+		w.Uint32("", uint32(v.Bytes[i1]))
+	}
+	w.End()
+	w.Int64("Num", int64(v.Num))
+	w.BeginArray("Ints")
+	for i2 := range v.Ints {
+		w.Int32("", v.Ints[i2])
+	}
+	w.End()
+	w.BeginArray("Strs")
+	for i3 := range v.Strs {
+		w.String("", v.Strs[i3])
+	}
+	w.End()
+	w.BeginObject("M")
+	for mk4, mv5 := range v.M {
+		w.Int64(string(mk4), mv5)
+	}
+	w.End()
+	if v.Ptr == nil {
+		w.Null("Ptr")
+	} else {
+		w.Int64("Ptr", (*v.Ptr))
+	}
+	if v.NilPtr == nil {
+		w.Null("NilPtr")
+	} else {
+		w.String("NilPtr", (*v.NilPtr))
+	}
+	v.Inner.writeMCPACK(w, "Inner")
+	if v.InnerP == nil {
+		w.Null("InnerP")
+	} else {
+		(*v.InnerP).writeMCPACK(w, "InnerP")
+	}
+	w.BeginArray("Inners")
+	for i6 := range v.Inners {
+		v.Inners[i6].writeMCPACK(w, "")
+	}
+	w.End()
+	w.Value("Any", &v.Any)
+	w.Value("NilAny", &v.NilAny)
+	w.Value("Plain", &v.Plain)
+	if v.UU == nil {
+		w.Null("UU")
+	} else {
+		w.Value("UU", v.UU)
+	}
+	if len(v.Omit) != 0 {
+		w.String("omit", v.Omit)
+	}
+	if v.OmitSet != 0 {
+		w.Int64("OmitSet", int64(v.OmitSet))
+	}
+	w.String("Dup", v.Dup)
+	w.Date("When", v.When)
+	w.Date("Zero", v.Zero)
+	if v.WhenP == nil {
+		w.Null("WhenP")
+	} else {
+		w.Date("WhenP", (*v.WhenP))
+	}
+	w.Value("Level", &v.Level)
+	w.Value("Price", &v.Price)
+	w.String("E1", v.GenEmbedded.E1)
+	w.End()
+}
+
+var mcpackFieldsGenAll = []string{"B", "I", "I8", "I16", "I32", "I64", "U", "U8", "U16", "U32", "U64", "F32", "F64", "s", "LongS", "Bin", "LongBin", "Bytes", "Num", "Ints", "Strs", "M", "Ptr", "NilPtr", "Inner", "InnerP", "Inners", "Any", "NilAny", "Plain", "UU", "omit", "OmitSet", "Dup", "Ch", "When", "Zero", "WhenP", "Level", "Price", "E1"}
+
+// UnmarshalMCPACK implements Unmarshaler.
+func (v *genAll) UnmarshalMCPACK(data []byte) error {
+	return UnmarshalWith(data, v.readMCPACK)
+}
+
+func (v *genAll) readMCPACK(r *Reader, tk Token) error {
+	if tk.Type == MCPACKV2_NULL {
+		*v = genAll{}
+		return nil
+	}
+	if _, err := tk.Object(); err != nil {
+		return err
+	}
+	for {
+		tk, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if tk.End() {
+			return nil
+		}
+		switch FieldIndex(tk.Key, mcpackFieldsGenAll) {
+		case 0:
+			if tk.Type == MCPACKV2_NULL {
+				v.B = false
+			} else {
+				val7, err := tk.Bool()
+				if err != nil {
+					return err
+				}
+				v.B = val7
+			}
+		case 1:
+			if tk.Type == MCPACKV2_NULL {
+				v.I = 0
+			} else {
+				val8, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.I = int(val8)
+			}
+		case 2:
+			if tk.Type == MCPACKV2_NULL {
+				v.I8 = 0
+			} else {
+				val9, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.I8 = int8(val9)
+			}
+		case 3:
+			if tk.Type == MCPACKV2_NULL {
+				v.I16 = 0
+			} else {
+				val10, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.I16 = int16(val10)
+			}
+		case 4:
+			if tk.Type == MCPACKV2_NULL {
+				v.I32 = 0
+			} else {
+				val11, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.I32 = int32(val11)
+			}
+		case 5:
+			if tk.Type == MCPACKV2_NULL {
+				v.I64 = 0
+			} else {
+				val12, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.I64 = val12
+			}
+		case 6:
+			if tk.Type == MCPACKV2_NULL {
+				v.U = 0
+			} else {
+				val13, err := tk.Uint()
+				if err != nil {
+					return err
+				}
+				v.U = uint(val13)
+			}
+		case 7:
+			if tk.Type == MCPACKV2_NULL {
+				v.U8 = 0
+			} else {
+				val14, err := tk.Uint()
+				if err != nil {
+					return err
+				}
+				v.U8 = uint8(val14)
+			}
+		case 8:
+			if tk.Type == MCPACKV2_NULL {
+				v.U16 = 0
+			} else {
+				val15, err := tk.Uint()
+				if err != nil {
+					return err
+				}
+				v.U16 = uint16(val15)
+			}
+		case 9:
+			if tk.Type == MCPACKV2_NULL {
+				v.U32 = 0
+			} else {
+				val16, err := tk.Uint()
+				if err != nil {
+					return err
+				}
+				v.U32 = uint32(val16)
+			}
+		case 10:
+			if tk.Type == MCPACKV2_NULL {
+				v.U64 = 0
+			} else {
+				val17, err := tk.Uint()
+				if err != nil {
+					return err
+				}
+				v.U64 = val17
+			}
+		case 11:
+			if tk.Type == MCPACKV2_NULL {
+				v.F32 = 0
+			} else {
+				val18, err := tk.Float()
+				if err != nil {
+					return err
+				}
+				v.F32 = float32(val18)
+			}
+		case 12:
+			if tk.Type == MCPACKV2_NULL {
+				v.F64 = 0
+			} else {
+				val19, err := tk.Float()
+				if err != nil {
+					return err
+				}
+				v.F64 = val19
+			}
+		case 13:
+			if tk.Type == MCPACKV2_NULL {
+				v.S = ""
+			} else {
+				val20, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.S = string(val20)
+			}
+		case 14:
+			if tk.Type == MCPACKV2_NULL {
+				v.LongS = ""
+			} else {
+				val21, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.LongS = string(val21)
+			}
+		case 15:
+			if tk.Type == MCPACKV2_NULL {
+				v.Bin = nil
+			} else {
+				val22, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.Bin = val22
+			}
+		case 16:
+			if tk.Type == MCPACKV2_NULL {
+				v.LongBin = nil
+			} else {
+				val23, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.LongBin = val23
+			}
+		case 17:
+			if tk.Type == MCPACKV2_NULL {
+				v.Bytes = [2]byte{}
+			} else {
+				n24, err := tk.Array()
+				if err != nil {
+					return err
+				}
+				for i25 := 0; i25 < n24; i25++ {
+					tk, err := r.Next()
+					if err != nil {
+						return err
+					}
+					if i25 >= len(v.Bytes) {
+						if err := r.Discard(tk); err != nil {
+							return err
+						}
+						continue
+					}
+					if tk.Type == MCPACKV2_NULL {
+						v.Bytes[i25] = 0
+					} else {
+						val26, err := tk.Uint()
+						if err != nil {
+							return err
+						}
+						v.Bytes[i25] = byte(val26)
+					}
+				}
+				for i25 := n24; i25 < len(v.Bytes); i25++ {
+					v.Bytes[i25] = 0
+				}
+				if _, err := r.Next(); err != nil {
+					return err
+				}
+			}
+		case 18:
+			if tk.Type == MCPACKV2_NULL {
+				v.Num = 0
+			} else {
+				val27, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.Num = Number(val27)
+			}
+		case 19:
+			if tk.Type == MCPACKV2_NULL {
+				v.Ints = nil
+			} else {
+				n28, err := tk.Array()
+				if err != nil {
+					return err
+				}
+				if n28 == 0 || cap(v.Ints) < n28 {
+					v.Ints = make([]int32, n28)
+				} else {
+					v.Ints = v.Ints[:n28]
+				}
+				for i29 := range v.Ints {
+					tk, err := r.Next()
+					if err != nil {
+						return err
+					}
+					if tk.Type == MCPACKV2_NULL {
+						v.Ints[i29] = 0
+					} else {
+						val30, err := tk.Int()
+						if err != nil {
+							return err
+						}
+						v.Ints[i29] = int32(val30)
+					}
+				}
+				if _, err := r.Next(); err != nil {
+					return err
+				}
+			}
+		case 20:
+			if tk.Type == MCPACKV2_NULL {
+				v.Strs = [2]string{}
+			} else {
+				n31, err := tk.Array()
+				if err != nil {
+					return err
+				}
+				for i32 := 0; i32 < n31; i32++ {
+					tk, err := r.Next()
+					if err != nil {
+						return err
+					}
+					if i32 >= len(v.Strs) {
+						if err := r.Discard(tk); err != nil {
+							return err
+						}
+						continue
+					}
+					if tk.Type == MCPACKV2_NULL {
+						v.Strs[i32] = ""
+					} else {
+						val33, err := tk.Bytes()
+						if err != nil {
+							return err
+						}
+						v.Strs[i32] = string(val33)
+					}
+				}
+				for i32 := n31; i32 < len(v.Strs); i32++ {
+					v.Strs[i32] = ""
+				}
+				if _, err := r.Next(); err != nil {
+					return err
+				}
+			}
+		case 21:
+			if tk.Type == MCPACKV2_NULL {
+				v.M = nil
+			} else {
+				if _, err := tk.Object(); err != nil {
+					return err
+				}
+				if v.M == nil {
+					v.M = make(map[string]int64)
+				}
+				for {
+					tk, err := r.Next()
+					if err != nil {
+						return err
+					}
+					if tk.End() {
+						break
+					}
+					mk34 := string(tk.Key)
+					var mv35 int64
+					if tk.Type == MCPACKV2_NULL {
+						mv35 = 0
+					} else {
+						val36, err := tk.Int()
+						if err != nil {
+							return err
+						}
+						mv35 = val36
+					}
+					v.M[mk34] = mv35
+				}
+			}
+		case 22:
+			if tk.Type == MCPACKV2_NULL {
+				v.Ptr = nil
+			} else {
+				if v.Ptr == nil {
+					v.Ptr = new(int64)
+				}
+				if tk.Type == MCPACKV2_NULL {
+					(*v.Ptr) = 0
+				} else {
+					val37, err := tk.Int()
+					if err != nil {
+						return err
+					}
+					(*v.Ptr) = val37
+				}
+			}
+		case 23:
+			if tk.Type == MCPACKV2_NULL {
+				v.NilPtr = nil
+			} else {
+				if v.NilPtr == nil {
+					v.NilPtr = new(string)
+				}
+				if tk.Type == MCPACKV2_NULL {
+					(*v.NilPtr) = ""
+				} else {
+					val38, err := tk.Bytes()
+					if err != nil {
+						return err
+					}
+					(*v.NilPtr) = string(val38)
+				}
+			}
+		case 24:
+			if err := v.Inner.readMCPACK(r, tk); err != nil {
+				return err
+			}
+		case 25:
+			if tk.Type == MCPACKV2_NULL {
+				v.InnerP = nil
+			} else {
+				if v.InnerP == nil {
+					v.InnerP = new(genInner)
+				}
+				if err := (*v.InnerP).readMCPACK(r, tk); err != nil {
+					return err
+				}
+			}
+		case 26:
+			if tk.Type == MCPACKV2_NULL {
+				v.Inners = nil
+			} else {
+				n39, err := tk.Array()
+				if err != nil {
+					return err
+				}
+				if n39 == 0 || cap(v.Inners) < n39 {
+					v.Inners = make([]genInner, n39)
+				} else {
+					v.Inners = v.Inners[:n39]
+				}
+				for i40 := range v.Inners {
+					tk, err := r.Next()
+					if err != nil {
+						return err
+					}
+					if err := v.Inners[i40].readMCPACK(r, tk); err != nil {
+						return err
+					}
+				}
+				if _, err := r.Next(); err != nil {
+					return err
+				}
+			}
+		case 27:
+			if err := Unmarshal(tk.Raw, &v.Any); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 28:
+			if err := Unmarshal(tk.Raw, &v.NilAny); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 29:
+			if err := Unmarshal(tk.Raw, &v.Plain); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 30:
+			if err := Unmarshal(tk.Raw, &v.UU); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 31:
+			if tk.Type == MCPACKV2_NULL {
+				v.Omit = ""
+			} else {
+				val41, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.Omit = string(val41)
+			}
+		case 32:
+			if tk.Type == MCPACKV2_NULL {
+				v.OmitSet = 0
+			} else {
+				val42, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.OmitSet = int(val42)
+			}
+		case 33:
+			if tk.Type == MCPACKV2_NULL {
+				v.Dup = ""
+			} else {
+				val43, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.Dup = string(val43)
+			}
+		case 34:
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 35:
+			val44, err := tk.Time()
+			if err != nil {
+				return err
+			}
+			v.When = val44
+		case 36:
+			val45, err := tk.Time()
+			if err != nil {
+				return err
+			}
+			v.Zero = val45
+		case 37:
+			if tk.Type == MCPACKV2_NULL {
+				v.WhenP = nil
+			} else {
+				if v.WhenP == nil {
+					v.WhenP = new(time.Time)
+				}
+				val46, err := tk.Time()
+				if err != nil {
+					return err
+				}
+				(*v.WhenP) = val46
+			}
+		case 38:
+			if err := Unmarshal(tk.Raw, &v.Level); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 39:
+			if err := Unmarshal(tk.Raw, &v.Price); err != nil {
+				return err
+			}
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		case 40:
+			if tk.Type == MCPACKV2_NULL {
+				v.GenEmbedded.E1 = ""
+			} else {
+				val47, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.GenEmbedded.E1 = string(val47)
+			}
+		default:
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// MarshalMCPACK implements Marshaler.
+func (v *genInner) MarshalMCPACK() ([]byte, error) {
+	var w Writer
+	v.writeMCPACK(&w, "")
+	return w.Bytes()
+}
+
+func (v *genInner) writeMCPACK(w *Writer, k string) {
+	w.BeginObject(k)
+	w.String("name", v.Name)
+	w.Int32("N", v.N)
+	w.End()
+}
+
+var mcpackFieldsGenInner = []string{"name", "N"}
+
+// UnmarshalMCPACK implements Unmarshaler.
+func (v *genInner) UnmarshalMCPACK(data []byte) error {
+	return UnmarshalWith(data, v.readMCPACK)
+}
+
+func (v *genInner) readMCPACK(r *Reader, tk Token) error {
+	if tk.Type == MCPACKV2_NULL {
+		*v = genInner{}
+		return nil
+	}
+	if _, err := tk.Object(); err != nil {
+		return err
+	}
+	for {
+		tk, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if tk.End() {
+			return nil
+		}
+		switch FieldIndex(tk.Key, mcpackFieldsGenInner) {
+		case 0:
+			if tk.Type == MCPACKV2_NULL {
+				v.Name = ""
+			} else {
+				val48, err := tk.Bytes()
+				if err != nil {
+					return err
+				}
+				v.Name = string(val48)
+			}
+		case 1:
+			if tk.Type == MCPACKV2_NULL {
+				v.N = 0
+			} else {
+				val49, err := tk.Int()
+				if err != nil {
+					return err
+				}
+				v.N = int32(val49)
+			}
+		default:
+			if err := r.Discard(tk); err != nil {
+				return err
+			}
+		}
+	}
+}
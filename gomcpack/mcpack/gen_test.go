@@ -0,0 +1,240 @@
+package mcpack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate go run ../mcpackgen -type=genAll,genInner -output=gen_mcpack_test.go
+
+type genInner struct {
+	Name string `mcpack:"name"`
+	N    int32
+}
+
+type GenEmbedded struct {
+	E1  string
+	Dup string
+}
+
+type genAll struct {
+	B       bool
+	I       int
+	I8      int8
+	I16     int16
+	I32     int32
+	I64     int64
+	U       uint
+	U8      uint8
+	U16     uint16
+	U32     uint32
+	U64     uint64
+	F32     float32
+	F64     float64
+	S       string `mcpack:"s"`
+	LongS   string
+	Bin     []byte
+	LongBin []byte
+	Bytes   [2]byte
+	Num     Number
+	Ints    []int32
+	Strs    [2]string
+	M       map[string]int64
+	Ptr     *int64
+	NilPtr  *string
+	Inner   genInner
+	InnerP  *genInner
+	Inners  []genInner
+	Any     interface{}
+	NilAny  interface{}
+	Plain   U
+	UU      *UU
+	Skip    string `mcpack:"-"`
+	Omit    string `mcpack:"omit,omitempty"`
+	OmitSet int    `mcpack:",omitempty"`
+	Dup     string
+	Ch      chan int
+	When    time.Time
+	Zero    time.Time
+	WhenP   *time.Time
+	Level   level
+	Price   cents
+	GenEmbedded
+	unexported int
+}
+
+// plainAll and plainInner have the fields of genAll and genInner but not
+// their generated methods, so they go through the reflection based path.
+type plainAll genAll
+type plainInner genInner
+
+func newGenAll() genAll {
+	p := int64(-5)
+	when := time.Unix(1500000000, 2)
+	return genAll{
+		B: true, I: -1, I8: -8, I16: -16, I32: -32, I64: -64,
+		U: 1, U8: 8, U16: 16, U32: 32, U64: 64,
+		F32: 1.5, F64: -2.5,
+		S:       "short",
+		LongS:   strings.Repeat("s", 300),
+		Bin:     []byte("bin"),
+		LongBin: bytes.Repeat([]byte("b"), 300),
+		Bytes:   [2]byte{1, 2},
+		Num:     Number(7),
+		Ints:    []int32{1, 2, 3},
+		Strs:    [2]string{"a", "b"},
+		M:       map[string]int64{"k": 1},
+		Ptr:     &p,
+		Inner:   genInner{Name: "inner", N: 1},
+		InnerP:  &genInner{Name: "p"},
+		Inners:  []genInner{{Name: "x"}, {N: 2}},
+		Any:     map[string]interface{}{"k": "v"},
+		Plain:   U{Alphabet: "a-z"},
+		UU:      &UU{},
+		Skip:    "skip",
+		OmitSet: 3,
+		Dup:     "outer",
+		When:    time.Unix(1500000000, 1),
+		WhenP:   &when,
+		Level:   1,
+		Price:   250,
+		GenEmbedded: GenEmbedded{
+			E1:  "e1",
+			Dup: "inner",
+		},
+	}
+}
+
+func TestGeneratedMarshal(t *testing.T) {
+	inner := genInner{Name: "n", N: -1}
+	got, err := inner.MarshalMCPACK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := plainInner(inner)
+	want, err := Marshal(&plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("genInner:\ngot  %v\nwant %v", got, want)
+	}
+
+	for _, v := range []genAll{newGenAll(), {}} {
+		got, err := v.MarshalMCPACK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := plainAll(v)
+		want, err := Marshal(&plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("genAll:\ngot  %v\nwant %v", got, want)
+		}
+		// Marshal uses the generated method
+		if viaHook, _ := Marshal(&v); !bytes.Equal(viaHook, want) {
+			t.Errorf("Marshal(genAll):\ngot  %v\nwant %v", viaHook, want)
+		}
+	}
+}
+
+func TestGeneratedUnmarshal(t *testing.T) {
+	in := newGenAll()
+	data, err := in.MarshalMCPACK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got genAll
+	if err := got.UnmarshalMCPACK(data); err != nil {
+		t.Fatal(err)
+	}
+	var want plainAll
+	if err := Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	// UnmarshalMCPACK receives the raw item
+	got.UU, want.UU = nil, nil
+	if !reflect.DeepEqual(plainAll(got), want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// Unmarshal uses the generated method
+	var viaHook genAll
+	if err := Unmarshal(data, &viaHook); err != nil {
+		t.Fatal(err)
+	}
+	viaHook.UU = nil
+	if !reflect.DeepEqual(viaHook, got) {
+		t.Errorf("Unmarshal(genAll):\ngot  %+v\nwant %+v", viaHook, got)
+	}
+
+	got.UU = in.UU
+	again, err := got.MarshalMCPACK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("round trip:\ngot  %v\nwant %v", again, data)
+	}
+}
+
+func TestGeneratedUnmarshalErrors(t *testing.T) {
+	data, _ := Marshal(&T{X: "x"})
+	var v genAll
+	if err := v.UnmarshalMCPACK(append(data, data...)); err == nil {
+		t.Error("expected error for trailing data")
+	}
+	if err := v.UnmarshalMCPACK(data[:len(data)-1]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+	s, _ := Marshal("s")
+	if err := v.UnmarshalMCPACK(s); err == nil {
+		t.Error("expected error for a string")
+	}
+}
+
+func BenchmarkMarshalReflect(b *testing.B) {
+	v := plainAll(newGenAll())
+	v.UU = nil
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Marshal(&v)
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	v := newGenAll()
+	v.UU = nil
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.MarshalMCPACK()
+	}
+}
+
+func BenchmarkUnmarshalReflect(b *testing.B) {
+	v := newGenAll()
+	v.UU = nil
+	data, _ := v.MarshalMCPACK()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var p plainAll
+		Unmarshal(data, &p)
+	}
+}
+
+func BenchmarkUnmarshalGenerated(b *testing.B) {
+	v := newGenAll()
+	v.UU = nil
+	data, _ := v.MarshalMCPACK()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var g genAll
+		g.UnmarshalMCPACK(data)
+	}
+}
@@ -0,0 +1,46 @@
+package mcpack
+
+import (
+	"bytes"
+	"io"
+)
+
+// This file holds helpers for the code generated by mcpackgen.
+
+// FieldIndex returns the index of the name matching key: the first equal
+// one, or else the first one equal under case folding, as Unmarshal matches
+// struct fields. It returns -1 if none matches.
+func FieldIndex(key []byte, names []string) int {
+	fold := -1
+	for i, name := range names {
+		if string(key) == name {
+			return i
+		}
+		if fold < 0 && bytes.EqualFold(key, []byte(name)) {
+			fold = i
+		}
+	}
+	return fold
+}
+
+// UnmarshalWith reads the single item in data with f.
+func UnmarshalWith(data []byte, f func(r *Reader, t Token) error) error {
+	r := NewReader(data)
+	t, err := r.Next()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := f(r, t); err != nil {
+		return err
+	}
+	if _, err := r.Next(); err != io.EOF {
+		if err == nil {
+			err = errUnexpectedEnd
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package mcpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var errTruncated = errors.New("mcpack: truncated item")
+
+// A Token is an item read by a Reader. Key, Value and Raw refer to the
+// underlying data and are only valid as long as it is not modified.
+type Token struct {
+	Type byte
+	// Key is the name of the item without the trailing 0x00, empty for
+	// array elements and the top level item.
+	Key []byte
+	// Value is the content of the item: the member number and the members
+	// of an object or array, the bytes of a string including its trailing
+	// 0x00, the bytes of a binary or the little endian number.
+	Value []byte
+	// Raw is the whole item, header, key and value, which can be copied
+	// unchanged with Writer.Raw.
+	Raw []byte
+}
+
+// End reports whether t marks the end of an object or array. End tokens have
+// type MCPACKV2_INVALID and no key or value.
+func (t Token) End() bool {
+	return t.Type == MCPACKV2_INVALID
+}
+
+// Len returns the member number of an object or array.
+func (t Token) Len() int {
+	if (t.Type != MCPACKV2_OBJECT && t.Type != MCPACKV2_ARRAY) || len(t.Value) < 4 {
+		return 0
+	}
+	return int(Uint32(t.Value))
+}
+
+// Object returns the member number of an object, or an error for other
+// items.
+func (t Token) Object() (int, error) {
+	if t.Type != MCPACKV2_OBJECT {
+		return 0, t.typeError("object")
+	}
+	return t.Len(), nil
+}
+
+// Array returns the element number of an array, or an error for other
+// items.
+func (t Token) Array() (int, error) {
+	if t.Type != MCPACKV2_ARRAY {
+		return 0, t.typeError("array")
+	}
+	return t.Len(), nil
+}
+
+// Bytes returns the content of a string without its trailing 0x00, or of a
+// binary, without copying it.
+func (t Token) Bytes() ([]byte, error) {
+	switch t.Type {
+	case MCPACKV2_STRING, MCPACKV2_SHORT_STRING:
+		if n := len(t.Value); n > 0 && t.Value[n-1] == 0 {
+			return t.Value[:n-1], nil
+		}
+		return t.Value, nil
+	case MCPACKV2_BINARY, MCPACKV2_SHORT_BINARY:
+		return t.Value, nil
+	}
+	return nil, t.typeError("string or binary")
+}
+
+// Int returns the value of a signed or unsigned integer item.
+func (t Token) Int() (int64, error) {
+	switch t.Type {
+	case MCPACKV2_INT8:
+		return int64(int8(t.Value[0])), nil
+	case MCPACKV2_INT16:
+		return int64(int16(uint16(t.Value[0]) | uint16(t.Value[1])<<8)), nil
+	case MCPACKV2_INT32:
+		return int64(Int32(t.Value)), nil
+	case MCPACKV2_INT64:
+		return Int64(t.Value), nil
+	case MCPACKV2_UINT8, MCPACKV2_UINT16, MCPACKV2_UINT32, MCPACKV2_UINT64:
+		v, err := t.Uint()
+		return int64(v), err
+	}
+	return 0, t.typeError("integer")
+}
+
+// Uint returns the value of an unsigned or signed integer item.
+func (t Token) Uint() (uint64, error) {
+	switch t.Type {
+	case MCPACKV2_UINT8:
+		return uint64(Uint8(t.Value)), nil
+	case MCPACKV2_UINT16:
+		return uint64(t.Value[0]) | uint64(t.Value[1])<<8, nil
+	case MCPACKV2_UINT32:
+		return uint64(Uint32(t.Value)), nil
+	case MCPACKV2_UINT64:
+		return Uint64(t.Value), nil
+	case MCPACKV2_INT8, MCPACKV2_INT16, MCPACKV2_INT32, MCPACKV2_INT64:
+		v, err := t.Int()
+		return uint64(v), err
+	}
+	return 0, t.typeError("integer")
+}
+
+// Float returns the value of a float or double item.
+func (t Token) Float() (float64, error) {
+	switch t.Type {
+	case MCPACKV2_FLOAT:
+		return float64(Float32(t.Value)), nil
+	case MCPACKV2_DOUBLE:
+		return Float64(t.Value), nil
+	}
+	return 0, t.typeError("float")
+}
+
+// Time returns the value of a date item, or the zero time for null.
+func (t Token) Time() (time.Time, error) {
+	switch t.Type {
+	case MCPACKV2_DATE:
+		return time.Unix(0, Int64(t.Value)), nil
+	case MCPACKV2_NULL:
+		return time.Time{}, nil
+	}
+	return time.Time{}, t.typeError("date")
+}
+
+// Bool returns the value of a bool item.
+func (t Token) Bool() (bool, error) {
+	if t.Type != MCPACKV2_BOOL {
+		return false, t.typeError("bool")
+	}
+	return t.Value[0] != 0, nil
+}
+
+func (t Token) typeError(want string) error {
+	return fmt.Errorf("mcpack: item %q of type 0x%02x is not a %s", t.Key, t.Type, want)
+}
+
+// A Reader iterates over the items of an mcpack document without
+// reflection. Objects and arrays are followed by their members, unless
+// skipped, and then by an end token:
+//
+//	r := mcpack.NewReader(data)
+//	for {
+//		t, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type Reader struct {
+	data []byte
+	off  int
+	// remaining members of the open objects and arrays
+	stack []int
+	// end of the last returned object or array, to skip it
+	skipTo int
+	err    error
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data, skipTo: -1}
+}
+
+// Depth returns the number of open objects and arrays.
+func (r *Reader) Depth() int {
+	return len(r.stack)
+}
+
+// Next returns the next item. It returns io.EOF at the end of the data,
+// which may hold several concatenated documents.
+func (r *Reader) Next() (Token, error) {
+	if r.err != nil {
+		return Token{}, r.err
+	}
+	r.skipTo = -1
+	if n := len(r.stack); n > 0 {
+		if r.stack[n-1] == 0 {
+			r.stack = r.stack[:n-1]
+			return Token{}, nil
+		}
+		r.stack[n-1]--
+	} else if r.off == len(r.data) {
+		r.err = io.EOF
+		return Token{}, r.err
+	}
+
+	t, err := r.item()
+	if err != nil {
+		r.err = err
+		return Token{}, err
+	}
+	if t.Type == MCPACKV2_OBJECT || t.Type == MCPACKV2_ARRAY {
+		// step into the members
+		r.skipTo = r.off
+		r.off -= len(t.Value) - 4
+		r.stack = append(r.stack, t.Len())
+	}
+	return t, nil
+}
+
+// Skip skips the members of the object or array returned by the last call
+// to Next, so that the following call returns its end token. It does nothing
+// after other items.
+func (r *Reader) Skip() {
+	if r.skipTo < 0 {
+		return
+	}
+	r.off = r.skipTo
+	r.stack[len(r.stack)-1] = 0
+	r.skipTo = -1
+}
+
+// Discard moves past t, the token just returned by Next: for an object or
+// array it skips the members and reads the end token.
+func (r *Reader) Discard(t Token) error {
+	if t.Type != MCPACKV2_OBJECT && t.Type != MCPACKV2_ARRAY {
+		return nil
+	}
+	r.Skip()
+	_, err := r.Next()
+	return err
+}
+
+// item reads the item at r.off and moves past it.
+func (r *Reader) item() (Token, error) {
+	data := r.data[r.off:]
+	if len(data) < 2 {
+		return Token{}, errTruncated
+	}
+	hlen, err := headerLen(data[0])
+	if err != nil {
+		return Token{}, err
+	}
+	if len(data) < hlen {
+		return Token{}, errTruncated
+	}
+	size := itemLen(data[:hlen])
+	if len(data) < size {
+		return Token{}, errTruncated
+	}
+	klen := int(data[1])
+	t := Token{
+		Type:  data[0],
+		Value: data[hlen+klen : size],
+		Raw:   data[:size],
+	}
+	if klen > 0 {
+		t.Key = data[hlen : hlen+klen-1]
+	}
+	if (t.Type == MCPACKV2_OBJECT || t.Type == MCPACKV2_ARRAY) && len(t.Value) < 4 {
+		return Token{}, errTruncated
+	}
+	r.off += size
+	return t, nil
+}
@@ -0,0 +1,134 @@
+package mcpack
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	data, err := Marshal(X{Beta: map[string]string{"k": "v"}, Deta: [2]int16{1, -2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(data)
+	want := []struct {
+		typ   byte
+		key   string
+		depth int
+	}{
+		{MCPACKV2_OBJECT, "", 1},
+		{MCPACKV2_OBJECT, "Beta", 2},
+		{MCPACKV2_SHORT_STRING, "k", 2},
+		{MCPACKV2_INVALID, "", 1},
+		{MCPACKV2_ARRAY, "Deta", 2},
+		{MCPACKV2_INT32, "", 2},
+		{MCPACKV2_INT32, "", 2},
+		{MCPACKV2_INVALID, "", 1},
+		{MCPACKV2_INVALID, "", 0},
+	}
+	var ints []int64
+	for i, w := range want {
+		tok, err := r.Next()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if tok.Type != w.typ || string(tok.Key) != w.key || r.Depth() != w.depth {
+			t.Errorf("#%d: got type 0x%02x key %q depth %d, want 0x%02x %q %d",
+				i, tok.Type, tok.Key, r.Depth(), w.typ, w.key, w.depth)
+		}
+		switch tok.Type {
+		case MCPACKV2_SHORT_STRING:
+			if b, _ := tok.Bytes(); string(b) != "v" {
+				t.Errorf("#%d: got %q, want v", i, b)
+			}
+		case MCPACKV2_INT32:
+			v, _ := tok.Int()
+			ints = append(ints, v)
+		case MCPACKV2_ARRAY:
+			if tok.Len() != 2 {
+				t.Errorf("#%d: got len %d, want 2", i, tok.Len())
+			}
+		}
+	}
+	if len(ints) != 2 || ints[0] != 1 || ints[1] != -2 {
+		t.Errorf("got %v, want [1 -2]", ints)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestReaderSkip(t *testing.T) {
+	data, err := Marshal(X{Beta: map[string]string{"k": "v"}, Deta: [2]int16{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(data)
+	r.Next()
+	tok, _ := r.Next()
+	if string(tok.Key) != "Beta" {
+		t.Fatalf("got %q, want Beta", tok.Key)
+	}
+	r.Skip()
+	if tok, _ = r.Next(); !tok.End() {
+		t.Fatalf("got type 0x%02x, want end", tok.Type)
+	}
+	if tok, _ = r.Next(); string(tok.Key) != "Deta" {
+		t.Fatalf("got %q, want Deta", tok.Key)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	data, err := Marshal(T{X: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(data[:len(data)-1])
+	for {
+		_, err = r.Next()
+		if err != nil {
+			break
+		}
+	}
+	if err != errTruncated {
+		t.Errorf("got %v, want errTruncated", err)
+	}
+}
+
+// Rewrite one field of an object, copying the others unchanged.
+func TestReaderWriterRewrite(t *testing.T) {
+	data, err := Marshal(T{A: true, X: "old", Y: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(data)
+	var w Writer
+	for {
+		tok, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case tok.End():
+			w.End()
+		case tok.Type == MCPACKV2_OBJECT:
+			w.BeginObject(string(tok.Key))
+		case string(tok.Key) == "X":
+			w.String("X", "new")
+		default:
+			w.Raw(tok.Raw)
+		}
+	}
+	got, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Marshal(T{A: true, X: "new", Y: 3})
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package mcpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxSize is the default limit of the size of a document read by a
+// Decoder.
+const DefaultMaxSize = 64 << 20
+
+var ErrTooLarge = errors.New("mcpack: document exceeds max size")
+
+// A Decoder reads and decodes mcpack documents, v2 items or v1 packs, from
+// an input stream. It reads exactly one document per Decode and never reads
+// ahead, so whatever follows the document is left in the input; wrap an
+// unbuffered input in a bufio.Reader to decode many small documents.
+//
+// Decoding is not incremental: every document is read into its own buffer
+// of exactly its size before it is decoded, so memory is bounded only by the
+// size limit set with SetMaxSize.
+type Decoder struct {
+	r       io.Reader
+	hdr     [MCPACKV1_HEADER_LEN]byte
+	maxSize int
+	err     error
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, maxSize: DefaultMaxSize}
+}
+
+// SetMaxSize limits the size of a document, including its header. Decode
+// returns ErrTooLarge for a larger document without reading it. n <= 0
+// removes the limit.
+func (dec *Decoder) SetMaxSize(n int) {
+	dec.maxSize = n
+}
+
+// Decode reads the next mcpack document from its input and stores it in the
+// value pointed to by v. It returns io.EOF when the input ends between two
+// documents, and io.ErrUnexpectedEOF when it ends inside one. Byte slices
+// in v may refer to the document, which is not reused.
+func (dec *Decoder) Decode(v interface{}) error {
+	if dec.err != nil {
+		return dec.err
+	}
+	data, err := dec.next()
+	if err != nil {
+		dec.err = err
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// next reads the next document.
+func (dec *Decoder) next() ([]byte, error) {
+	if _, err := io.ReadFull(dec.r, dec.hdr[:1]); err != nil {
+		return nil, err
+	}
+	hlen, err := headerLen(dec.hdr[0])
+	if err != nil {
+		return nil, err
+	}
+	hdr := dec.hdr[:hlen]
+	if _, err := io.ReadFull(dec.r, hdr[1:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	size := itemLen(hdr)
+	if string(hdr[:4]) == MCPACKV1_TAG {
+		// a v1 pack, unless the version does not match; a v2 string item
+		// with such a header is longer than a v1 header, which is kept
+		hdr = dec.hdr[:MCPACKV1_HEADER_LEN]
+		if _, err := io.ReadFull(dec.r, hdr[hlen:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if Uint32(hdr[4:]) == MCPACKV1_VERSION {
+			size = MCPACKV1_HEADER_LEN + int(Uint32(hdr[12:]))
+		}
+	}
+	if dec.maxSize > 0 && size > dec.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	data := make([]byte, size)
+	copy(data, hdr)
+	if _, err := io.ReadFull(dec.r, data[len(hdr):]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return data, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// headerLen returns the length of the header of an item of type typ, i.e.
+// type(1) | name length(1) | content length(0, 1 or 4).
+func headerLen(typ byte) (int, error) {
+	switch typ {
+	case MCPACKV2_OBJECT, MCPACKV2_ARRAY, MCPACKV2_STRING, MCPACKV2_BINARY:
+		return 6, nil
+	case MCPACKV2_SHORT_STRING, MCPACKV2_SHORT_BINARY:
+		return 3, nil
+	case MCPACKV2_INT8, MCPACKV2_INT16, MCPACKV2_INT32, MCPACKV2_INT64,
+		MCPACKV2_UINT8, MCPACKV2_UINT16, MCPACKV2_UINT32, MCPACKV2_UINT64,
+		MCPACKV2_BOOL, MCPACKV2_FLOAT, MCPACKV2_DOUBLE, MCPACKV2_DATE, MCPACKV2_NULL:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("mcpack: invalid item type 0x%02x", typ)
+}
+
+// itemLen returns the total length of the item whose header is hdr.
+func itemLen(hdr []byte) int {
+	klen := int(hdr[1])
+	switch typ := hdr[0]; typ {
+	case MCPACKV2_OBJECT, MCPACKV2_ARRAY, MCPACKV2_STRING, MCPACKV2_BINARY:
+		return 6 + klen + int(Uint32(hdr[2:]))
+	case MCPACKV2_SHORT_STRING, MCPACKV2_SHORT_BINARY:
+		return 3 + klen + int(hdr[2])
+	default:
+		// fixed size items keep their size in the low bits of the type
+		return 2 + klen + int(typ&0x0f)
+	}
+}
+
+// An Encoder writes mcpack documents to an output stream.
+type Encoder struct {
+	w    io.Writer
+	e    encodeState
+	opts EncoderOptions
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// NewEncoderWithOptions returns an Encoder that writes the protocol version
+// of opts.
+func NewEncoderWithOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	return &Encoder{w: w, opts: opts}
+}
+
+// Encode writes the mcpack encoding of v to the stream. The encoding buffer
+// is reused by the next call.
+func (enc *Encoder) Encode(v interface{}) error {
+	enc.e.off = 0
+	if err := enc.e.marshal(v); err != nil {
+		return err
+	}
+	data, err := enc.opts.convert(enc.e.data[:enc.e.off])
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(data)
+	return err
+}
@@ -0,0 +1,118 @@
+package mcpack
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	in := []interface{}{
+		T{A: true, X: "x", Y: 1},
+		U{Alphabet: "a"},
+		W{S: "long string " + string(bytes.Repeat([]byte("s"), 300)), V: 7},
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range in {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	var (
+		t1 T
+		u1 U
+		w1 W
+	)
+	for i, v := range []interface{}{&t1, &u1, &w1} {
+		if err := dec.Decode(v); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := reflect.ValueOf(v).Elem().Interface(); !reflect.DeepEqual(got, in[i]) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, in[i])
+		}
+	}
+	if err := dec.Decode(&t1); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderScalars(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range []interface{}{int64(-1), true, "s", []byte("b"), 1.5} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dec := NewDecoder(&buf)
+	var (
+		i int64
+		b bool
+		s string
+		p []byte
+		f float64
+	)
+	for _, v := range []interface{}{&i, &b, &s, &p, &f} {
+		if err := dec.Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if i != -1 || !b || s != "s" || string(p) != "b" || f != 1.5 {
+		t.Errorf("got %v %v %q %q %v", i, b, s, p, f)
+	}
+}
+
+func TestDecoderMaxSize(t *testing.T) {
+	data, err := Marshal(W{S: string(bytes.Repeat([]byte("s"), 1000))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SetMaxSize(len(data) - 1)
+	var w W
+	if err := dec.Decode(&w); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.SetMaxSize(len(data))
+	if err := dec.Decode(&w); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	data, err := Marshal(T{X: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 4, len(data) - 1} {
+		var v T
+		if err := NewDecoder(bytes.NewReader(data[:n])).Decode(&v); err != io.ErrUnexpectedEOF {
+			t.Errorf("len %d: got %v, want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+	var v T
+	if err := NewDecoder(bytes.NewReader([]byte{0xff, 0})).Decode(&v); err == nil {
+		t.Error("expected error for invalid type")
+	}
+}
+
+func TestDecoderNoReadAhead(t *testing.T) {
+	data, err := Marshal(T{X: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(append(data, "rest"...))
+	var v T
+	if err := NewDecoder(r).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+		t.Errorf("got %q left in the input, want %q", rest, "rest")
+	}
+}
@@ -0,0 +1,196 @@
+package mcpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errV1Format = errors.New("mcpack: malformed v1 item")
+	errV1Object = errors.New("mcpack: a v1 document must be an object")
+)
+
+// isV1 reports whether data is a v1 pack. The tag alone could be the start
+// of a v2 string item, so the version and the size have to match as well.
+func isV1(data []byte) bool {
+	return len(data) >= MCPACKV1_HEADER_LEN &&
+		string(data[:4]) == MCPACKV1_TAG &&
+		Uint32(data[4:]) == MCPACKV1_VERSION &&
+		uint64(Uint32(data[12:])) == uint64(len(data)-MCPACKV1_HEADER_LEN)
+}
+
+// v1ToV2 converts a v1 pack to the equivalent v2 object, which is then
+// decoded as usual.
+func v1ToV2(data []byte) ([]byte, error) {
+	w := NewWriter()
+	w.BeginObject("")
+	if err := v1Items(w, data[MCPACKV1_HEADER_LEN:], Uint32(data[8:]), false); err != nil {
+		return nil, err
+	}
+	w.End()
+	return w.Bytes()
+}
+
+// v1Items writes the n v1 items of data, which must hold exactly these
+// items, to w.
+func v1Items(w *Writer, data []byte, n uint32, inArray bool) error {
+	for ; n > 0; n-- {
+		if len(data) < MCPACKV1_ITEM_HEADER {
+			return errTruncated
+		}
+		typ := Uint32(data)
+		ksize, csize := uint64(Uint32(data[4:])), uint64(Uint32(data[8:]))
+		data = data[MCPACKV1_ITEM_HEADER:]
+		if uint64(len(data)) < ksize+csize {
+			return errTruncated
+		}
+		key, content := data[:ksize], data[ksize:ksize+csize]
+		data = data[ksize+csize:]
+
+		var k string
+		if ksize > 0 {
+			if key[ksize-1] != 0 {
+				return errV1Format
+			}
+			k = string(key[:ksize-1])
+		}
+		if inArray {
+			k = ""
+		}
+
+		switch {
+		case typ == MCPACKV1_OBJECT || typ == MCPACKV1_ARRAY:
+			if len(content) < 4 {
+				return errV1Format
+			}
+			if typ == MCPACKV1_OBJECT {
+				w.BeginObject(k)
+			} else {
+				w.BeginArray(k)
+			}
+			if err := v1Items(w, content[4:], Uint32(content), typ == MCPACKV1_ARRAY); err != nil {
+				return err
+			}
+			w.End()
+		case typ == MCPACKV1_STRING:
+			if n := len(content); n > 0 && content[n-1] == 0 {
+				content = content[:n-1]
+			}
+			w.String(k, string(content))
+		case typ == MCPACKV1_BINARY:
+			w.Binary(k, content)
+		case typ == MCPACKV1_INT32 && csize == 4:
+			w.Int32(k, Int32(content))
+		case typ == MCPACKV1_UINT32 && csize == 4:
+			w.Uint32(k, Uint32(content))
+		case typ == MCPACKV1_INT64 && csize == 8:
+			w.Int64(k, Int64(content))
+		case typ == MCPACKV1_UINT64 && csize == 8:
+			w.Uint64(k, Uint64(content))
+		default:
+			return fmt.Errorf("mcpack: invalid v1 item type 0x%02x of size %d", typ, csize)
+		}
+	}
+	if len(data) != 0 {
+		return errV1Format
+	}
+	return nil
+}
+
+// v2ToV1 converts a v2 object, as written by Marshal, to a v1 pack. Integers
+// are widened to 32 or 64 bits and null members are left out, since v1 has
+// no null. Items v1 cannot represent, like bools and floats, are an error.
+func v2ToV1(data []byte) ([]byte, error) {
+	r := NewReader(data)
+	t, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != MCPACKV2_OBJECT {
+		return nil, errV1Object
+	}
+	buf := make([]byte, MCPACKV1_HEADER_LEN, MCPACKV1_HEADER_LEN+2*len(data))
+	copy(buf, MCPACKV1_TAG)
+	PutUint32(buf[4:], MCPACKV1_VERSION)
+	buf, n, err := appendV1Items(buf, r, false)
+	if err != nil {
+		return nil, err
+	}
+	PutUint32(buf[8:], n)
+	PutUint32(buf[12:], uint32(len(buf)-MCPACKV1_HEADER_LEN))
+	return buf, nil
+}
+
+// appendV1Items appends the members of the object or array r has just
+// stepped into, up to its end token, and returns how many it appended.
+func appendV1Items(buf []byte, r *Reader, inArray bool) ([]byte, uint32, error) {
+	var n uint32
+	for {
+		t, err := r.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if t.End() {
+			return buf, n, nil
+		}
+
+		var content [8]byte
+		switch t.Type {
+		case MCPACKV2_OBJECT, MCPACKV2_ARRAY:
+			typ := uint32(MCPACKV1_OBJECT)
+			if t.Type == MCPACKV2_ARRAY {
+				typ = MCPACKV1_ARRAY
+			}
+			item := len(buf)
+			buf = appendV1Item(buf, typ, t.Key, content[:4])
+			start := len(buf) - 4
+			var m uint32
+			if buf, m, err = appendV1Items(buf, r, t.Type == MCPACKV2_ARRAY); err != nil {
+				return nil, 0, err
+			}
+			PutUint32(buf[start:], m)
+			PutUint32(buf[item+8:], uint32(len(buf)-start))
+		case MCPACKV2_STRING, MCPACKV2_SHORT_STRING:
+			buf = appendV1Item(buf, MCPACKV1_STRING, t.Key, t.Value)
+		case MCPACKV2_BINARY, MCPACKV2_SHORT_BINARY:
+			buf = appendV1Item(buf, MCPACKV1_BINARY, t.Key, t.Value)
+		case MCPACKV2_INT8, MCPACKV2_INT16, MCPACKV2_INT32:
+			v, _ := t.Int()
+			PutInt32(content[:], int32(v))
+			buf = appendV1Item(buf, MCPACKV1_INT32, t.Key, content[:4])
+		case MCPACKV2_UINT8, MCPACKV2_UINT16, MCPACKV2_UINT32:
+			v, _ := t.Uint()
+			PutUint32(content[:], uint32(v))
+			buf = appendV1Item(buf, MCPACKV1_UINT32, t.Key, content[:4])
+		case MCPACKV2_INT64:
+			buf = appendV1Item(buf, MCPACKV1_INT64, t.Key, t.Value)
+		case MCPACKV2_UINT64:
+			buf = appendV1Item(buf, MCPACKV1_UINT64, t.Key, t.Value)
+		case MCPACKV2_NULL:
+			if !inArray {
+				continue
+			}
+			return nil, 0, errors.New("mcpack: null array element cannot be encoded in v1")
+		default:
+			return nil, 0, fmt.Errorf("mcpack: item %q of type 0x%02x cannot be encoded in v1", t.Key, t.Type)
+		}
+		n++
+	}
+}
+
+// appendV1Item appends an item with key k, without its trailing 0x00, and
+// content.
+func appendV1Item(buf []byte, typ uint32, k, content []byte) []byte {
+	var hdr [MCPACKV1_ITEM_HEADER]byte
+	PutUint32(hdr[:], typ)
+	if len(k) > 0 {
+		PutUint32(hdr[4:], uint32(len(k)+1))
+	}
+	PutUint32(hdr[8:], uint32(len(content)))
+	buf = append(buf, hdr[:]...)
+	if len(k) > 0 {
+		buf = append(buf, k...)
+		buf = append(buf, 0)
+	}
+	return append(buf, content...)
+}
@@ -0,0 +1,144 @@
+package mcpack
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type v1Addr struct {
+	City string `mcpack:"city"`
+}
+
+type v1User struct {
+	Name   string   `mcpack:"name"`
+	ID     int64    `mcpack:"id"`
+	Age    int32    `mcpack:"age"`
+	Level  uint32   `mcpack:"level"`
+	Quota  uint64   `mcpack:"quota"`
+	Avatar []byte   `mcpack:"avatar"`
+	Tags   []string `mcpack:"tags"`
+	Addr   v1Addr   `mcpack:"addr"`
+}
+
+var v1Golden = v1User{
+	Name:   "tom",
+	ID:     -42,
+	Age:    18,
+	Level:  3,
+	Quota:  1 << 40,
+	Avatar: []byte("\x89PNG"),
+	Tags:   []string{"a", "bc"},
+	Addr:   v1Addr{City: "beijing"},
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestV1Golden(t *testing.T) {
+	v1 := readGolden(t, "user_v1.mcpack")
+	v2 := readGolden(t, "user_v2.mcpack")
+
+	for name, data := range map[string][]byte{"v1": v1, "v2": v2} {
+		var u v1User
+		if err := Unmarshal(data, &u); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(u, v1Golden) {
+			t.Errorf("%s: got %+v, want %+v", name, u, v1Golden)
+		}
+
+		// decoded from either version, encoded to both
+		got, err := Marshal(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, v2) {
+			t.Errorf("%s: v2 encoding\n got % x\nwant % x", name, got, v2)
+		}
+		got, err = MarshalWithOptions(u, EncoderOptions{Version: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, v1) {
+			t.Errorf("%s: v1 encoding\n got % x\nwant % x", name, got, v1)
+		}
+	}
+
+	var x interface{}
+	if err := Unmarshal(v1, &x); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := x.(map[string]interface{}); !ok || m["name"] != "tom" || len(m) != 8 {
+		t.Errorf("got %v", x)
+	}
+}
+
+func TestV1Stream(t *testing.T) {
+	var buf bytes.Buffer
+	v1 := NewEncoderWithOptions(&buf, EncoderOptions{Version: 1})
+	v2 := NewEncoder(&buf)
+	for _, enc := range []*Encoder{v1, v2, v1} {
+		if err := enc.Encode(v1Golden); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	for i := 0; i < 3; i++ {
+		var u v1User
+		if err := dec.Decode(&u); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(u, v1Golden) {
+			t.Errorf("#%d: got %+v, want %+v", i, u, v1Golden)
+		}
+	}
+}
+
+func TestV1Errors(t *testing.T) {
+	opts := EncoderOptions{Version: 1}
+	if _, err := MarshalWithOptions(struct{ On bool }{true}, opts); err == nil {
+		t.Error("expected error for a bool in v1")
+	}
+	if _, err := MarshalWithOptions(int64(1), opts); err == nil {
+		t.Error("expected error for a v1 document that is not an object")
+	}
+	if _, err := MarshalWithOptions([]*int{nil}, opts); err == nil {
+		t.Error("expected error for a null array element in v1")
+	}
+	if _, err := MarshalWithOptions(v1Golden, EncoderOptions{Version: 3}); err == nil {
+		t.Error("expected error for version 3")
+	}
+
+	// null members are left out
+	type optional struct {
+		N *int `mcpack:"n"`
+		S string
+	}
+	data, err := MarshalWithOptions(optional{S: "s"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o optional
+	if err := Unmarshal(data, &o); err != nil || o.N != nil || o.S != "s" {
+		t.Errorf("got %+v, %v", o, err)
+	}
+
+	v1 := readGolden(t, "user_v1.mcpack")
+	bad := append([]byte{}, v1...)
+	PutUint32(bad[8:], 9)
+	var u v1User
+	if err := Unmarshal(bad, &u); err == nil {
+		t.Error("expected error for a wrong item count")
+	}
+	if err := Unmarshal(v1[:len(v1)-1], &u); err == nil {
+		t.Error("expected error for a truncated pack")
+	}
+}
@@ -0,0 +1,233 @@
+package mcpack
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errUnbalancedEnd = errors.New("mcpack: End without open object or array")
+	errUnclosed      = errors.New("mcpack: unclosed object or array")
+)
+
+// A Writer builds an mcpack document item by item without reflection.
+// Members of an object need a key, elements of an array must have an empty
+// one. The first error is kept and returned by Bytes.
+//
+//	var w mcpack.Writer
+//	w.BeginObject("")
+//	w.String("name", "foo")
+//	w.BeginArray("ids")
+//	w.Int64("", 1)
+//	w.End()
+//	w.End()
+//	data, err := w.Bytes()
+type Writer struct {
+	e     encodeState
+	stack []container
+	err   error
+}
+
+type container struct {
+	typ           byte
+	vlenpos, vpos int
+	n             int
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Reset discards the written data, keeping the buffer for reuse.
+func (w *Writer) Reset() {
+	w.e.off = 0
+	w.stack = w.stack[:0]
+	w.err = nil
+}
+
+// Bytes returns the document. It refers to the Writer's buffer until the
+// next Reset.
+func (w *Writer) Bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if len(w.stack) > 0 {
+		return nil, errUnclosed
+	}
+	return w.e.data[:w.e.off], nil
+}
+
+// item checks that an item with key k may be written and counts it as a
+// member of the open object or array.
+func (w *Writer) item(k string) bool {
+	if w.err != nil {
+		return false
+	}
+	if len(k) > MCPACKV2_KEY_MAX_LEN {
+		w.err = fmt.Errorf("len(key) exceeds %d", MCPACKV2_KEY_MAX_LEN)
+		return false
+	}
+	if n := len(w.stack); n > 0 {
+		c := &w.stack[n-1]
+		if c.typ == MCPACKV2_OBJECT && k == "" {
+			w.err = errEmptyKey
+			return false
+		}
+		if c.typ == MCPACKV2_ARRAY && k != "" {
+			w.err = fmt.Errorf("mcpack: array element with key %q", k)
+			return false
+		}
+		c.n++
+	}
+	return true
+}
+
+func (w *Writer) begin(typ byte, k string) {
+	if !w.item(k) {
+		return
+	}
+	vlenpos, vpos := w.e.beginContainer(typ, k)
+	w.stack = append(w.stack, container{typ: typ, vlenpos: vlenpos, vpos: vpos})
+}
+
+// BeginObject starts an object, whose members are the items written until
+// the matching End.
+func (w *Writer) BeginObject(k string) {
+	w.begin(MCPACKV2_OBJECT, k)
+}
+
+// BeginArray starts an array, whose elements are the items written until the
+// matching End.
+func (w *Writer) BeginArray(k string) {
+	w.begin(MCPACKV2_ARRAY, k)
+}
+
+// End closes the innermost object or array.
+func (w *Writer) End() {
+	if w.err != nil {
+		return
+	}
+	n := len(w.stack)
+	if n == 0 {
+		w.err = errUnbalancedEnd
+		return
+	}
+	c := w.stack[n-1]
+	w.stack = w.stack[:n-1]
+	w.e.endContainer(c.vlenpos, c.vpos, c.n)
+}
+
+func (w *Writer) Null(k string) {
+	if w.item(k) {
+		w.e.null(k)
+	}
+}
+
+func (w *Writer) Bool(k string, v bool) {
+	if w.item(k) {
+		w.e.bool(k, v)
+	}
+}
+
+func (w *Writer) Int32(k string, v int32) {
+	if w.item(k) {
+		w.e.int32(k, v)
+	}
+}
+
+func (w *Writer) Int64(k string, v int64) {
+	if w.item(k) {
+		w.e.int64(k, v)
+	}
+}
+
+func (w *Writer) Uint32(k string, v uint32) {
+	if w.item(k) {
+		w.e.uint32(k, v)
+	}
+}
+
+func (w *Writer) Uint64(k string, v uint64) {
+	if w.item(k) {
+		w.e.uint64(k, v)
+	}
+}
+
+func (w *Writer) Float32(k string, v float32) {
+	if w.item(k) {
+		w.e.float32(k, v)
+	}
+}
+
+func (w *Writer) Float64(k string, v float64) {
+	if w.item(k) {
+		w.e.float64(k, v)
+	}
+}
+
+// Date writes t as a date, or null for the zero time, as Marshal does.
+func (w *Writer) Date(k string, t time.Time) {
+	if !w.item(k) {
+		return
+	}
+	if t.IsZero() {
+		w.e.null(k)
+		return
+	}
+	if t.Before(minDate) || t.After(maxDate) {
+		w.err = fmt.Errorf("mcpack: time %v out of date range", t)
+		return
+	}
+	w.e.date(k, t)
+}
+
+func (w *Writer) String(k string, v string) {
+	if w.item(k) {
+		w.e.string(k, v)
+	}
+}
+
+func (w *Writer) Binary(k string, v []byte) {
+	if w.item(k) {
+		w.e.binary(k, v)
+	}
+}
+
+// Value writes v with the reflection based encoder used by Marshal, for
+// types the other methods do not cover. Values of unsupported types, such as
+// channels, are not written.
+func (w *Writer) Value(k string, v interface{}) {
+	if !w.item(k) {
+		return
+	}
+	off := w.e.off
+	if err := w.e.marshalItem(k, v); err != nil {
+		w.err = err
+		return
+	}
+	if w.e.off == off && len(w.stack) > 0 {
+		w.stack[len(w.stack)-1].n--
+	}
+}
+
+// Raw writes an encoded item, such as Token.Raw, unchanged, including its
+// key.
+func (w *Writer) Raw(raw []byte) {
+	if w.err != nil {
+		return
+	}
+	t, err := NewReader(raw).item()
+	if err == nil && len(t.Raw) != len(raw) {
+		err = errors.New("mcpack: Raw expects exactly one item")
+	}
+	if err != nil {
+		w.err = err
+		return
+	}
+	if !w.item(string(t.Key)) {
+		return
+	}
+	w.e.resizeIfNeeded(len(raw))
+	w.e.off += copy(w.e.data[w.e.off:], raw)
+}
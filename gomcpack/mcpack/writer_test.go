@@ -0,0 +1,126 @@
+package mcpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	long := strings.Repeat("s", 300)
+	w := NewWriter()
+	w.BeginObject("")
+	w.String("S", long)
+	w.Int32("V", -7)
+	w.End()
+	got, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Marshal(W{S: long, V: -7})
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	w.Reset()
+	w.BeginArray("")
+	w.String("", "b")
+	w.Null("")
+	w.Bool("", true)
+	w.Float64("", 1.5)
+	w.Uint64("", 1<<40)
+	w.End()
+	if got, err = w.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(got)
+	r.Next()
+	tok, _ := r.Next()
+	if b, _ := tok.Bytes(); string(b) != "b" {
+		t.Errorf("got %q, want b", b)
+	}
+	if tok, _ = r.Next(); tok.Type != MCPACKV2_NULL {
+		t.Errorf("got type 0x%02x, want null", tok.Type)
+	}
+	tok, _ = r.Next()
+	if b, err := tok.Bool(); err != nil || !b {
+		t.Errorf("got %v, %v, want true", b, err)
+	}
+	tok, _ = r.Next()
+	if f, err := tok.Float(); err != nil || f != 1.5 {
+		t.Errorf("got %v, %v, want 1.5", f, err)
+	}
+	tok, _ = r.Next()
+	if u, err := tok.Uint(); err != nil || u != 1<<40 {
+		t.Errorf("got %v, %v, want 1<<40", u, err)
+	}
+	if tok, _ = r.Next(); !tok.End() {
+		t.Errorf("got type 0x%02x, want end", tok.Type)
+	}
+}
+
+func TestWriterBinary(t *testing.T) {
+	long := bytes.Repeat([]byte("b"), 300)
+	var w Writer
+	w.BeginArray("")
+	w.Binary("", []byte("b"))
+	w.Binary("", long)
+	w.End()
+	data, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(data)
+	r.Next()
+	for _, want := range [][]byte{[]byte("b"), long} {
+		tok, _ := r.Next()
+		if got, err := tok.Bytes(); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestWriterDate(t *testing.T) {
+	when := time.Unix(1500000000, 1)
+	var w Writer
+	w.BeginObject("")
+	w.Date("When", when)
+	w.Date("Zero", time.Time{})
+	w.End()
+	got, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Marshal(struct{ When, Zero time.Time }{When: when})
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	r := NewReader(got)
+	r.Next()
+	for _, want := range []time.Time{when, {}} {
+		tok, _ := r.Next()
+		if got, err := tok.Time(); err != nil || !got.Equal(want) {
+			t.Errorf("got %v, %v, want %v", got, err, want)
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	tests := []func(w *Writer){
+		func(w *Writer) { w.End() },
+		func(w *Writer) { w.BeginObject("") },
+		func(w *Writer) { w.BeginObject(""); w.Int32("", 1); w.End() },
+		func(w *Writer) { w.BeginArray(""); w.Int32("k", 1); w.End() },
+		func(w *Writer) { w.Int32(strings.Repeat("k", MCPACKV2_KEY_MAX_LEN+1), 1) },
+		func(w *Writer) { w.Raw([]byte{MCPACKV2_INT32, 0, 1}) },
+		func(w *Writer) { w.Date("", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)) },
+	}
+	for i, f := range tests {
+		var w Writer
+		f(&w)
+		if _, err := w.Bytes(); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,891 @@
+// Mcpackgen generates reflection-free mcpack marshalers for struct types.
+// For each type T it writes MarshalMCPACK and UnmarshalMCPACK methods on *T,
+// which mcpack.Marshal and mcpack.Unmarshal pick up through the Marshaler and
+// Unmarshaler interfaces. The generated encoder writes the same bytes as the
+// reflection based one, following the same `mcpack` tags and rules for
+// embedded structs.
+//
+// Usage:
+//
+//	//go:generate go run github.com/go-crt/golib/gomcpack/mcpackgen -type=Request,Response
+//
+// The methods are written to <type>_mcpack.go in the package directory, or to
+// <type>_mcpack_test.go if the first type is declared in a test file.
+// Fields whose types marshal themselves with MarshalMCPACK or MarshalText,
+// or that mcpackgen does not handle, such as interfaces and structs without
+// generated methods, go through the reflection based encoder and decoder.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const mcpackPath = "github.com/go-crt/golib/gomcpack/mcpack"
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; must be set")
+	output    = flag.String("output", "", "output file name; default srcdir/<type>_mcpack.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of mcpackgen:\n")
+	fmt.Fprintf(os.Stderr, "\tmcpackgen -type T [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mcpackgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+	names := strings.Split(*typeNames, ",")
+
+	outputName := *output
+	if outputName == "" {
+		outputName = strings.ToLower(names[0]) + "_mcpack.go"
+	}
+	if !filepath.IsAbs(outputName) && filepath.Dir(outputName) == "." {
+		outputName = filepath.Join(dir, outputName)
+	}
+
+	pkg, testTypes, err := loadPackage(dir, filepath.Base(outputName))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" && testTypes[names[0]] {
+		outputName = strings.TrimSuffix(outputName, ".go") + "_test.go"
+	}
+
+	g := newGenerator(pkg, names)
+	src, err := g.generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatalf("writing output: %s", err)
+	}
+}
+
+// loadPackage type-checks the package in dir, including its in-package test
+// files but not skip, the previous output. Type errors are ignored, since
+// the package may use the methods about to be generated. It also returns the
+// types declared in test files.
+func loadPackage(dir, skip string) (*types.Package, map[string]bool, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := importPath(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	testTypes := map[string]bool{}
+	for _, name := range append(bp.GoFiles, bp.TestGoFiles...) {
+		if name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+		if strings.HasSuffix(name, "_test.go") {
+			for _, obj := range f.Scope.Objects {
+				if obj.Kind == ast.Typ {
+					testTypes[obj.Name] = true
+				}
+			}
+		}
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(path, fset, files, nil)
+	return pkg, testTypes, nil
+}
+
+func importPath(dir string) (string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go list: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	pkg     *types.Package
+	names   []string
+	types   map[*types.TypeName]bool
+	imports map[string]string
+	// qualifier of the mcpack package, empty inside it
+	mc  string
+	tmp int
+}
+
+func newGenerator(pkg *types.Package, names []string) *generator {
+	g := &generator{
+		pkg:     pkg,
+		names:   names,
+		types:   map[*types.TypeName]bool{},
+		imports: map[string]string{},
+		mc:      "mcpack.",
+	}
+	if pkg.Path() == mcpackPath {
+		g.mc = ""
+	} else {
+		g.imports[mcpackPath] = "mcpack"
+	}
+	return g
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate() ([]byte, error) {
+	var structs []*types.Named
+	for _, name := range g.names {
+		obj, ok := g.pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("type %s not found in package %s", name, g.pkg.Path())
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("%s is not a defined non-generic type", name)
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		}
+		g.types[obj] = true
+		structs = append(structs, named)
+	}
+	for _, named := range structs {
+		g.genType(named)
+	}
+
+	body := g.buf.Bytes()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by \"mcpackgen %s\"; DO NOT EDIT.\n\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if len(paths) > 0 {
+		fmt.Fprintf(&out, "import (\n")
+		for _, path := range paths {
+			if name := g.imports[path]; name != filepath.Base(path) {
+				fmt.Fprintf(&out, "\t%s %q\n", name, path)
+			} else {
+				fmt.Fprintf(&out, "\t%q\n", path)
+			}
+		}
+		fmt.Fprintf(&out, ")\n\n")
+	}
+	out.Write(body)
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %v\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+// typeString returns the Go syntax of t in the generated file, recording the
+// imports it needs.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+func (g *generator) newVar(prefix string) string {
+	g.tmp++
+	return prefix + strconv.Itoa(g.tmp)
+}
+
+func (g *generator) genType(named *types.Named) {
+	name := named.Obj().Name()
+	fields := typeFields(named)
+
+	g.printf("// MarshalMCPACK implements %sMarshaler.\n", g.mc)
+	g.printf("func (v *%s) MarshalMCPACK() ([]byte, error) {\n", name)
+	g.printf("var w %sWriter\n", g.mc)
+	g.printf("v.writeMCPACK(&w, \"\")\n")
+	g.printf("return w.Bytes()\n")
+	g.printf("}\n\n")
+
+	g.printf("func (v *%s) writeMCPACK(w *%sWriter, k string) {\n", name, g.mc)
+	g.printf("w.BeginObject(k)\n")
+	for _, f := range fields {
+		x, ptrs := selector(named, f.index)
+		for _, p := range ptrs {
+			g.printf("if %s != nil {\n", p)
+		}
+		if f.omitEmpty {
+			g.printf("if %s {\n", notEmpty(x, f.typ))
+		}
+		g.encode(x, strconv.Quote(f.name), f.typ)
+		if f.omitEmpty {
+			g.printf("}\n")
+		}
+		for range ptrs {
+			g.printf("}\n")
+		}
+	}
+	g.printf("w.End()\n")
+	g.printf("}\n\n")
+
+	fieldsVar := "mcpackFields" + strings.ToUpper(name[:1]) + name[1:]
+	g.printf("var %s = []string{", fieldsVar)
+	for i, f := range fields {
+		if i > 0 {
+			g.printf(", ")
+		}
+		g.printf("%q", f.name)
+	}
+	g.printf("}\n\n")
+
+	g.printf("// UnmarshalMCPACK implements %sUnmarshaler.\n", g.mc)
+	g.printf("func (v *%s) UnmarshalMCPACK(data []byte) error {\n", name)
+	g.printf("return %sUnmarshalWith(data, v.readMCPACK)\n", g.mc)
+	g.printf("}\n\n")
+
+	g.printf("func (v *%s) readMCPACK(r *%sReader, tk %sToken) error {\n", name, g.mc, g.mc)
+	g.printf("if tk.Type == %sMCPACKV2_NULL {\n", g.mc)
+	g.printf("*v = %s{}\n", name)
+	g.printf("return nil\n")
+	g.printf("}\n")
+	g.printf("if _, err := tk.Object(); err != nil {\nreturn err\n}\n")
+	g.printf("for {\n")
+	g.printf("tk, err := r.Next()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("if tk.End() {\nreturn nil\n}\n")
+	g.printf("switch %sFieldIndex(tk.Key, %s) {\n", g.mc, fieldsVar)
+	for i, f := range fields {
+		g.printf("case %d:\n", i)
+		x, ptrs := selector(named, f.index)
+		for _, p := range ptrs {
+			g.printf("if %s == nil {\n%s = new(%s)\n}\n", p.expr, p.expr, g.typeString(p.elem))
+		}
+		g.decode(x, f.typ)
+	}
+	g.printf("default:\n")
+	g.printf("if err := r.Discard(tk); err != nil {\nreturn err\n}\n")
+	g.printf("}\n")
+	g.printf("}\n")
+	g.printf("}\n\n")
+}
+
+// embedPtr is an embedded pointer on the way to a promoted field.
+type embedPtr struct {
+	expr string
+	elem types.Type
+}
+
+func (p embedPtr) String() string {
+	return p.expr
+}
+
+// selector returns the expression of the field at index in v, and the
+// embedded pointers it goes through.
+func selector(t types.Type, index []int) (string, []embedPtr) {
+	x := "v"
+	var ptrs []embedPtr
+	for i, idx := range index {
+		if i > 0 {
+			if p, ok := t.(*types.Pointer); ok {
+				ptrs = append(ptrs, embedPtr{expr: x, elem: p.Elem()})
+				t = p.Elem()
+			}
+		}
+		f := t.Underlying().(*types.Struct).Field(idx)
+		x += "." + f.Name()
+		t = f.Type()
+	}
+	return x, ptrs
+}
+
+// generated reports whether t is one of the types being generated.
+func (g *generator) generated(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && g.types[named.Obj()]
+}
+
+// hasMethod reports whether t or *t has a method called name.
+func hasMethod(t types.Type, name string) bool {
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	ms := types.NewMethodSet(t)
+	for i := 0; i < ms.Len(); i++ {
+		if ms.At(i).Obj().Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isTime reports whether t is time.Time, which is encoded as a date.
+func isTime(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time"
+}
+
+// isTimePtr reports whether t is *time.Time, which is encoded as a date or
+// null although it has the text methods of time.Time.
+func isTimePtr(t types.Type) bool {
+	p, ok := t.(*types.Pointer)
+	return ok && isTime(p.Elem())
+}
+
+func isString(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+// notEmpty returns the condition under which x, of type t, is not empty for
+// omitempty.
+func notEmpty(x string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return x
+		case u.Info()&types.IsString != 0:
+			return "len(" + x + ") != 0"
+		case u.Info()&types.IsNumeric != 0 && u.Info()&types.IsComplex == 0 && u.Kind() != types.Uintptr:
+			return x + " != 0"
+		}
+	case *types.Slice, *types.Map, *types.Array:
+		return "len(" + x + ") != 0"
+	case *types.Pointer, *types.Interface:
+		return x + " != nil"
+	}
+	return "true"
+}
+
+// encode writes the code encoding x, of type t, as the item named by the
+// expression k.
+func (g *generator) encode(x, k string, t types.Type) {
+	if g.generated(t) {
+		g.printf("%s.writeMCPACK(w, %s)\n", x, k)
+		return
+	}
+	if hasMethod(t, "MarshalMCPACK") {
+		g.printf("w.Value(%s, %s)\n", k, addr(x))
+		return
+	}
+	if isTime(t) {
+		g.printf("w.Date(%s, %s)\n", k, x)
+		return
+	}
+	if hasMethod(t, "MarshalText") && !isTimePtr(t) {
+		g.printf("w.Value(%s, %s)\n", k, addr(x))
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool:
+			g.printf("w.Bool(%s, %s)\n", k, convert(x, t, types.Bool))
+		case types.Int, types.Int64:
+			g.printf("w.Int64(%s, %s)\n", k, convert(x, t, types.Int64))
+		case types.Int8, types.Int16, types.Int32:
+			g.printf("w.Int32(%s, %s)\n", k, convert(x, t, types.Int32))
+		case types.Uint, types.Uint64, types.Uintptr:
+			g.printf("w.Uint64(%s, %s)\n", k, convert(x, t, types.Uint64))
+		case types.Uint8, types.Uint16, types.Uint32:
+			g.printf("w.Uint32(%s, %s)\n", k, convert(x, t, types.Uint32))
+		case types.Float32:
+			g.printf("w.Float32(%s, %s)\n", k, convert(x, t, types.Float32))
+		case types.Float64:
+			g.printf("w.Float64(%s, %s)\n", k, convert(x, t, types.Float64))
+		case types.String:
+			g.printf("w.String(%s, %s)\n", k, convert(x, t, types.String))
+		case types.Invalid:
+			g.printf("w.Value(%s, %s)\n", k, addr(x))
+		default:
+			// unsupported by mcpack, not written
+		}
+	case *types.Slice:
+		if types.Identical(u.Elem(), types.Typ[types.Uint8]) {
+			if types.Identical(t, u) {
+				g.printf("w.Binary(%s, %s)\n", k, x)
+			} else {
+				g.printf("w.Binary(%s, []byte(%s))\n", k, x)
+			}
+			return
+		}
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Uint8 {
+			g.printf("w.Value(%s, %s)\n", k, addr(x))
+			return
+		}
+		g.encodeArray(x, k, u.Elem())
+	case *types.Array:
+		g.encodeArray(x, k, u.Elem())
+	case *types.Map:
+		if !isString(u.Key()) {
+			// unsupported by mcpack, not written
+			return
+		}
+		mk, mv := g.newVar("mk"), g.newVar("mv")
+		g.printf("w.BeginObject(%s)\n", k)
+		g.printf("for %s, %s := range %s {\n", mk, mv, x)
+		g.encode(mv, "string("+mk+")", u.Elem())
+		g.printf("}\n")
+		g.printf("w.End()\n")
+	case *types.Pointer:
+		g.printf("if %s == nil {\n", x)
+		g.printf("w.Null(%s)\n", k)
+		g.printf("} else {\n")
+		g.encode("(*"+x+")", k, u.Elem())
+		g.printf("}\n")
+	case *types.Chan, *types.Signature:
+		// unsupported by mcpack, not written
+	default:
+		g.printf("w.Value(%s, %s)\n", k, addr(x))
+	}
+}
+
+func (g *generator) encodeArray(x, k string, elem types.Type) {
+	i := g.newVar("i")
+	g.printf("w.BeginArray(%s)\n", k)
+	g.printf("for %s := range %s {\n", i, x)
+	g.encode(x+"["+i+"]", `""`, elem)
+	g.printf("}\n")
+	g.printf("w.End()\n")
+}
+
+// decode writes the code decoding the token tk into x, of type t.
+func (g *generator) decode(x string, t types.Type) {
+	if g.generated(t) {
+		g.printf("if err := %s.readMCPACK(r, tk); err != nil {\nreturn err\n}\n", x)
+		return
+	}
+	if hasMethod(t, "UnmarshalMCPACK") {
+		g.decodeValue(x)
+		return
+	}
+	if isTime(t) {
+		val := g.newVar("val")
+		g.printf("%s, err := tk.Time()\n", val)
+		g.printf("if err != nil {\nreturn err\n}\n")
+		g.printf("%s = %s\n", x, val)
+		return
+	}
+	if hasMethod(t, "UnmarshalText") && !isTimePtr(t) {
+		g.decodeValue(x)
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		var method string
+		switch info := u.Info(); {
+		case u.Kind() == types.Invalid:
+			g.decodeValue(x)
+			return
+		case info&types.IsBoolean != 0:
+			method = "Bool"
+		case info&types.IsComplex != 0 || u.Kind() == types.UnsafePointer:
+			g.printf("if err := r.Discard(tk); err != nil {\nreturn err\n}\n")
+			return
+		case info&types.IsInteger != 0 && info&types.IsUnsigned != 0:
+			method = "Uint"
+		case info&types.IsInteger != 0:
+			method = "Int"
+		case info&types.IsFloat != 0:
+			method = "Float"
+		case info&types.IsString != 0:
+			method = "Bytes"
+		}
+		g.nullOr(x, t, func() {
+			val := g.newVar("val")
+			g.printf("%s, err := tk.%s()\n", val, method)
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.printf("%s = %s\n", x, g.convertTo(t, val, results[method]))
+		})
+	case *types.Slice:
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Uint8 {
+			if !types.Identical(u.Elem(), types.Typ[types.Uint8]) {
+				g.decodeValue(x)
+				return
+			}
+			g.nullOr(x, t, func() {
+				val := g.newVar("val")
+				g.printf("%s, err := tk.Bytes()\n", val)
+				g.printf("if err != nil {\nreturn err\n}\n")
+				g.printf("%s = %s\n", x, g.convertTo(t, val, types.NewSlice(types.Typ[types.Byte])))
+			})
+			return
+		}
+		g.nullOr(x, t, func() {
+			n, i := g.newVar("n"), g.newVar("i")
+			g.printf("%s, err := tk.Array()\n", n)
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.printf("if %s == 0 || cap(%s) < %s {\n", n, x, n)
+			g.printf("%s = make(%s, %s)\n", x, g.typeString(t), n)
+			g.printf("} else {\n")
+			g.printf("%s = %s[:%s]\n", x, x, n)
+			g.printf("}\n")
+			g.printf("for %s := range %s {\n", i, x)
+			g.printf("tk, err := r.Next()\n")
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.decode(x+"["+i+"]", u.Elem())
+			g.printf("}\n")
+			g.printf("if _, err := r.Next(); err != nil {\nreturn err\n}\n")
+		})
+	case *types.Array:
+		g.nullOr(x, t, func() {
+			n, i := g.newVar("n"), g.newVar("i")
+			g.printf("%s, err := tk.Array()\n", n)
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.printf("for %s := 0; %s < %s; %s++ {\n", i, i, n, i)
+			g.printf("tk, err := r.Next()\n")
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.printf("if %s >= len(%s) {\n", i, x)
+			g.printf("if err := r.Discard(tk); err != nil {\nreturn err\n}\n")
+			g.printf("continue\n")
+			g.printf("}\n")
+			g.decode(x+"["+i+"]", u.Elem())
+			g.printf("}\n")
+			g.printf("for %s := %s; %s < len(%s); %s++ {\n", i, n, i, x, i)
+			g.printf("%s[%s] = %s\n", x, i, g.zero(u.Elem()))
+			g.printf("}\n")
+			g.printf("if _, err := r.Next(); err != nil {\nreturn err\n}\n")
+		})
+	case *types.Map:
+		if !isString(u.Key()) {
+			g.decodeValue(x)
+			return
+		}
+		g.nullOr(x, t, func() {
+			mk, mv := g.newVar("mk"), g.newVar("mv")
+			g.printf("if _, err := tk.Object(); err != nil {\nreturn err\n}\n")
+			g.printf("if %s == nil {\n%s = make(%s)\n}\n", x, x, g.typeString(t))
+			g.printf("for {\n")
+			g.printf("tk, err := r.Next()\n")
+			g.printf("if err != nil {\nreturn err\n}\n")
+			g.printf("if tk.End() {\nbreak\n}\n")
+			g.printf("%s := %s(tk.Key)\n", mk, g.typeString(u.Key()))
+			g.printf("var %s %s\n", mv, g.typeString(u.Elem()))
+			g.decode(mv, u.Elem())
+			g.printf("%s[%s] = %s\n", x, mk, mv)
+			g.printf("}\n")
+		})
+	case *types.Pointer:
+		g.nullOr(x, t, func() {
+			g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, g.typeString(u.Elem()))
+			g.decode("(*"+x+")", u.Elem())
+		})
+	case *types.Chan, *types.Signature:
+		g.printf("if err := r.Discard(tk); err != nil {\nreturn err\n}\n")
+	default:
+		g.decodeValue(x)
+	}
+}
+
+// nullOr writes the code setting x to its zero value for a null item, or
+// decoding it with f otherwise.
+func (g *generator) nullOr(x string, t types.Type, f func()) {
+	g.printf("if tk.Type == %sMCPACKV2_NULL {\n", g.mc)
+	g.printf("%s = %s\n", x, g.zero(t))
+	g.printf("} else {\n")
+	f()
+	g.printf("}\n")
+}
+
+// results are the types returned by the Token methods.
+var results = map[string]types.Type{
+	"Bool":  types.Typ[types.Bool],
+	"Int":   types.Typ[types.Int64],
+	"Uint":  types.Typ[types.Uint64],
+	"Float": types.Typ[types.Float64],
+	"Bytes": types.NewSlice(types.Typ[types.Byte]),
+}
+
+// convert returns x, of type t, converted to the basic type kind.
+func convert(x string, t types.Type, kind types.BasicKind) string {
+	if types.Identical(t, types.Typ[kind]) {
+		return x
+	}
+	return types.Typ[kind].Name() + "(" + x + ")"
+}
+
+// convertTo returns x, of type from, converted to t.
+func (g *generator) convertTo(t types.Type, x string, from types.Type) string {
+	if types.Identical(t, from) {
+		return x
+	}
+	return g.typeString(t) + "(" + x + ")"
+}
+
+// zero returns the zero value of t.
+func (g *generator) zero(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+	case *types.Slice, *types.Map, *types.Pointer, *types.Interface, *types.Chan, *types.Signature:
+		return "nil"
+	case *types.Array, *types.Struct:
+		return g.typeString(t) + "{}"
+	}
+	return "*new(" + g.typeString(t) + ")"
+}
+
+// addr returns the address of x.
+func addr(x string) string {
+	if strings.HasPrefix(x, "(*") && strings.HasSuffix(x, ")") {
+		return x[2 : len(x)-1]
+	}
+	return "&" + x
+}
+
+// decodeValue writes the code decoding tk into x with the reflection based
+// decoder.
+func (g *generator) decodeValue(x string) {
+	g.printf("if err := %sUnmarshal(tk.Raw, %s); err != nil {\nreturn err\n}\n", g.mc, addr(x))
+	g.printf("if err := r.Discard(tk); err != nil {\nreturn err\n}\n")
+}
+
+// field and typeFields follow encode.go in the mcpack package, so that the
+// generated code encodes the same fields in the same order.
+type field struct {
+	name      string
+	tag       bool
+	index     []int
+	typ       types.Type
+	omitEmpty bool
+}
+
+func typeFields(t types.Type) []field {
+	current := []field{}
+	next := []field{{typ: t}}
+
+	count := map[types.Type]int{}
+	nextCount := map[types.Type]int{}
+
+	visited := map[types.Type]bool{}
+
+	var fields []field
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[types.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+
+			st := f.typ.Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				sf := st.Field(i)
+				if !sf.Exported() {
+					continue
+				}
+				tag := reflect.StructTag(st.Tag(i)).Get("mcpack")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				if !isValidTag(name) {
+					name = ""
+				}
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+				ft := sf.Type()
+				if p, ok := ft.(*types.Pointer); ok {
+					ft = p.Elem()
+				}
+
+				_, isStruct := ft.Underlying().(*types.Struct)
+				if name != "" || !sf.Anonymous() || !isStruct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name()
+					}
+					fields = append(fields, field{
+						name:      name,
+						tag:       tagged,
+						index:     index,
+						typ:       sf.Type(),
+						omitEmpty: opts.contains("omitempty"),
+					})
+					if count[f.typ] > 1 {
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, field{name: typeName(ft), index: index, typ: ft})
+				}
+			}
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		x := fields
+		if x[i].name != x[j].name {
+			return x[i].name < x[j].name
+		}
+		if len(x[i].index) != len(x[j].index) {
+			return len(x[i].index) < len(x[j].index)
+		}
+		if x[i].tag != x[j].tag {
+			return x[i].tag
+		}
+		return lessIndex(x[i].index, x[j].index)
+	})
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		fi := fields[i]
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].name != fi.name {
+				break
+			}
+		}
+		if advance == 1 {
+			out = append(out, fi)
+			continue
+		}
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+	fields = out
+	sort.Slice(fields, func(i, j int) bool {
+		return lessIndex(fields[i].index, fields[j].index)
+	})
+	return fields
+}
+
+func typeName(t types.Type) string {
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return ""
+}
+
+func lessIndex(a, b []int) bool {
+	for k, xik := range a {
+		if k >= len(b) {
+			return false
+		}
+		if xik != b[k] {
+			return xik < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func dominantField(fields []field) (field, bool) {
+	length := len(fields[0].index)
+	tagged := -1
+	for i, f := range fields {
+		if len(f.index) > length {
+			fields = fields[:i]
+			break
+		}
+		if f.tag {
+			if tagged >= 0 {
+				return field{}, false
+			}
+			tagged = i
+		}
+	}
+	if tagged >= 0 {
+		return fields[tagged], true
+	}
+	if len(fields) > 1 {
+		return field{}, false
+	}
+	return fields[0], true
+}
+
+type tagOptions string
+
+func parseTag(tag string) (string, tagOptions) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tagOptions(tag[idx+1:])
+	}
+	return tag, tagOptions("")
+}
+
+func (o tagOptions) contains(optionName string) bool {
+	for _, s := range strings.Split(string(o), ",") {
+		if s == optionName {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:<=>?@[]^_{|}~ ", c):
+		default:
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,11 +1,12 @@
 package mcpacknpc
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-crt/golib/gomcpack/mcpack"
 	"github.com/go-crt/golib/gomcpack/npc"
 	"github.com/go-crt/golib/xlog"
-	"io/ioutil"
+	"io"
 	"reflect"
 	"sync"
 	"unicode"
@@ -95,12 +96,23 @@ func (h *Handler) Serve(w npc.ResponseWriter, r *npc.Request) {
 	}
 }
 
+var errTrailingData = errors.New("mcpack: trailing data after request")
+
+// readRequest decodes the body, which must hold exactly one document, as
+// mcpack.Unmarshal of the whole body would.
 func (h *Handler) readRequest(r *npc.Request, arg interface{}) error {
-	content, err := ioutil.ReadAll(r.Body)
-	if err != nil {
+	if err := mcpack.NewDecoder(r.Body).Decode(arg); err != nil {
+		if err == io.EOF {
+			// an empty body is a malformed document, not the end of the stream
+			return mcpack.Unmarshal(nil, arg)
+		}
 		return err
 	}
-	return mcpack.Unmarshal(content, arg)
+	var b [1]byte
+	if n, _ := io.ReadFull(r.Body, b[:]); n > 0 {
+		return errTrailingData
+	}
+	return nil
 }
 
 func (h *Handler) sendResponse(w npc.ResponseWriter, reply interface{}) error {
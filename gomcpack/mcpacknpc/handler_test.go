@@ -1,7 +1,11 @@
 package mcpacknpc
 
 import (
+	"bytes"
+	"github.com/go-crt/golib/gomcpack/mcpack"
+	"github.com/go-crt/golib/gomcpack/npc"
 	"github.com/go-crt/golib/gomcpack/npc/npctest"
+	"io"
 	"testing"
 )
 
@@ -40,6 +44,29 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+func TestHandlerReadRequest(t *testing.T) {
+	handler, err := NewHandler(func(in Ping, out *Pong) error { return nil })
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	ping, err := mcpack.Marshal(Ping{"ping"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var in Ping
+	if err := handler.readRequest(npc.NewRequest(bytes.NewReader(ping)), &in); err != nil || in.Data != "ping" {
+		t.Fatalf("readRequest: %v, %q", err, in.Data)
+	}
+	if err := handler.readRequest(npc.NewRequest(bytes.NewReader(nil)), &in); err == nil || err == io.EOF {
+		t.Errorf("got %v, want an unmarshal error for an empty body", err)
+	}
+	trailing := append(append([]byte{}, ping...), ping...)
+	if err := handler.readRequest(npc.NewRequest(bytes.NewReader(trailing)), &in); err != errTrailingData {
+		t.Errorf("got %v, want errTrailingData", err)
+	}
+}
+
 func BenchmarkClientServer(b *testing.B) {
 	b.ReportAllocs()
 	b.StopTimer()
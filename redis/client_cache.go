@@ -0,0 +1,439 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/gcache"
+	"github.com/go-crt/golib/xlog"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const invalidateChannel = "__redis__:invalidate"
+
+var ErrClientCacheCluster = errors.New("redis client cache: cluster mode is not supported")
+
+type ClientCacheOptions struct {
+	// 本地缓存的最大key数量，默认10000。上限平均分配到各个分桶，达到上限后按LRU淘汰最久未访问的key，
+	// 淘汰的次数见 ClientCacheStats.Evictions
+	MaxEntries int
+	// 本地缓存的最长存活时间，作为失效通知丢失时的兜底，默认1min
+	TTL time.Duration
+	// gcache的分桶数，默认16
+	Shards int
+	// 开启 CLIENT TRACKING 的连接数，默认与 MaxIdle 相同
+	PoolSize int
+	// 失效通知连接探活PING的间隔，超过两个间隔没有任何回复视为断线，默认30s
+	PingInterval time.Duration
+	// 失效通知连接断线重连的最大退避间隔，默认10s
+	MaxBackoff time.Duration
+}
+
+func (o *ClientCacheOptions) checkOptions(pool *redigo.Pool) {
+	if o.MaxEntries == 0 {
+		o.MaxEntries = 10000
+	}
+	if o.TTL == 0 {
+		o.TTL = time.Minute
+	}
+	if o.Shards == 0 {
+		o.Shards = 16
+	}
+	if o.PoolSize == 0 {
+		o.PoolSize = pool.MaxIdle
+	}
+	if o.PingInterval == 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 10 * time.Second
+	}
+}
+
+type ClientCacheStats struct {
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+	// 因达到 MaxEntries 而被淘汰的key数量
+	Evictions int64
+	Entries   int
+}
+
+// ClientCache 基于 CLIENT TRACKING 的本地近端缓存，Get/HGet 的结果缓存在 gcache.BucketCache 中，
+// key在服务端被修改或淘汰时由失效通知删除本地副本。
+// 使用RESP2的重定向模式：一个独占连接订阅 __redis__:invalidate，读命令通过开启了
+// CLIENT TRACKING ON REDIRECT <id> 的专用连接池执行。失效通知连接断开期间不使用本地缓存。
+type ClientCache struct {
+	redis *Redis
+	opts  ClientCacheOptions
+	cache *gcache.BucketCache
+
+	mu    sync.RWMutex
+	pool  *redigo.Pool
+	ready bool
+
+	// 每收到一次失效通知加一，读请求返回前后不一致时不写入本地缓存
+	seq           uint64
+	hits          int64
+	misses        int64
+	invalidations int64
+	evictions     int64
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// clientCacheEntry 一个redis key在本地的副本，hash的各field与key一同失效
+type clientCacheEntry struct {
+	mu     sync.RWMutex
+	value  []byte
+	loaded bool
+	fields map[string][]byte
+}
+
+// NewClientCache 创建本地近端缓存，建立失效通知连接后返回；服务端不支持 CLIENT TRACKING 时返回错误
+func (r *Redis) NewClientCache(opts *ClientCacheOptions) (*ClientCache, error) {
+	if r.cluster != nil {
+		return nil, ErrClientCacheCluster
+	}
+	var o ClientCacheOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.checkOptions(r.pool)
+
+	c := &ClientCache{
+		redis:  r,
+		opts:   o,
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	c.cache = c.newStore(o.TTL)
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// Get 与 Redis.Get 相同，key不存在时返回nil
+func (c *ClientCache) Get(ctx *gin.Context, key string) ([]byte, error) {
+	if e := c.entry(key, false); e != nil {
+		e.mu.RLock()
+		value, loaded := e.value, e.loaded
+		e.mu.RUnlock()
+		if loaded {
+			atomic.AddInt64(&c.hits, 1)
+			return value, nil
+		}
+	}
+	atomic.AddInt64(&c.misses, 1)
+
+	seq := atomic.LoadUint64(&c.seq)
+	res, err := redigo.Bytes(c.do(ctx, "GET", key))
+	if err == redigo.ErrNil {
+		res, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e := c.entry(key, true); e != nil && c.unchanged(seq) {
+		e.mu.Lock()
+		e.value, e.loaded = res, true
+		e.mu.Unlock()
+	}
+	return res, nil
+}
+
+// HGet 与 Redis.HGet 相同，field不存在时返回nil
+func (c *ClientCache) HGet(ctx *gin.Context, key, field string) ([]byte, error) {
+	if e := c.entry(key, false); e != nil {
+		e.mu.RLock()
+		value, ok := e.fields[field]
+		e.mu.RUnlock()
+		if ok {
+			atomic.AddInt64(&c.hits, 1)
+			return value, nil
+		}
+	}
+	atomic.AddInt64(&c.misses, 1)
+
+	seq := atomic.LoadUint64(&c.seq)
+	res, err := redigo.Bytes(c.do(ctx, "HGET", key, field))
+	if err == redigo.ErrNil {
+		res, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e := c.entry(key, true); e != nil && c.unchanged(seq) {
+		e.mu.Lock()
+		if e.fields == nil {
+			e.fields = make(map[string][]byte)
+		}
+		e.fields[field] = res
+		e.mu.Unlock()
+	}
+	return res, nil
+}
+
+func (c *ClientCache) Stats() ClientCacheStats {
+	return ClientCacheStats{
+		Hits:          atomic.LoadInt64(&c.hits),
+		Misses:        atomic.LoadInt64(&c.misses),
+		Invalidations: atomic.LoadInt64(&c.invalidations),
+		Evictions:     atomic.LoadInt64(&c.evictions),
+		Entries:       c.entries(),
+	}
+}
+
+// Close 关闭失效通知连接及专用连接池并清空本地缓存
+func (c *ClientCache) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	<-c.done
+	return nil
+}
+
+// newStore 创建按LRU淘汰、最多 MaxEntries 个key的本地缓存
+func (c *ClientCache) newStore(cleanupInterval time.Duration) *gcache.BucketCache {
+	store := gcache.NewBucketCacheWithOptions(gcache.Options{
+		DefaultExpiration: c.opts.TTL,
+		CleanupInterval:   cleanupInterval,
+		Shards:            c.opts.Shards,
+		MaxEntries:        c.opts.MaxEntries,
+		Policy:            gcache.PolicyLRU,
+	})
+	store.OnEvictedWithReason(func(_ string, _ interface{}, reason gcache.EvictionReason) {
+		if reason == gcache.EvictionCapacity {
+			atomic.AddInt64(&c.evictions, 1)
+		}
+	})
+	return store
+}
+
+// entry 返回key对应的本地副本，create为true时不存在则创建；失效通知连接不可用时返回nil
+func (c *ClientCache) entry(key string, create bool) *clientCacheEntry {
+	c.mu.RLock()
+	ready := c.ready
+	c.mu.RUnlock()
+	if !ready {
+		return nil
+	}
+	if v, ok := c.cache.Get(key); ok {
+		return v.(*clientCacheEntry)
+	}
+	if !create {
+		return nil
+	}
+	e := &clientCacheEntry{}
+	if err := c.cache.Add(key, e, gcache.DefaultExpiration); err != nil {
+		// 并发创建，使用已存在的副本
+		if v, ok := c.cache.Get(key); ok {
+			return v.(*clientCacheEntry)
+		}
+		return nil
+	}
+	return e
+}
+
+func (c *ClientCache) entries() int {
+	n := 0
+	for _, count := range c.cache.ItemsCount() {
+		n += count
+	}
+	return n
+}
+
+// unchanged 读请求期间没有收到任何失效通知，读到的值可以安全写入本地缓存
+func (c *ClientCache) unchanged(seq uint64) bool {
+	return atomic.LoadUint64(&c.seq) == seq
+}
+
+// do 通过开启了tracking的连接执行读命令，失效通知连接不可用时退化为普通请求
+func (c *ClientCache) do(ctx *gin.Context, cmd string, args ...interface{}) (interface{}, error) {
+	c.mu.RLock()
+	pool, ready := c.pool, c.ready
+	c.mu.RUnlock()
+	if !ready {
+		return c.redis.Do(ctx, cmd, args...)
+	}
+
+	start := time.Now()
+	conn := pool.Get()
+	reply, err := conn.Do(cmd, args...)
+	conn.Close()
+	c.redis.logCommand(ctx, start, c.redis.RemoteAddr, cmd, args, err)
+	return reply, err
+}
+
+// invalidate 删除被修改的key，keys为nil表示服务端执行了FLUSHALL/FLUSHDB
+func (c *ClientCache) invalidate(keys []string) {
+	atomic.AddUint64(&c.seq, 1)
+	if keys == nil {
+		c.cache.Flush()
+		atomic.AddInt64(&c.invalidations, 1)
+		return
+	}
+	for _, key := range keys {
+		c.cache.Delete(key)
+	}
+	atomic.AddInt64(&c.invalidations, int64(len(keys)))
+}
+
+// connect 建立失效通知连接并订阅，随后以该连接的id重建开启tracking的连接池
+func (c *ClientCache) connect() (redigo.Conn, error) {
+	conn, err := c.redis.dial()
+	if err != nil {
+		return nil, err
+	}
+	id, err := redigo.Int64(conn.Do("CLIENT", "ID"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err = conn.Do("SUBSCRIBE", invalidateChannel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	pool := &redigo.Pool{
+		MaxIdle:     c.opts.PoolSize,
+		MaxActive:   c.redis.pool.MaxActive,
+		IdleTimeout: c.redis.pool.IdleTimeout,
+		Wait:        true,
+		Dial: func() (redigo.Conn, error) {
+			conn, err := c.redis.dial()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := conn.Do("CLIENT", "TRACKING", "ON", "REDIRECT", id); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+	}
+	// 先验证服务端支持tracking，避免之后每次读请求都失败
+	probe := pool.Get()
+	err = probe.Err()
+	probe.Close()
+	if err != nil {
+		pool.Close()
+		conn.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	old := c.pool
+	c.pool, c.ready = pool, true
+	c.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return conn, nil
+}
+
+// disconnect 失效通知连接断开后无法再保证本地副本有效，清空缓存并停止使用
+func (c *ClientCache) disconnect() {
+	c.mu.Lock()
+	c.ready = false
+	c.mu.Unlock()
+	atomic.AddUint64(&c.seq, 1)
+	c.cache.Flush()
+}
+
+func (c *ClientCache) run(conn redigo.Conn) {
+	defer close(c.done)
+	defer func() {
+		c.disconnect()
+		c.mu.Lock()
+		if c.pool != nil {
+			c.pool.Close()
+		}
+		c.mu.Unlock()
+	}()
+
+	backoff := 100 * time.Millisecond
+	for {
+		stop := make(chan struct{})
+		go c.ping(conn, stop)
+		err := c.serve(conn)
+		close(stop)
+		conn.Close()
+		c.disconnect()
+
+		for {
+			select {
+			case <-c.closed:
+				return
+			default:
+			}
+			xlog.WarnLogger(nil, "redis client cache reconnect: "+err.Error(),
+				xlog.String("prot", "redis"), xlog.String("service", c.redis.Service))
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > c.opts.MaxBackoff {
+				backoff = c.opts.MaxBackoff
+			}
+			if conn, err = c.connect(); err == nil {
+				backoff = 100 * time.Millisecond
+				break
+			}
+		}
+	}
+}
+
+// ping 定期探活，Close时关闭连接使serve返回
+func (c *ClientCache) ping(conn redigo.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			conn.Close()
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			if conn.Send("PING") != nil || conn.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// serve 接收失效通知直到连接出错
+func (c *ClientCache) serve(conn redigo.Conn) error {
+	for {
+		reply, err := redigo.ReceiveWithTimeout(conn, 2*c.opts.PingInterval)
+		if err != nil {
+			return err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 3 {
+			continue
+		}
+		if kind, _ := redigo.String(values[0], nil); kind != "message" {
+			continue
+		}
+		if values[2] == nil {
+			c.invalidate(nil)
+			continue
+		}
+		keys, err := redigo.Strings(values[2], nil)
+		if err != nil {
+			continue
+		}
+		c.invalidate(keys)
+	}
+}
@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClientCache 跳过失效通知连接，直接使用普通连接池，用于不支持 CLIENT TRACKING 的测试环境
+func newTestClientCache(maxEntries int) *ClientCache {
+	opts := ClientCacheOptions{MaxEntries: maxEntries, Shards: 1}
+	opts.checkOptions(r.pool)
+	c := &ClientCache{
+		redis: r,
+		opts:  opts,
+		pool:  r.pool,
+		ready: true,
+	}
+	c.cache = c.newStore(0)
+	return c
+}
+
+func TestClientCache_GetInvalidate(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key, hkey := "TestClientCache_Get", "TestClientCache_HGet"
+	_, _ = r.Del(ctx, key, hkey)
+	_, _ = r.Do(ctx, "SET", key, "v1")
+	_, _ = r.Do(ctx, "HSET", hkey, "f", "h1")
+
+	c := newTestClientCache(0)
+	v, err := c.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	v, err = c.HGet(ctx, hkey, "f")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("h1"), v)
+
+	// 服务端修改后，未收到失效通知前仍命中本地缓存
+	_, _ = r.Do(ctx, "SET", key, "v2")
+	_, _ = r.Do(ctx, "HSET", hkey, "f", "h2")
+	v, _ = c.Get(ctx, key)
+	assert.Equal(t, []byte("v1"), v)
+	v, _ = c.HGet(ctx, hkey, "f")
+	assert.Equal(t, []byte("h1"), v)
+
+	c.invalidate([]string{key})
+	v, _ = c.Get(ctx, key)
+	assert.Equal(t, []byte("v2"), v)
+	c.invalidate(nil)
+	v, _ = c.HGet(ctx, hkey, "f")
+	assert.Equal(t, []byte("h2"), v)
+
+	// 不存在的key同样被缓存
+	v, err = c.Get(ctx, "TestClientCache_None")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	_, _ = c.Get(ctx, "TestClientCache_None")
+
+	stats := c.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(5), stats.Misses)
+	assert.Equal(t, int64(2), stats.Invalidations)
+	assert.Equal(t, 2, stats.Entries)
+
+	_, _ = r.Del(ctx, key, hkey)
+}
+
+func TestClientCache_MaxEntries(t *testing.T) {
+	setup()
+	c := newTestClientCache(2)
+	prefix := "TestClientCache_MaxEntries_"
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, err := c.Get(nil, prefix+key)
+		assert.NoError(t, err)
+	}
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(1), stats.Evictions)
+
+	// 淘汰最久未访问的b，新的key c 仍然被缓存
+	assert.Nil(t, c.entry(prefix+"b", false))
+	assert.NotNil(t, c.entry(prefix+"a", false))
+	assert.NotNil(t, c.entry(prefix+"c", false))
+}
+
+func TestClientCache_StaleRead(t *testing.T) {
+	setup()
+	c := newTestClientCache(0)
+	seq := c.seq
+	c.invalidate([]string{"x"})
+	assert.False(t, c.unchanged(seq))
+
+	// 断线后不再使用本地缓存
+	c.disconnect()
+	assert.Nil(t, c.entry("x", true))
+}
+
+func TestRedis_NewClientCache(t *testing.T) {
+	setup()
+	c, err := r.NewClientCache(&ClientCacheOptions{PingInterval: time.Second})
+	if err != nil {
+		t.Skip("server does not support CLIENT TRACKING: " + err.Error())
+	}
+	defer c.Close()
+
+	key := "TestRedis_NewClientCache"
+	_, _ = r.Do(nil, "SET", key, "v1")
+	v, _ := c.Get(nil, key)
+	assert.Equal(t, []byte("v1"), v)
+	_, _ = r.Do(nil, "SET", key, "v2")
+	assert.Eventually(t, func() bool {
+		v, _ := c.Get(nil, key)
+		return string(v) == "v2"
+	}, time.Second, 10*time.Millisecond)
+	_, _ = r.Del(nil, key)
+}
+
+// trackingServer 模拟支持 CLIENT TRACKING 的服务端，invalidations 中的回复由订阅连接依次收到
+type trackingServer struct {
+	mu        sync.Mutex
+	data      map[string]string
+	redirects []interface{}
+
+	invalidations chan interface{}
+}
+
+func (s *trackingServer) dial() (redigo.Conn, error) {
+	return &trackingConn{server: s, closed: make(chan struct{})}, nil
+}
+
+func (s *trackingServer) set(key, value string) {
+	s.mu.Lock()
+	s.data[key] = value
+	s.mu.Unlock()
+}
+
+type trackingConn struct {
+	server *trackingServer
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *trackingConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *trackingConn) Err() error {
+	return nil
+}
+
+func (c *trackingConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch cmd {
+	case "CLIENT":
+		if args[0] == "ID" {
+			return int64(7), nil
+		}
+		s.redirects = append(s.redirects, args[3])
+		return "OK", nil
+	case "SUBSCRIBE":
+		return []interface{}{[]byte("subscribe"), []byte(args[0].(string)), int64(1)}, nil
+	case "GET":
+		if v, ok := s.data[args[0].(string)]; ok {
+			return []byte(v), nil
+		}
+		return nil, nil
+	}
+	return nil, errors.New("unexpected command " + cmd)
+}
+
+func (c *trackingConn) Send(cmd string, args ...interface{}) error {
+	return nil
+}
+
+func (c *trackingConn) Flush() error {
+	return nil
+}
+
+func (c *trackingConn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+func (c *trackingConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	select {
+	case reply := <-c.server.invalidations:
+		return reply, nil
+	case <-c.closed:
+		return nil, errors.New("use of closed connection")
+	}
+}
+
+func (c *trackingConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return c.Do(cmd, args...)
+}
+
+func TestClientCache_Tracking(t *testing.T) {
+	server := &trackingServer{
+		data:          map[string]string{"a": "a1", "b": "b1"},
+		invalidations: make(chan interface{}),
+	}
+	fake := &Redis{
+		Service: "tracking",
+		dial:    server.dial,
+		pool:    &redigo.Pool{MaxIdle: 2, Dial: server.dial},
+	}
+	c, err := fake.NewClientCache(&ClientCacheOptions{PingInterval: time.Second})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	v, err := c.Get(nil, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a1"), v)
+	_, _ = c.Get(nil, "b")
+	// 读命令所用的连接重定向到订阅连接的id
+	server.mu.Lock()
+	assert.Equal(t, []interface{}{int64(7)}, server.redirects)
+	server.mu.Unlock()
+
+	server.set("a", "a2")
+	server.set("b", "b2")
+	v, _ = c.Get(nil, "a")
+	assert.Equal(t, []byte("a1"), v)
+
+	// 失效通知经订阅连接到达后删除本地副本
+	server.invalidations <- []interface{}{[]byte("message"), []byte(invalidateChannel), []interface{}{[]byte("a")}}
+	assert.Eventually(t, func() bool {
+		v, _ := c.Get(nil, "a")
+		return string(v) == "a2"
+	}, time.Second, 10*time.Millisecond)
+	v, _ = c.Get(nil, "b")
+	assert.Equal(t, []byte("b1"), v)
+
+	// 订阅确认等其他回复被忽略，nil表示FLUSHALL/FLUSHDB
+	server.invalidations <- []interface{}{[]byte("subscribe"), []byte(invalidateChannel), int64(1)}
+	server.invalidations <- []interface{}{[]byte("message"), []byte(invalidateChannel), nil}
+	assert.Eventually(t, func() bool {
+		v, _ := c.Get(nil, "b")
+		return string(v) == "b2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(2), c.Stats().Invalidations)
+}
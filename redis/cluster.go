@@ -0,0 +1,491 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const (
+	// redis集群固定的slot数量
+	clusterSlots = 16384
+	// 单条命令最多跟随的MOVED/ASK重定向次数
+	clusterMaxRedirects = 16
+)
+
+var (
+	ErrCrossSlot         = errors.New("redis cluster: keys in request don't hash to the same slot")
+	ErrClusterNoNode     = errors.New("redis cluster: no node available")
+	ErrClusterRedirected = errors.New("redis cluster: too many redirects")
+)
+
+// cluster 维护slot到节点的映射以及每个节点的连接池
+type cluster struct {
+	conf RedisConf
+
+	mu    sync.RWMutex
+	slots []string
+	pools map[string]*redigo.Pool
+
+	refreshing int32
+}
+
+func newCluster(conf RedisConf) *cluster {
+	return &cluster{
+		conf:  conf,
+		slots: make([]string, clusterSlots),
+		pools: make(map[string]*redigo.Pool),
+	}
+}
+
+// refresh 依次向已知节点发送 CLUSTER SLOTS，用第一个成功的结果重建slot映射
+func (c *cluster) refresh() error {
+	var lastErr error = ErrClusterNoNode
+	for _, addr := range c.knownAddrs() {
+		slots, err := c.fetchSlots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.applySlots(slots)
+		return nil
+	}
+	return lastErr
+}
+
+// refreshAsync 在后台刷新slot映射，同一时刻只会有一个刷新在执行
+func (c *cluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		_ = c.refresh()
+	}()
+}
+
+func (c *cluster) knownAddrs() []string {
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, addr := range c.conf.ClusterAddrs {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mu.RLock()
+	for addr := range c.pools {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mu.RUnlock()
+	return addrs
+}
+
+func (c *cluster) fetchSlots(addr string) ([]string, error) {
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+
+	values, err := redigo.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	slots := make([]string, clusterSlots)
+	for _, v := range values {
+		item, err := redigo.Values(v, nil)
+		if err != nil || len(item) < 3 {
+			return nil, fmt.Errorf("redis cluster: unexpected CLUSTER SLOTS reply from %s", addr)
+		}
+		start, err1 := redigo.Int(item[0], nil)
+		end, err2 := redigo.Int(item[1], nil)
+		master, err3 := redigo.Values(item[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(master) < 2 ||
+			start < 0 || end >= clusterSlots || start > end {
+			return nil, fmt.Errorf("redis cluster: unexpected CLUSTER SLOTS reply from %s", addr)
+		}
+		ip, _ := redigo.String(master[0], nil)
+		port, _ := redigo.Int(master[1], nil)
+		if ip == "" {
+			// 节点未配置 cluster-announce-ip 时返回空ip，表示与被查询节点相同
+			ip = host
+		}
+		nodeAddr := net.JoinHostPort(ip, strconv.Itoa(port))
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = nodeAddr
+		}
+	}
+	return slots, nil
+}
+
+func (c *cluster) applySlots(slots []string) {
+	nodes := make(map[string]bool)
+	for _, addr := range slots {
+		if addr != "" {
+			nodes[addr] = true
+		}
+	}
+
+	c.mu.Lock()
+	c.slots = slots
+	var stale []*redigo.Pool
+	for addr, p := range c.pools {
+		if !nodes[addr] && !c.isSeed(addr) {
+			stale = append(stale, p)
+			delete(c.pools, addr)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, p := range stale {
+		_ = p.Close()
+	}
+}
+
+func (c *cluster) isSeed(addr string) bool {
+	for _, seed := range c.conf.ClusterAddrs {
+		if seed == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// pool 返回节点对应的连接池，不存在时按RedisConf创建
+func (c *cluster) pool(addr string) *redigo.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok = c.pools[addr]; !ok {
+		p = newPool(c.conf, dialAddr(c.conf, addr))
+		c.pools[addr] = p
+	}
+	return p
+}
+
+func (c *cluster) slotAddr(slot int) string {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr != "" {
+		return addr
+	}
+	return c.randomAddr()
+}
+
+func (c *cluster) setSlot(slot int, addr string) {
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+}
+
+func (c *cluster) randomAddr() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, addr := range c.slots {
+		if addr != "" {
+			return addr
+		}
+	}
+	if len(c.conf.ClusterAddrs) > 0 {
+		return c.conf.ClusterAddrs[0]
+	}
+	return ""
+}
+
+// getConn 返回key所在节点的连接，key为空时返回任意节点的连接
+func (c *cluster) getConn(key string) (string, redigo.Conn) {
+	var addr string
+	if key == "" {
+		addr = c.randomAddr()
+	} else {
+		addr = c.slotAddr(keySlot(key))
+	}
+	return addr, c.pool(addr).Get()
+}
+
+// do 根据命令中的key计算slot并发送到对应节点
+// 跨slot的 MGET/MSET/DEL/EXISTS/UNLINK/TOUCH 会按slot拆分后合并结果，其余跨slot命令返回 ErrCrossSlot
+func (c *cluster) do(timeout time.Duration, cmd string, args ...interface{}) (string, interface{}, error) {
+	keys := commandKeys(cmd, args)
+	if len(keys) == 0 {
+		return c.doAddr(c.randomAddr(), -1, timeout, cmd, args)
+	}
+
+	slot := keySlot(keys[0])
+	for _, key := range keys[1:] {
+		if keySlot(key) != slot {
+			if _, ok := clusterSplitCommands[strings.ToUpper(cmd)]; ok {
+				return c.doSplit(cmd, args)
+			}
+			return "", nil, ErrCrossSlot
+		}
+	}
+	return c.doAddr(c.slotAddr(slot), slot, timeout, cmd, args)
+}
+
+func (c *cluster) doAddr(addr string, slot int, timeout time.Duration, cmd string, args []interface{}) (string, interface{}, error) {
+	if addr == "" {
+		return "", nil, ErrClusterNoNode
+	}
+
+	asking := false
+	for i := 0; i <= clusterMaxRedirects; i++ {
+		conn := c.pool(addr).Get()
+		if asking {
+			_, _ = conn.Do("ASKING")
+		}
+		var reply interface{}
+		var err error
+		if timeout > 0 {
+			reply, err = redigo.DoWithTimeout(conn, timeout, cmd, args...)
+		} else {
+			reply, err = conn.Do(cmd, args...)
+		}
+		_ = conn.Close()
+
+		if err == nil {
+			return addr, reply, nil
+		}
+		if _, ok := err.(redigo.Error); !ok {
+			// 网络错误可能是节点下线导致，刷新slot映射以便后续请求路由到新节点
+			c.refreshAsync()
+			return addr, reply, err
+		}
+
+		moved, ask, target := parseRedirect(err)
+		if !moved && !ask {
+			return addr, reply, err
+		}
+		if moved {
+			if slot >= 0 {
+				c.setSlot(slot, target)
+			}
+			c.refreshAsync()
+		}
+		addr, asking = target, ask
+	}
+	return addr, nil, ErrClusterRedirected
+}
+
+var clusterSplitCommands = map[string]struct{}{
+	"MGET":   {},
+	"MSET":   {},
+	"DEL":    {},
+	"EXISTS": {},
+	"UNLINK": {},
+	"TOUCH":  {},
+}
+
+// doSplit 将跨slot的多key命令按slot拆分执行并合并结果
+func (c *cluster) doSplit(cmd string, args []interface{}) (string, interface{}, error) {
+	cmd = strings.ToUpper(cmd)
+	step := 1
+	if cmd == "MSET" {
+		step = 2
+	}
+
+	var order []int
+	groups := make(map[int][]int)
+	for i := 0; i+step <= len(args); i += step {
+		slot := keySlot(argString(args[i]))
+		if _, ok := groups[slot]; !ok {
+			order = append(order, slot)
+		}
+		groups[slot] = append(groups[slot], i)
+	}
+
+	var addrs []string
+	var sum int64
+	values := make([]interface{}, len(args))
+	for _, slot := range order {
+		idx := groups[slot]
+		sub := make([]interface{}, 0, len(idx)*step)
+		for _, i := range idx {
+			sub = append(sub, args[i:i+step]...)
+		}
+		addr, reply, err := c.doAddr(c.slotAddr(slot), slot, 0, cmd, sub)
+		addrs = append(addrs, addr)
+		if err != nil {
+			return strings.Join(addrs, ","), nil, err
+		}
+		switch cmd {
+		case "MGET":
+			items, err := redigo.Values(reply, nil)
+			if err != nil || len(items) != len(idx) {
+				return strings.Join(addrs, ","), nil, fmt.Errorf("redis cluster: unexpected MGET reply from %s", addr)
+			}
+			for j, i := range idx {
+				values[i] = items[j]
+			}
+		case "MSET":
+		default:
+			n, err := redigo.Int64(reply, nil)
+			if err != nil {
+				return strings.Join(addrs, ","), nil, err
+			}
+			sum += n
+		}
+	}
+
+	switch cmd {
+	case "MGET":
+		return strings.Join(addrs, ","), values, nil
+	case "MSET":
+		return strings.Join(addrs, ","), "OK", nil
+	default:
+		return strings.Join(addrs, ","), sum, nil
+	}
+}
+
+func (c *cluster) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for addr, p := range c.pools {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.pools, addr)
+	}
+	return err
+}
+
+func (c *cluster) stats() redigo.PoolStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var stats redigo.PoolStats
+	for _, p := range c.pools {
+		s := p.Stats()
+		stats.ActiveCount += s.ActiveCount
+		stats.IdleCount += s.IdleCount
+	}
+	return stats
+}
+
+// parseRedirect 解析 "MOVED 3999 127.0.0.1:6381" 或 "ASK 3999 127.0.0.1:6381"
+func parseRedirect(err error) (moved, ask bool, addr string) {
+	parts := strings.Fields(err.Error())
+	if len(parts) != 3 {
+		return false, false, ""
+	}
+	switch parts[0] {
+	case "MOVED":
+		return true, false, parts[2]
+	case "ASK":
+		return false, true, parts[2]
+	}
+	return false, false, ""
+}
+
+// commandKeys 返回命令中所有的key，用于计算slot；不含key的命令返回nil
+func commandKeys(cmd string, args []interface{}) []string {
+	switch strings.ToUpper(cmd) {
+	case "PING", "ECHO", "INFO", "TIME", "DBSIZE", "RANDOMKEY", "KEYS", "SCAN",
+		"FLUSHDB", "FLUSHALL", "SCRIPT", "CLUSTER", "PUBLISH", "CLIENT", "CONFIG", "COMMAND":
+		return nil
+	case "DEL", "EXISTS", "UNLINK", "TOUCH", "MGET", "WATCH", "RENAME", "RENAMENX",
+		"SINTER", "SUNION", "SDIFF", "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE",
+		"PFCOUNT", "PFMERGE", "RPOPLPUSH":
+		return argStrings(args, 0, len(args), 1)
+	case "SMOVE", "LMOVE", "BRPOPLPUSH", "BLMOVE":
+		return argStrings(args, 0, 2, 1)
+	case "MSET", "MSETNX":
+		return argStrings(args, 0, len(args), 2)
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX":
+		return argStrings(args, 0, len(args)-1, 1)
+	case "ZUNIONSTORE", "ZINTERSTORE":
+		if len(args) < 2 {
+			return argStrings(args, 0, len(args), 1)
+		}
+		n, _ := strconv.Atoi(argString(args[1]))
+		return append(argStrings(args, 0, 1, 1), argStrings(args, 2, 2+n, 1)...)
+	case "EVAL", "EVALSHA":
+		if len(args) < 2 {
+			return nil
+		}
+		n, _ := strconv.Atoi(argString(args[1]))
+		return argStrings(args, 2, 2+n, 1)
+	case "XREAD", "XREADGROUP":
+		for i, arg := range args {
+			if strings.ToUpper(argString(arg)) == "STREAMS" {
+				rest := len(args) - i - 1
+				return argStrings(args, i+1, i+1+rest/2, 1)
+			}
+		}
+		return nil
+	}
+	return argStrings(args, 0, 1, 1)
+}
+
+func argStrings(args []interface{}, from, to, step int) []string {
+	if to > len(args) {
+		to = len(args)
+	}
+	var keys []string
+	for i := from; i < to; i += step {
+		keys = append(keys, argString(args[i]))
+	}
+	return keys
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// keySlot 计算key所属的slot，key中包含非空的 {hashtag} 时只对hashtag部分计算
+func keySlot(key string) int {
+	if tag := hashTag(key); tag != "" {
+		key = tag
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// hashTag 返回key中第一个非空的 {hashtag}，不存在时返回空串
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return ""
+}
+
+// crc16 CRC16-XMODEM，与redis集群规范一致
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{key: "123456789", slot: 0x31C3},
+		{key: "foo", slot: 12182},
+		{key: "bar", slot: 5061},
+		{key: "{user1000}.following", slot: 3443}, // CRC16("user1000")
+		{key: "{user1000}.followers", slot: 3443},
+		{key: "foo{}{bar}", slot: 8363},    // 第一个{}为空，整个key参与计算
+		{key: "foo{{bar}}zap", slot: 4015}, // CRC16("{bar")
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.slot, keySlot(tt.key))
+		})
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		args []interface{}
+		keys []string
+	}{
+		{name: "ping", cmd: "PING", args: nil, keys: nil},
+		{name: "get", cmd: "get", args: []interface{}{"k1"}, keys: []string{"k1"}},
+		{name: "hset", cmd: "HSET", args: []interface{}{"k1", "f", "v"}, keys: []string{"k1"}},
+		{name: "mget", cmd: "MGET", args: []interface{}{"k1", "k2"}, keys: []string{"k1", "k2"}},
+		{name: "mset", cmd: "MSET", args: []interface{}{"k1", 1, "k2", 2}, keys: []string{"k1", "k2"}},
+		{name: "blpop", cmd: "BLPOP", args: []interface{}{"k1", "k2", 10}, keys: []string{"k1", "k2"}},
+		{name: "zunionstore", cmd: "ZUNIONSTORE", args: []interface{}{"d", 2, "k1", "k2", "WEIGHTS", 1, 2}, keys: []string{"d", "k1", "k2"}},
+		{name: "eval", cmd: "EVAL", args: []interface{}{"return 1", 1, "k1", "a1"}, keys: []string{"k1"}},
+		{name: "xread", cmd: "XREAD", args: []interface{}{"COUNT", 1, "STREAMS", "s1", "s2", "0", "0"}, keys: []string{"s1", "s2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.keys, commandKeys(tt.cmd, tt.args))
+		})
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	moved, ask, addr := parseRedirect(errors.New("MOVED 3999 127.0.0.1:6381"))
+	assert.True(t, moved)
+	assert.False(t, ask)
+	assert.Equal(t, "127.0.0.1:6381", addr)
+
+	moved, ask, addr = parseRedirect(errors.New("ASK 3999 127.0.0.1:6382"))
+	assert.False(t, moved)
+	assert.True(t, ask)
+	assert.Equal(t, "127.0.0.1:6382", addr)
+
+	moved, ask, _ = parseRedirect(errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	assert.False(t, moved)
+	assert.False(t, ask)
+}
@@ -0,0 +1,299 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// hashField 结构体中映射到hash field的字段
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var hashFieldsCache sync.Map // map[reflect.Type][]hashField
+
+// HGetAllMap 以 map[string]string 的形式返回hash的所有field和value，key不存在时返回空map
+func (r *Redis) HGetAllMap(ctx *gin.Context, key string) (map[string]string, error) {
+	res, err := redis.StringMap(r.Do(ctx, "HGETALL", key))
+	if err == redis.ErrNil {
+		return map[string]string{}, nil
+	}
+	return res, err
+}
+
+// HMGetMap 以 map[string]string 的形式返回指定field的值，不存在的field不会出现在结果中
+func (r *Redis) HMGetMap(ctx *gin.Context, key string, fields ...string) (map[string]string, error) {
+	values, err := r.HMGet(ctx, key, fields...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(fields))
+	for i, v := range values {
+		if v != nil && i < len(fields) {
+			res[fields[i]] = string(v)
+		}
+	}
+	return res, nil
+}
+
+// HGetAllInto 读取hash的所有field并按 `redis:"field"` tag 写入dst指向的结构体
+// 没有tag的字段使用字段名，tag为"-"的字段忽略；key不存在时dst保持不变
+func (r *Redis) HGetAllInto(ctx *gin.Context, key string, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || indirectValue(v).Kind() != reflect.Struct {
+		return errors.New("dst must be a non-nil pointer to struct")
+	}
+
+	values, err := r.HGetAllMap(ctx, key)
+	if err != nil {
+		return err
+	}
+	return scanHash(values, indirectValue(v))
+}
+
+// HSetStruct 将结构体按 `redis:"field,omitempty"` tag 写入hash，嵌套的结构体、map、slice以JSON存储
+// 值为nil的指针字段不写入，读取时保持为nil
+func (r *Redis) HSetStruct(ctx *gin.Context, key string, src interface{}) error {
+	v := indirectValue(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return errors.New("src must be a struct or pointer to struct")
+	}
+
+	args := packArgs(key)
+	for _, f := range cachedHashFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (fv.Kind() == reflect.Ptr && fv.IsNil()) || (f.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		str, err := formatHashValue(fv)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+		args = append(args, f.name, str)
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	_, err := redis.Int64(r.Do(ctx, "HSET", args...))
+	return err
+}
+
+func scanHash(values map[string]string, v reflect.Value) error {
+	for _, f := range cachedHashFields(v.Type()) {
+		str, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		fv := v
+		for _, i := range f.index {
+			fv = indirectAlloc(fv).Field(i)
+		}
+		if err := parseHashValue(str, fv); err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+func cachedHashFields(t reflect.Type) []hashField {
+	if f, ok := hashFieldsCache.Load(t); ok {
+		return f.([]hashField)
+	}
+	f, _ := hashFieldsCache.LoadOrStore(t, deepHashFields(t, nil))
+	return f.([]hashField)
+}
+
+// deepHashFields 展开匿名嵌入的结构体，与 utils.Copy 中 deepFields 的处理方式一致
+func deepHashFields(t reflect.Type, index []int) []hashField {
+	var fields []hashField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+
+		name, opts := tag, ""
+		if n := strings.IndexByte(tag, ','); n >= 0 {
+			name, opts = tag[:n], tag[n+1:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			// 与 encoding/json 一致，忽略未导出的嵌入指针：读取时无法为其分配内存
+			if sf.Anonymous && sf.PkgPath != "" {
+				continue
+			}
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, deepHashFields(ft, idx)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, hashField{
+			name:      name,
+			index:     idx,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+func formatHashValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+
+	b, err := jsoniter.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func parseHashValue(str string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return parseHashTime(str, v)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(str, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(str, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(str))
+			return nil
+		}
+		return jsoniter.UnmarshalFromString(str, v.Addr().Interface())
+	default:
+		return jsoniter.UnmarshalFromString(str, v.Addr().Interface())
+	}
+	return nil
+}
+
+// parseHashTime 支持RFC3339格式及秒级时间戳
+func parseHashTime(str string, v reflect.Value) error {
+	if str == "" {
+		v.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	sec, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", str)
+	}
+	v.Set(reflect.ValueOf(time.Unix(sec, 0)))
+	return nil
+}
+
+// fieldByIndex 与 reflect.Value.FieldByIndex 相同，但遇到nil的嵌入指针时返回false而不是panic
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirectAlloc 解引用指针，遇到nil指针时分配新值
+func indirectAlloc(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
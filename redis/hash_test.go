@@ -203,3 +203,143 @@ func TestRedis_HScan(t *testing.T) {
 		assert.Equal(t, v, string(fields[k]))
 	}
 }
+
+type hashBase struct {
+	ID int64 `redis:"id"`
+}
+
+type hashProfile struct {
+	City string   `json:"city"`
+	Tags []string `json:"tags"`
+}
+
+type hashUser struct {
+	hashBase
+	Name      string            `redis:"name"`
+	Age       int               `redis:"age"`
+	Score     float64           `redis:"score"`
+	Vip       bool              `redis:"vip"`
+	CreatedAt time.Time         `redis:"created_at"`
+	Profile   hashProfile       `redis:"profile"`
+	Extra     map[string]string `redis:"extra,omitempty"`
+	Nick      *string           `redis:"nick"`
+	Ignored   string            `redis:"-"`
+	Raw       string
+}
+
+func TestRedis_HSetStructHGetAllInto(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestRedis_HSetStructHGetAllInto"
+	_, _ = r.Del(ctx, key)
+
+	nick := "tom"
+	src := hashUser{
+		hashBase:  hashBase{ID: 42},
+		Name:      "Tom",
+		Age:       18,
+		Score:     99.5,
+		Vip:       true,
+		CreatedAt: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+		Profile:   hashProfile{City: "beijing", Tags: []string{"a", "b"}},
+		Nick:      &nick,
+		Ignored:   "ignored",
+		Raw:       "raw",
+	}
+	assert.NoError(t, r.HSetStruct(ctx, key, &src))
+
+	m, err := r.HGetAllMap(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"id":         "42",
+		"name":       "Tom",
+		"age":        "18",
+		"score":      "99.5",
+		"vip":        "1",
+		"created_at": "2022-01-02T03:04:05Z",
+		"profile":    `{"city":"beijing","tags":["a","b"]}`,
+		"nick":       "tom",
+		"Raw":        "raw",
+	}, m)
+
+	var dst hashUser
+	assert.NoError(t, r.HGetAllInto(ctx, key, &dst))
+	src.Ignored = ""
+	assert.Equal(t, src, dst)
+
+	m, err = r.HMGetMap(ctx, key, "name", "age", "not_exists")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "Tom", "age": "18"}, m)
+
+	// key不存在时dst保持不变
+	_, _ = r.Del(ctx, key)
+	assert.NoError(t, r.HGetAllInto(ctx, key, &dst))
+	assert.Equal(t, "Tom", dst.Name)
+	m, err = r.HGetAllMap(ctx, key)
+	assert.NoError(t, err)
+	assert.Len(t, m, 0)
+
+	assert.Error(t, r.HGetAllInto(ctx, key, dst))
+}
+
+type hashOptional struct {
+	Count *int     `redis:"count"`
+	Rate  *float64 `redis:"rate"`
+	On    *bool    `redis:"on"`
+	Nick  *string  `redis:"nick"`
+}
+
+func TestRedis_HSetStructNilPointer(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestRedis_HSetStructNilPointer"
+	_, _ = r.Del(ctx, key)
+
+	count := 3
+	src := hashOptional{Count: &count}
+	assert.NoError(t, r.HSetStruct(ctx, key, &src))
+
+	// nil指针不写入
+	m, err := r.HGetAllMap(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"count": "3"}, m)
+
+	var dst hashOptional
+	assert.NoError(t, r.HGetAllInto(ctx, key, &dst))
+	assert.Equal(t, src, dst)
+}
+
+type hashInner struct {
+	Inner string `redis:"inner"`
+}
+
+type hashOuter struct {
+	*hashInner
+	hashBase
+	Name string `redis:"name"`
+}
+
+func TestRedis_HSetStructUnexportedEmbedded(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestRedis_HSetStructUnexportedEmbedded"
+	_, _ = r.Del(ctx, key)
+	_, _ = r.HSet(ctx, key, "inner", "x")
+
+	// 未导出的嵌入指针被忽略，非指针的仍然展开
+	src := hashOuter{hashInner: &hashInner{Inner: "a"}, Name: "b"}
+	src.ID = 1
+	assert.NoError(t, r.HSetStruct(ctx, key, &src))
+
+	var dst hashOuter
+	assert.NotPanics(t, func() { assert.NoError(t, r.HGetAllInto(ctx, key, &dst)) })
+	assert.Nil(t, dst.hashInner)
+	assert.Equal(t, "b", dst.Name)
+	assert.Equal(t, int64(1), dst.ID)
+}
@@ -1,7 +1,14 @@
 package redis
 
 import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"math/rand"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/xlog"
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
 )
@@ -38,3 +45,250 @@ func (r *Redis) tryLock(ctx *gin.Context, key string, value interface{}, expire
 	}
 	return true, nil
 }
+
+var (
+	ErrLockNotObtained = errors.New("redis lock: not obtained")
+	ErrLockNotHeld     = errors.New("redis lock: not held")
+)
+
+// 加锁成功时递增fencing key并返回新值，失败返回0
+var lockAcquireScript = NewScript("lock_acquire", 2, `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0`)
+
+// 仅当锁仍由token持有时才删除
+var lockReleaseScript = NewScript("lock_release", 1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// 仅当锁仍由token持有时才续期
+var lockExtendScript = NewScript("lock_extend", 1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+type MutexOptions struct {
+	// 锁的过期时间，默认8s
+	Expiry time.Duration
+	// 首次重试间隔，之后指数增长到MaxRetryDelay，默认50ms
+	RetryDelay time.Duration
+	// 重试间隔上限，默认1s
+	MaxRetryDelay time.Duration
+	// 持有期间是否由后台goroutine每 Expiry/3 自动续期
+	AutoRenew bool
+}
+
+func (o *MutexOptions) checkOptions() {
+	if o.Expiry == 0 {
+		o.Expiry = 8 * time.Second
+	}
+	if o.RetryDelay == 0 {
+		o.RetryDelay = 50 * time.Millisecond
+	}
+	if o.MaxRetryDelay == 0 {
+		o.MaxRetryDelay = time.Second
+	}
+}
+
+// Mutex 基于单个redis节点的分布式锁，每次加锁生成随机token，只有持有者能解锁和续期
+// 同一个Mutex不能被多个goroutine并发使用
+type Mutex struct {
+	redis *Redis
+	key   string
+	opts  MutexOptions
+
+	token string
+	fence int64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Locker 分布式锁的通用接口
+type Locker interface {
+	Lock(ctx context.Context) error
+	TryLock(ctx context.Context) (bool, error)
+	Unlock(ctx context.Context) error
+	Extend(ctx context.Context) error
+}
+
+func (r *Redis) NewMutex(key string, opts *MutexOptions) *Mutex {
+	var o MutexOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.checkOptions()
+	return &Mutex{
+		redis: r,
+		key:   key,
+		opts:  o,
+	}
+}
+
+// Lock 阻塞加锁，失败后按指数退避重试，直到ctx被取消或超时
+// 传入的ctx需要带有超时，否则锁一直被他人持有时会永久阻塞
+func (m *Mutex) Lock(ctx context.Context) error {
+	delay := m.opts.RetryDelay
+	for {
+		ok, err := m.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		// 加入随机抖动，避免多个等待者同时重试
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ErrLockNotObtained
+		case <-timer.C:
+		}
+		if delay *= 2; delay > m.opts.MaxRetryDelay {
+			delay = m.opts.MaxRetryDelay
+		}
+	}
+}
+
+// TryLock 尝试加锁一次，锁已被持有时返回false
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	token, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+
+	fence, err := redis.Int64(lockAcquireScript.Do(ginContext(ctx), m.redis,
+		m.key, fenceKey(m.key), token, m.opts.Expiry.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	if fence == 0 {
+		return false, nil
+	}
+
+	m.token, m.fence = token, fence
+	if m.opts.AutoRenew {
+		m.startWatchdog(ginContext(ctx))
+	}
+	return true, nil
+}
+
+// Unlock 释放锁，锁已过期或被他人持有时返回 ErrLockNotHeld
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.stopWatchdog()
+	if m.token == "" {
+		return ErrLockNotHeld
+	}
+
+	n, err := redis.Int64(lockReleaseScript.Do(ginContext(ctx), m.redis, m.key, m.token))
+	m.token = ""
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend 将锁的过期时间重置为Expiry，锁已过期或被他人持有时返回 ErrLockNotHeld
+func (m *Mutex) Extend(ctx context.Context) error {
+	return m.extend(ginContext(ctx), m.token)
+}
+
+func (m *Mutex) extend(ctx *gin.Context, token string) error {
+	if token == "" {
+		return ErrLockNotHeld
+	}
+	n, err := redis.Int64(lockExtendScript.Do(ctx, m.redis, m.key, token, m.opts.Expiry.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Token 返回当前持有锁的随机token
+func (m *Mutex) Token() string {
+	return m.token
+}
+
+// FencingToken 返回本次加锁得到的单调递增序号，可随写请求携带给下游用于拒绝过期持有者的写入
+func (m *Mutex) FencingToken() int64 {
+	return m.fence
+}
+
+// startWatchdog 在后台定期续期。gin会复用请求结束后的Context，续期协程只使用其副本
+func (m *Mutex) startWatchdog(ctx *gin.Context) {
+	ctx = copyContext(ctx)
+	m.stopWatchdog()
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func(token string, stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(m.opts.Expiry / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := m.extend(ctx, token); err != nil {
+					xlog.WarnLogger(ctx, "redis lock renew error: "+err.Error(), xlog.String("prot", "redis"), xlog.String("key", m.key))
+					if err == ErrLockNotHeld {
+						return
+					}
+				}
+			}
+		}
+	}(m.token, m.stop, m.done)
+}
+
+func (m *Mutex) stopWatchdog() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop, m.done = nil, nil
+}
+
+// fenceKey 与锁的key落在同一个slot，保证集群模式下脚本可以同时访问
+func fenceKey(key string) string {
+	if hashTag(key) != "" {
+		return key + ":fence"
+	}
+	return "{" + key + "}:fence"
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func ginContext(ctx context.Context) *gin.Context {
+	if c, ok := ctx.(*gin.Context); ok {
+		return c
+	}
+	return nil
+}
+
+// copyContext 返回可在请求结束后继续使用的Context副本，供后台协程使用
+func copyContext(ctx *gin.Context) *gin.Context {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Copy()
+}
@@ -1,9 +1,11 @@
 package redis
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -94,3 +96,79 @@ func TestSetNxByPX(t *testing.T) {
 		})
 	}
 }
+
+func TestMutex_LockUnlock(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	key := "TestMutex_LockUnlock"
+	_, _ = r.Del(ctx, key)
+
+	m1 := r.NewMutex(key, &MutexOptions{Expiry: 2 * time.Second})
+	m2 := r.NewMutex(key, &MutexOptions{Expiry: 2 * time.Second})
+
+	ok, err := m1.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NotEmpty(t, m1.Token())
+	fence := m1.FencingToken()
+	assert.True(t, fence > 0)
+
+	ok, err = m2.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 非持有者无法解锁
+	assert.Equal(t, ErrLockNotHeld, m2.Unlock(ctx))
+	assert.NoError(t, m1.Extend(ctx))
+	assert.NoError(t, m1.Unlock(ctx))
+	assert.Equal(t, ErrLockNotHeld, m1.Extend(ctx))
+
+	ok, err = m2.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, m2.FencingToken() > fence)
+	assert.NoError(t, m2.Unlock(ctx))
+}
+
+func TestMutex_LockWait(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	key := "TestMutex_LockWait"
+	_, _ = r.Del(ctx, key)
+
+	m1 := r.NewMutex(key, &MutexOptions{Expiry: 2 * time.Second})
+	m2 := r.NewMutex(key, &MutexOptions{Expiry: 2 * time.Second, RetryDelay: 10 * time.Millisecond})
+	assert.NoError(t, m1.Lock(ctx))
+
+	timeout, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrLockNotObtained, m2.Lock(timeout))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = m1.Unlock(ctx)
+	}()
+	wait, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	assert.NoError(t, m2.Lock(wait))
+	assert.NoError(t, m2.Unlock(ctx))
+}
+
+func TestMutex_AutoRenew(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	key := "TestMutex_AutoRenew"
+	_, _ = r.Del(ctx, key)
+
+	m := r.NewMutex(key, &MutexOptions{Expiry: 300 * time.Millisecond, AutoRenew: true})
+	assert.NoError(t, m.Lock(ctx))
+	time.Sleep(time.Second)
+
+	ttl, err := r.Pttl(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0)
+	assert.NoError(t, m.Unlock(ctx))
+}
@@ -2,28 +2,127 @@ package redis
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-crt/golib/utils"
 	"github.com/go-crt/golib/xlog"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var (
+	ErrPipelineNotExecuted = errors.New("redis pipeline: command not executed")
+	ErrPipelineUnsent      = errors.New("redis pipeline: command not sent")
 )
 
 type Pipeliner interface {
-	Exec(ctx *gin.Context) ([]interface{}, error)
-	Put(ctx *gin.Context, cmd string, args ...interface{}) error
+	Exec(ctx *gin.Context) ([]*Cmd, error)
+	Put(ctx *gin.Context, cmd string, args ...interface{}) *Cmd
+	PutScript(ctx *gin.Context, script *Script, keysAndArgs ...interface{}) *Cmd
+}
+
+// Cmd pipeline中的一条命令，Exec之后可通过类型方法读取该命令自己的结果和错误
+type Cmd struct {
+	cmd    string
+	args   []interface{}
+	script *Script
+	reply  interface{}
+	err    error
+	// 参数不合法，Exec时不发送，直接作为失败的命令返回
+	invalid bool
+}
+
+func (c *Cmd) Name() string {
+	return c.cmd
+}
+
+func (c *Cmd) Args() []interface{} {
+	return c.args
+}
+
+// Reply 返回原始回复，服务端返回的错误以error的形式返回
+func (c *Cmd) Reply() (interface{}, error) {
+	return c.reply, c.err
+}
+
+func (c *Cmd) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	if e, ok := c.reply.(redigo.Error); ok {
+		return e
+	}
+	return nil
+}
+
+func (c *Cmd) Int() (int, error) {
+	return redigo.Int(c.reply, c.err)
 }
 
-type commands struct {
-	cmd   string
-	args  []interface{}
-	reply interface{}
-	err   error
+func (c *Cmd) Int64() (int64, error) {
+	return redigo.Int64(c.reply, c.err)
+}
+
+func (c *Cmd) Float64() (float64, error) {
+	return redigo.Float64(c.reply, c.err)
+}
+
+func (c *Cmd) Bool() (bool, error) {
+	return redigo.Bool(c.reply, c.err)
+}
+
+func (c *Cmd) String() (string, error) {
+	return redigo.String(c.reply, c.err)
+}
+
+func (c *Cmd) Bytes() ([]byte, error) {
+	return redigo.Bytes(c.reply, c.err)
+}
+
+func (c *Cmd) Values() ([]interface{}, error) {
+	return redigo.Values(c.reply, c.err)
+}
+
+func (c *Cmd) Strings() ([]string, error) {
+	return redigo.Strings(c.reply, c.err)
+}
+
+func (c *Cmd) StringMap() (map[string]string, error) {
+	return redigo.StringMap(c.reply, c.err)
+}
+
+// PipelineError Exec中有命令失败时返回的聚合错误
+type PipelineError struct {
+	// 连接级别的错误，导致部分命令未发送或未收到回复
+	Conn error
+	// 失败的命令，包括服务端返回错误的命令以及因连接中断未发送或未收到回复的命令
+	Failed []*Cmd
+	// 因连接中断从未发送到服务端的命令，可以安全地重试
+	Unsent []*Cmd
+}
+
+func (e *PipelineError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "redis pipeline: %d commands failed", len(e.Failed))
+	if len(e.Unsent) > 0 {
+		fmt.Fprintf(&b, ", %d not sent", len(e.Unsent))
+	}
+	if e.Conn != nil {
+		b.WriteString(": " + e.Conn.Error())
+	} else if len(e.Failed) > 0 {
+		b.WriteString(": " + strings.ToUpper(e.Failed[0].cmd) + ": " + e.Failed[0].Err().Error())
+	}
+	return b.String()
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Conn
 }
 
 type Pipeline struct {
-	cmds  []commands
-	err   error
+	cmds  []*Cmd
 	redis *Redis
 }
 
@@ -33,45 +132,77 @@ func (r *Redis) Pipeline() Pipeliner {
 	}
 }
 
-func (p *Pipeline) Put(ctx *gin.Context, cmd string, args ...interface{}) error {
-	if len(args) < 1 {
-		return errors.New("no key found in args")
-	}
-	c := commands{
+// Put 加入一条命令，返回的Cmd在Exec之后可读取结果
+// 参数不合法时Cmd.Err()返回错误，该命令不会被发送，但仍按顺序出现在Exec的结果和 *PipelineError 中
+func (p *Pipeline) Put(ctx *gin.Context, cmd string, args ...interface{}) *Cmd {
+	c := &Cmd{
 		cmd:  cmd,
 		args: args,
+		err:  ErrPipelineNotExecuted,
+	}
+	if len(args) < 1 {
+		c.err = errors.New("no key found in args")
+		c.invalid = true
 	}
 	p.cmds = append(p.cmds, c)
-	return nil
+	return c
+}
+
+// PutScript 以EVALSHA的方式加入脚本，Exec时会在批次最前面加载用到的脚本，命令仍按Put的顺序执行
+func (p *Pipeline) PutScript(ctx *gin.Context, script *Script, keysAndArgs ...interface{}) *Cmd {
+	c := &Cmd{
+		cmd:    "EVALSHA",
+		args:   script.args(script.hash, keysAndArgs),
+		script: script,
+		err:    ErrPipelineNotExecuted,
+	}
+	p.cmds = append(p.cmds, c)
+	return c
 }
 
-func (p *Pipeline) Exec(ctx *gin.Context) (res []interface{}, err error) {
+// Exec 批量执行所有命令，返回的Cmd与Put的顺序一致
+// 任意命令失败时返回 *PipelineError，其中包含失败及未发送的命令；其余命令的结果不受影响
+func (p *Pipeline) Exec(ctx *gin.Context) ([]*Cmd, error) {
 	start := time.Now()
 
-	conn := p.redis.pool.Get()
-	defer conn.Close()
+	cmds := make([]*Cmd, 0, len(p.cmds))
+	for _, c := range p.cmds {
+		if !c.invalid {
+			cmds = append(cmds, c)
+		}
+	}
 
-	for i := range p.cmds {
-		err = conn.Send(p.cmds[i].cmd, p.cmds[i].args...)
+	var connErr error
+	remoteAddr := p.redis.RemoteAddr
+	if p.redis.cluster != nil {
+		remoteAddr, connErr = p.execCluster(cmds)
+	} else {
+		conn := p.redis.pool.Get()
+		connErr = p.execConn(conn, cmds)
+		conn.Close()
 	}
 
-	err = conn.Flush()
+	var err error
+	pe := &PipelineError{Conn: connErr}
+	for _, c := range p.cmds {
+		if c.err == ErrPipelineUnsent {
+			pe.Unsent = append(pe.Unsent, c)
+		}
+		if c.Err() != nil {
+			pe.Failed = append(pe.Failed, c)
+		}
+	}
+	if pe.Conn != nil || len(pe.Failed) > 0 {
+		err = pe
+	}
 
 	var msg string
 	var ralCode int
 	if err == nil {
 		ralCode = 0
-		for i := range p.cmds {
-			var reply interface{}
-			reply, err = conn.Receive()
-			res = append(res, reply)
-			p.cmds[i].reply, p.cmds[i].err = reply, err
-		}
-
 		msg = "pipeline exec succ"
 	} else {
 		ralCode = -1
-		p.err = err
 		msg = "pipeline exec error: " + err.Error()
 	}
 
@@ -79,7 +210,7 @@ func (p *Pipeline) Exec(ctx *gin.Context) (res []interface{}, err error) {
 	fields := []xlog.Field{
 		xlog.String(xlog.TopicType, xlog.LogNameModule),
 		xlog.String("prot", "redis"),
-		xlog.String("remoteAddr", p.redis.RemoteAddr),
+		xlog.String("remoteAddr", remoteAddr),
 		xlog.String("service", p.redis.Service),
 		xlog.String("requestStartTime", utils.GetFormatRequestTime(start)),
 		xlog.String("requestEndTime", utils.GetFormatRequestTime(end)),
@@ -89,5 +220,171 @@ func (p *Pipeline) Exec(ctx *gin.Context) (res []interface{}, err error) {
 
 	xlog.InfoLogger(ctx, msg, fields...)
 
-	return res, err
+	return p.cmds, err
+}
+
+// execConn 在一个连接上批量发送cmds，返回连接级别的错误
+// 发送失败时该命令及之后的命令标记为 ErrPipelineUnsent，已发送但未收到回复的命令记录连接错误
+// 批量中的脚本先在同一批次的最前面SCRIPT LOAD，保证EVALSHA不会遇到NOSCRIPT而打乱命令的执行顺序
+func (p *Pipeline) execConn(conn redigo.Conn, cmds []*Cmd) error {
+	var loads []*Cmd
+	loaded := make(map[*Script]*Cmd)
+	for _, c := range cmds {
+		if c.script == nil || loaded[c.script] != nil {
+			continue
+		}
+		load := &Cmd{cmd: "SCRIPT", args: []interface{}{"LOAD", c.script.src}}
+		loads = append(loads, load)
+		loaded[c.script] = load
+	}
+	if err := p.send(conn, append(loads, cmds...)); err != nil {
+		return err
+	}
+
+	// 加载失败的脚本（如语法错误）以加载的错误代替NOSCRIPT
+	for _, c := range cmds {
+		if c.script == nil || !isNoScript(c.reply, c.err) {
+			continue
+		}
+		if err := loaded[c.script].Err(); err != nil {
+			c.reply, c.err = nil, err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) send(conn redigo.Conn, cmds []*Cmd) error {
+	if err := conn.Err(); err != nil {
+		markCmds(cmds, ErrPipelineUnsent)
+		return err
+	}
+
+	for i, c := range cmds {
+		if err := conn.Send(c.cmd, c.args...); err != nil {
+			// 已写入缓冲区的命令无法确定是否到达服务端
+			markCmds(cmds[:i], err)
+			markCmds(cmds[i:], ErrPipelineUnsent)
+			return err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		markCmds(cmds, err)
+		return err
+	}
+
+	for i, c := range cmds {
+		c.reply, c.err = conn.Receive()
+		if c.err == nil {
+			continue
+		}
+		if _, ok := c.err.(redigo.Error); !ok {
+			markCmds(cmds[i+1:], c.err)
+			return c.err
+		}
+	}
+	return nil
+}
+
+func markCmds(cmds []*Cmd, err error) {
+	for _, c := range cmds {
+		c.reply, c.err = nil, err
+	}
+}
+
+// execCluster 集群模式下按命令的key所在节点分组，每个节点一次批量发送
+// key不在同一个slot的命令不发送，直接返回 ErrCrossSlot；收到MOVED/ASK的命令与 cluster.doAddr 一样在目标节点上重试一次
+// 某个节点失败不影响其他节点的命令，返回第一个连接级别的错误
+func (p *Pipeline) execCluster(cmds []*Cmd) (string, error) {
+	cl := p.redis.cluster
+	var addrs []string
+	groups := make(map[string][]*Cmd)
+	for _, c := range cmds {
+		slot, err := cmdSlot(c)
+		if err != nil {
+			c.reply, c.err = nil, err
+			continue
+		}
+		var addr string
+		if slot < 0 {
+			addr = cl.randomAddr()
+		} else {
+			addr = cl.slotAddr(slot)
+		}
+		if _, ok := groups[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		groups[addr] = append(groups[addr], c)
+	}
+	connErr := p.execGroups(addrs, groups)
+
+	var retryAddrs []string
+	retries := make(map[string][]*Cmd)
+	for _, addr := range addrs {
+		for _, c := range groups[addr] {
+			e, ok := c.err.(redigo.Error)
+			if !ok {
+				continue
+			}
+			moved, ask, target := parseRedirect(e)
+			if !moved && !ask {
+				continue
+			}
+			if _, ok := retries[target]; !ok {
+				retryAddrs = append(retryAddrs, target)
+			}
+			if moved {
+				if slot, _ := cmdSlot(c); slot >= 0 {
+					cl.setSlot(slot, target)
+				}
+				cl.refreshAsync()
+			} else {
+				// ASK 只对紧随其后的一条命令有效
+				retries[target] = append(retries[target], &Cmd{cmd: "ASKING"})
+			}
+			retries[target] = append(retries[target], c)
+		}
+	}
+	if err := p.execGroups(retryAddrs, retries); connErr == nil {
+		connErr = err
+	}
+	return strings.Join(addrs, ","), connErr
+}
+
+// execGroups 依次在各节点上批量发送对应的命令，返回第一个连接级别的错误
+func (p *Pipeline) execGroups(addrs []string, groups map[string][]*Cmd) error {
+	var connErr error
+	for _, addr := range addrs {
+		if addr == "" {
+			markCmds(groups[addr], ErrPipelineUnsent)
+			if connErr == nil {
+				connErr = ErrClusterNoNode
+			}
+			continue
+		}
+		conn := p.redis.cluster.pool(addr).Get()
+		err := p.execConn(conn, groups[addr])
+		conn.Close()
+		if err != nil {
+			p.redis.cluster.refreshAsync()
+			if connErr == nil {
+				connErr = err
+			}
+		}
+	}
+	return connErr
+}
+
+// cmdSlot 返回命令的key所在的slot，不含key时返回-1，key不在同一个slot时返回 ErrCrossSlot
+func cmdSlot(c *Cmd) (int, error) {
+	keys := commandKeys(c.cmd, c.args)
+	if len(keys) == 0 {
+		return -1, nil
+	}
+	slot := keySlot(keys[0])
+	for _, key := range keys[1:] {
+		if keySlot(key) != slot {
+			return -1, ErrCrossSlot
+		}
+	}
+	return slot, nil
 }
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline_Exec(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key, str := "TestPipeline_Exec", "TestPipeline_Exec_str"
+	_, _ = r.Del(ctx, key, str)
+	_, _ = r.Do(ctx, "SET", str, "abc")
+
+	p := r.Pipeline()
+	incr := p.Put(ctx, "INCRBY", key, 5)
+	get := p.Put(ctx, "GET", key)
+	bad := p.Put(ctx, "INCR", str)
+	nokey := p.Put(ctx, "GET")
+	val := p.Put(ctx, "GET", str)
+	assert.Equal(t, ErrPipelineNotExecuted, incr.Err())
+	assert.Error(t, nokey.Err())
+
+	cmds, err := p.Exec(ctx)
+	assert.Equal(t, []*Cmd{incr, get, bad, nokey, val}, cmds)
+	var pe *PipelineError
+	assert.True(t, errors.As(err, &pe))
+	assert.NoError(t, pe.Conn)
+	assert.Equal(t, []*Cmd{bad, nokey}, pe.Failed)
+	assert.Empty(t, pe.Unsent)
+
+	n, err := incr.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	b, err := get.Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("5"), b)
+	assert.Error(t, bad.Err())
+	s, err := val.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", s)
+
+	_, _ = r.Del(ctx, key, str)
+}
+
+func TestPipeline_ExecUnsent(t *testing.T) {
+	down, err := InitRedisClient(RedisConf{
+		Service:     "down",
+		Addr:        "127.0.0.1:1",
+		MaxIdle:     1,
+		MaxActive:   1,
+		ConnTimeOut: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer down.Close()
+
+	p := down.Pipeline()
+	set := p.Put(nil, "SET", "a", 1)
+	get := p.Put(nil, "GET", "a")
+	_, err = p.Exec(nil)
+
+	var pe *PipelineError
+	assert.True(t, errors.As(err, &pe))
+	assert.Error(t, pe.Conn)
+	assert.Equal(t, []*Cmd{set, get}, pe.Unsent)
+	assert.Equal(t, ErrPipelineUnsent, get.Err())
+	_, err = set.Int64()
+	assert.Equal(t, ErrPipelineUnsent, err)
+}
+
+// clusterNode 模拟集群中的一个节点，handle 根据命令及之前是否收到ASKING返回回复
+type clusterNode struct {
+	mu     sync.Mutex
+	cmds   []string
+	handle func(asking bool, cmd string, args []interface{}) (interface{}, error)
+}
+
+func (n *clusterNode) pool() *redigo.Pool {
+	return &redigo.Pool{Dial: func() (redigo.Conn, error) { return &clusterNodeConn{node: n}, nil }}
+}
+
+type clusterNodeReply struct {
+	reply interface{}
+	err   error
+}
+
+type clusterNodeConn struct {
+	node    *clusterNode
+	asking  bool
+	pending []clusterNodeReply
+}
+
+func (c *clusterNodeConn) Close() error { return nil }
+func (c *clusterNodeConn) Err() error   { return nil }
+func (c *clusterNodeConn) Flush() error { return nil }
+
+func (c *clusterNodeConn) Send(cmd string, args ...interface{}) error {
+	if cmd == "CLUSTER" {
+		// MOVED 触发的异步刷新
+		c.pending = append(c.pending, clusterNodeReply{err: redigo.Error("ERR cluster support disabled")})
+		return nil
+	}
+	c.node.mu.Lock()
+	c.node.cmds = append(c.node.cmds, cmd)
+	c.node.mu.Unlock()
+	if cmd == "ASKING" {
+		c.asking = true
+		c.pending = append(c.pending, clusterNodeReply{reply: "OK"})
+		return nil
+	}
+	reply, err := c.node.handle(c.asking, cmd, args)
+	c.asking = false
+	c.pending = append(c.pending, clusterNodeReply{reply, err})
+	return nil
+}
+
+func (c *clusterNodeConn) Receive() (interface{}, error) {
+	r := c.pending[0]
+	c.pending = c.pending[1:]
+	return r.reply, r.err
+}
+
+func (c *clusterNodeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return nil, nil
+	}
+	_ = c.Send(cmd, args...)
+	return c.Receive()
+}
+
+func TestPipeline_ExecClusterRedirect(t *testing.T) {
+	moved, asked := "TestPipeline_moved", "TestPipeline_asked"
+	movedSlot, askedSlot := keySlot(moved), keySlot(asked)
+
+	a := &clusterNode{handle: func(asking bool, cmd string, args []interface{}) (interface{}, error) {
+		switch args[0] {
+		case moved:
+			return nil, redigo.Error(fmt.Sprintf("MOVED %d b:1", movedSlot))
+		case asked:
+			return nil, redigo.Error(fmt.Sprintf("ASK %d b:1", askedSlot))
+		}
+		return nil, redigo.Error("ERR unknown command")
+	}}
+	b := &clusterNode{handle: func(asking bool, cmd string, args []interface{}) (interface{}, error) {
+		if args[0] == asked && !asking {
+			return nil, redigo.Error(fmt.Sprintf("MOVED %d a:1", askedSlot))
+		}
+		return []byte("from b"), nil
+	}}
+
+	cl := newCluster(RedisConf{})
+	cl.pools["a:1"], cl.pools["b:1"] = a.pool(), b.pool()
+	cl.setSlot(movedSlot, "a:1")
+	cl.setSlot(askedSlot, "a:1")
+	cr := &Redis{Service: "cluster", cluster: cl}
+
+	p := cr.Pipeline()
+	get := p.Put(nil, "GET", moved)
+	ask := p.Put(nil, "GET", asked)
+	cross := p.Put(nil, "MGET", "{a}1", "{b}1")
+	_, err := p.Exec(nil)
+
+	var pe *PipelineError
+	assert.True(t, errors.As(err, &pe))
+	assert.NoError(t, pe.Conn)
+	assert.Equal(t, []*Cmd{cross}, pe.Failed)
+	assert.Equal(t, ErrCrossSlot, cross.Err())
+
+	s, err := get.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "from b", s)
+	s, err = ask.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "from b", s)
+
+	// MOVED 更新slot，ASK 不更新
+	assert.Equal(t, "b:1", cl.slotAddr(movedSlot))
+	assert.Equal(t, []string{"GET", "ASKING", "GET"}, b.cmds)
+	assert.Equal(t, []string{"GET", "GET"}, a.cmds)
+}
@@ -0,0 +1,332 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/xlog"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var ErrSubscriberClosed = errors.New("redis subscriber: closed")
+
+// Message 订阅收到的消息，Pattern 仅在通过 PSubscribe 收到时非空
+type Message struct {
+	Channel string
+	Pattern string
+	Data    []byte
+}
+
+type SubscriberOptions struct {
+	// 消息回调，设置后消息不再写入 Channel()，回调在接收goroutine中串行执行
+	// 回调中不能同步调用 Close，Close会等待接收goroutine退出而死锁，需要时使用 go s.Close()
+	Handler func(msg Message)
+	// Channel() 的缓冲大小，默认100
+	BufferSize int
+	// 探活PING的间隔，超过两个间隔没有任何回复视为断线，默认30s
+	PingInterval time.Duration
+	// 断线重连的最大退避间隔，默认10s
+	MaxBackoff time.Duration
+	// 断线重连并恢复订阅后调用，可用于补偿断线期间丢失的消息；首次连接时不调用
+	OnReconnect func()
+	// 收到服务端的订阅/退订确认时调用，kind为subscribe、unsubscribe、psubscribe或punsubscribe，
+	// 在接收goroutine中执行，可用于等待订阅真正生效
+	OnSubscription func(kind, channel string)
+}
+
+func (o *SubscriberOptions) checkOptions() {
+	if o.BufferSize == 0 {
+		o.BufferSize = 100
+	}
+	if o.PingInterval == 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 10 * time.Second
+	}
+}
+
+// Subscriber 使用独占连接的订阅者，断线后按指数退避重连并自动恢复所有订阅
+type Subscriber struct {
+	redis *Redis
+	opts  SubscriberOptions
+
+	mu       sync.Mutex
+	psc      *redigo.PubSubConn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// 是否曾经连接成功，仅在接收goroutine中读写
+	connected bool
+
+	msgs   chan Message
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (r *Redis) NewSubscriber(opts *SubscriberOptions) *Subscriber {
+	var o SubscriberOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.checkOptions()
+
+	s := &Subscriber{
+		redis:    r,
+		opts:     o,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		msgs:     make(chan Message, o.BufferSize),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Publish 向channel发布消息，返回收到消息的订阅者数量
+func (r *Redis) Publish(ctx *gin.Context, channel string, message interface{}) (int64, error) {
+	return redigo.Int64(r.Do(ctx, "PUBLISH", channel, message))
+}
+
+// Channel 返回接收消息的channel，Close后被关闭
+func (s *Subscriber) Channel() <-chan Message {
+	return s.msgs
+}
+
+func (s *Subscriber) Subscribe(ctx *gin.Context, channels ...string) error {
+	return s.update(ctx, "SUBSCRIBE", s.channels, true, channels)
+}
+
+func (s *Subscriber) Unsubscribe(ctx *gin.Context, channels ...string) error {
+	return s.update(ctx, "UNSUBSCRIBE", s.channels, false, channels)
+}
+
+func (s *Subscriber) PSubscribe(ctx *gin.Context, patterns ...string) error {
+	return s.update(ctx, "PSUBSCRIBE", s.patterns, true, patterns)
+}
+
+func (s *Subscriber) PUnsubscribe(ctx *gin.Context, patterns ...string) error {
+	return s.update(ctx, "PUNSUBSCRIBE", s.patterns, false, patterns)
+}
+
+// update 记录订阅关系，连接可用时立即发送命令；连接断开时由重连后统一恢复
+func (s *Subscriber) update(ctx *gin.Context, cmd string, set map[string]struct{}, add bool, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	select {
+	case <-s.closed:
+		return ErrSubscriberClosed
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		if add {
+			set[name] = struct{}{}
+		} else {
+			delete(set, name)
+		}
+	}
+	if s.psc == nil {
+		return nil
+	}
+	err := s.send(cmd, names)
+	s.log(ctx, cmd, names, err)
+	return err
+}
+
+// send 需在持有 s.mu 时调用，保证同一时刻只有一个goroutine写连接
+func (s *Subscriber) send(cmd string, names []string) error {
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	if err := s.psc.Conn.Send(cmd, args...); err != nil {
+		return err
+	}
+	return s.psc.Conn.Flush()
+}
+
+// Close 关闭连接并等待接收goroutine退出，不能在 Handler 中同步调用
+func (s *Subscriber) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+		s.mu.Lock()
+		if s.psc != nil {
+			_ = s.psc.Close()
+		}
+		s.mu.Unlock()
+	})
+	<-s.done
+	return nil
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+	defer close(s.msgs)
+
+	backoff := 100 * time.Millisecond
+	for {
+		received, err := s.serve()
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		if received {
+			backoff = 100 * time.Millisecond
+		}
+		xlog.WarnLogger(nil, "redis subscriber reconnect: "+err.Error(),
+			xlog.String("prot", "redis"), xlog.String("service", s.redis.Service))
+
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// serve 建立连接、恢复订阅并持续接收消息，直到连接出错
+func (s *Subscriber) serve() (bool, error) {
+	conn, err := s.redis.dial()
+	if err != nil {
+		return false, err
+	}
+	psc := &redigo.PubSubConn{Conn: pubsubConn{conn}}
+	defer psc.Close()
+
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return false, ErrSubscriberClosed
+	default:
+	}
+	s.psc = psc
+	err = s.resubscribe()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.psc = nil
+		s.mu.Unlock()
+	}()
+	if err != nil {
+		return false, err
+	}
+	if s.connected && s.opts.OnReconnect != nil {
+		s.opts.OnReconnect()
+	}
+	s.connected = true
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(stop)
+
+	received := false
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * s.opts.PingInterval).(type) {
+		case redigo.Message:
+			received = true
+			s.deliver(Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data})
+		case redigo.Subscription:
+			received = true
+			if s.opts.OnSubscription != nil {
+				s.opts.OnSubscription(v.Kind, v.Channel)
+			}
+		case redigo.Pong:
+			received = true
+		case error:
+			return received, v
+		}
+	}
+}
+
+func (s *Subscriber) resubscribe() error {
+	for cmd, set := range map[string]map[string]struct{}{"SUBSCRIBE": s.channels, "PSUBSCRIBE": s.patterns} {
+		if len(set) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		err := s.send(cmd, names)
+		s.log(nil, cmd, names, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Subscriber) ping(stop chan struct{}) {
+	ticker := time.NewTicker(s.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.psc != nil {
+				_ = s.send("PING", nil)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// pubsubConn 未订阅任何channel时服务端对PING回复普通的 +PONG，PubSubConn 会将其视为错误，
+// 这里转换为订阅状态下的 pong 回复，避免空闲的订阅者每个PingInterval断线重连
+type pubsubConn struct {
+	redigo.Conn
+}
+
+func (c pubsubConn) Receive() (interface{}, error) {
+	return pongReply(c.Conn.Receive())
+}
+
+func (c pubsubConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return pongReply(redigo.ReceiveWithTimeout(c.Conn, timeout))
+}
+
+// DoWithTimeout 与 ReceiveWithTimeout 一起实现 redigo.ConnWithTimeout
+func (c pubsubConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redigo.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func pongReply(reply interface{}, err error) (interface{}, error) {
+	if s, ok := reply.(string); ok && err == nil && s == "PONG" {
+		return []interface{}{[]byte("pong"), []byte("")}, nil
+	}
+	return reply, err
+}
+
+func (s *Subscriber) deliver(msg Message) {
+	if s.opts.Handler != nil {
+		s.opts.Handler(msg)
+		return
+	}
+	select {
+	case s.msgs <- msg:
+	case <-s.closed:
+	}
+}
+
+func (s *Subscriber) log(ctx *gin.Context, cmd string, names []string, err error) {
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	s.redis.logCommand(ctx, time.Now(), s.redis.RemoteAddr, cmd, args, err)
+}
@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, s *Subscriber) Message {
+	select {
+	case msg := <-s.Channel():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("receive message timeout")
+	}
+	return Message{}
+}
+
+func TestSubscriber_Subscribe(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	s := r.NewSubscriber(nil)
+	defer s.Close()
+	assert.NoError(t, s.Subscribe(ctx, "TestSubscriber_ch1", "TestSubscriber_ch2"))
+	assert.NoError(t, s.PSubscribe(ctx, "TestSubscriber_p*"))
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := r.Publish(ctx, "TestSubscriber_ch1", "hello")
+	assert.NoError(t, err)
+	msg := receive(t, s)
+	assert.Equal(t, "TestSubscriber_ch1", msg.Channel)
+	assert.Equal(t, "hello", string(msg.Data))
+
+	_, err = r.Publish(ctx, "TestSubscriber_p1", "world")
+	assert.NoError(t, err)
+	msg = receive(t, s)
+	assert.Equal(t, "TestSubscriber_p1", msg.Channel)
+	assert.Equal(t, "TestSubscriber_p*", msg.Pattern)
+	assert.Equal(t, "world", string(msg.Data))
+
+	assert.NoError(t, s.Unsubscribe(ctx, "TestSubscriber_ch1"))
+	time.Sleep(100 * time.Millisecond)
+	n, err := r.Publish(ctx, "TestSubscriber_ch1", "ignored")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	_, err = r.Publish(ctx, "TestSubscriber_ch2", "again")
+	assert.NoError(t, err)
+	msg = receive(t, s)
+	assert.Equal(t, "TestSubscriber_ch2", msg.Channel)
+}
+
+func TestSubscriber_Handler(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	got := make(chan Message, 1)
+	s := r.NewSubscriber(&SubscriberOptions{
+		Handler: func(msg Message) {
+			got <- msg
+		},
+	})
+	assert.NoError(t, s.Subscribe(ctx, "TestSubscriber_Handler"))
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := r.Publish(ctx, "TestSubscriber_Handler", "hello")
+	assert.NoError(t, err)
+	select {
+	case msg := <-got:
+		assert.Equal(t, "hello", string(msg.Data))
+	case <-time.After(time.Second):
+		t.Fatal("receive message timeout")
+	}
+
+	assert.NoError(t, s.Close())
+	_, ok := <-s.Channel()
+	assert.False(t, ok)
+	assert.Equal(t, ErrSubscriberClosed, s.Subscribe(ctx, "TestSubscriber_Handler"))
+}
+
+func TestSubscriber_IdlePing(t *testing.T) {
+	setup()
+
+	reconnected := make(chan struct{}, 1)
+	s := r.NewSubscriber(&SubscriberOptions{
+		PingInterval: 50 * time.Millisecond,
+		OnReconnect: func() {
+			reconnected <- struct{}{}
+		},
+	})
+	defer s.Close()
+
+	// 未订阅时PING的回复是 +PONG，不应导致重连
+	select {
+	case <-reconnected:
+		t.Fatal("idle subscriber reconnected")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestSubscriber_Reconnect(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	reconnected := make(chan struct{}, 1)
+	s := r.NewSubscriber(&SubscriberOptions{
+		OnReconnect: func() {
+			reconnected <- struct{}{}
+		},
+	})
+	defer s.Close()
+	assert.NoError(t, s.Subscribe(ctx, "TestSubscriber_Reconnect"))
+	time.Sleep(100 * time.Millisecond)
+
+	s.mu.Lock()
+	_ = s.psc.Conn.Close()
+	s.mu.Unlock()
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect timeout")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := r.Publish(ctx, "TestSubscriber_Reconnect", "resubscribed")
+	assert.NoError(t, err)
+	assert.Equal(t, "resubscribed", string(receive(t, s).Data))
+}
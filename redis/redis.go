@@ -1,7 +1,10 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+
 	"github.com/go-crt/golib/utils"
 	"github.com/go-crt/golib/xlog"
 	"time"
@@ -23,8 +26,21 @@ type RedisConf struct {
 	ConnTimeOut  time.Duration `yaml:"connTimeOut"`
 	ReadTimeOut  time.Duration `yaml:"readTimeOut"`
 	WriteTimeOut time.Duration `yaml:"writeTimeOut"`
+	// 集群模式下的种子节点列表，非空时忽略Addr，按slot路由到对应节点
+	ClusterAddrs []string `yaml:"clusterAddrs"`
+	// 哨兵模式下的主节点名称及哨兵地址，非空时忽略Addr，由哨兵发现主节点
+	MasterName       string   `yaml:"masterName"`
+	SentinelAddrs    []string `yaml:"sentinelAddrs"`
+	SentinelPassword string   `yaml:"sentinelPassword"`
+	// 哨兵模式下只读命令发往从节点
+	ReadFromReplica bool `yaml:"readFromReplica"`
+	// Watch 事务因watch的key被修改而失败时的最大重试次数，不配置时为 defaultMaxTxRetries，配置为0时不重试
+	MaxTxRetries *int `yaml:"maxTxRetries"`
 }
 
+// Watch 事务默认的最大重试次数
+const defaultMaxTxRetries = 3
+
 func (conf *RedisConf) checkConf() {
 	if conf.MaxIdle == 0 {
 		conf.MaxIdle = 100
@@ -44,36 +60,52 @@ func (conf *RedisConf) checkConf() {
 	if conf.WriteTimeOut == 0 {
 		conf.WriteTimeOut = 1 * time.Second
 	}
+	if conf.MaxTxRetries == nil {
+		n := defaultMaxTxRetries
+		conf.MaxTxRetries = &n
+	}
 }
 
 // Redis 日志打印Do args部分支持的最大长度
 type Redis struct {
-	pool       *redigo.Pool
-	Service    string
-	RemoteAddr string
+	pool     *redigo.Pool
+	cluster  *cluster
+	sentinel *sentinel
+	// 建立不经过连接池的独占连接，用于订阅等长连接场景
+	dial func() (redigo.Conn, error)
+	// 阻塞命令在等待时间之外额外预留的读超时
+	readTimeOut  time.Duration
+	maxTxRetries int
+	Service      string
+	RemoteAddr   string
 }
 
 func InitRedisClient(conf RedisConf) (*Redis, error) {
 	conf.checkConf()
-	p := &redigo.Pool{
+	if len(conf.ClusterAddrs) > 0 {
+		return initClusterClient(conf)
+	}
+	if len(conf.SentinelAddrs) > 0 {
+		return initSentinelClient(conf)
+	}
+	c := &Redis{
+		Service:      conf.Service,
+		RemoteAddr:   conf.Addr,
+		pool:         newPool(conf, dialAddr(conf, conf.Addr)),
+		dial:         dialAddr(conf, conf.Addr),
+		readTimeOut:  conf.ReadTimeOut,
+		maxTxRetries: *conf.MaxTxRetries,
+	}
+	return c, nil
+}
+
+func newPool(conf RedisConf, dial func() (redigo.Conn, error)) *redigo.Pool {
+	return &redigo.Pool{
 		MaxIdle:     conf.MaxIdle,
 		MaxActive:   conf.MaxActive,
 		IdleTimeout: conf.IdleTimeout,
 		Wait:        true,
-		Dial: func() (conn redigo.Conn, e error) {
-			con, err := redigo.Dial(
-				"tcp",
-				conf.Addr,
-				redigo.DialPassword(conf.Password),
-				redigo.DialConnectTimeout(conf.ConnTimeOut),
-				redigo.DialReadTimeout(conf.ReadTimeOut),
-				redigo.DialWriteTimeout(conf.WriteTimeOut),
-			)
-			if err != nil {
-				return nil, err
-			}
-			return con, nil
-		},
+		Dial:        dial,
 		TestOnBorrow: func(c redigo.Conn, t time.Time) error {
 			if time.Since(t) < time.Minute {
 				return nil
@@ -82,29 +114,120 @@ func InitRedisClient(conf RedisConf) (*Redis, error) {
 			return err
 		},
 	}
+}
+
+func dialAddr(conf RedisConf, addr string) func() (redigo.Conn, error) {
+	return func() (conn redigo.Conn, e error) {
+		con, err := redigo.Dial(
+			"tcp",
+			addr,
+			redigo.DialPassword(conf.Password),
+			redigo.DialConnectTimeout(conf.ConnTimeOut),
+			redigo.DialReadTimeout(conf.ReadTimeOut),
+			redigo.DialWriteTimeout(conf.WriteTimeOut),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return con, nil
+	}
+}
+
+func initClusterClient(conf RedisConf) (*Redis, error) {
+	cl := newCluster(conf)
+	if err := cl.refresh(); err != nil {
+		cl.close()
+		return nil, err
+	}
 	c := &Redis{
 		Service:    conf.Service,
-		RemoteAddr: conf.Addr,
-		pool:       p,
+		RemoteAddr: strings.Join(conf.ClusterAddrs, ","),
+		cluster:    cl,
+		dial: func() (redigo.Conn, error) {
+			return dialAddr(conf, cl.randomAddr())()
+		},
+		readTimeOut:  conf.ReadTimeOut,
+		maxTxRetries: *conf.MaxTxRetries,
+	}
+	return c, nil
+}
+
+func initSentinelClient(conf RedisConf) (*Redis, error) {
+	if conf.MasterName == "" {
+		return nil, errors.New("redis sentinel: masterName is empty")
+	}
+	s := newSentinel(conf)
+	if _, err := s.discover(); err != nil {
+		return nil, err
+	}
+	go s.watch()
+	c := &Redis{
+		Service:      conf.Service,
+		RemoteAddr:   conf.MasterName,
+		pool:         s.pool,
+		sentinel:     s,
+		dial:         s.dialMaster,
+		readTimeOut:  conf.ReadTimeOut,
+		maxTxRetries: *conf.MaxTxRetries,
 	}
 	return c, nil
 }
 
 func (r *Redis) Do(ctx *gin.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return r.do(ctx, commandName, args, args)
+}
+
+// do 执行命令并打印module日志，logArgs 为日志中 commandVal 展示的参数
+func (r *Redis) do(ctx *gin.Context, commandName string, logArgs, args []interface{}) (reply interface{}, err error) {
+	return r.doTimeout(ctx, 0, commandName, logArgs, args)
+}
+
+// doTimeout 同do，timeout大于0时替代连接的读超时，用于 BLOCK 等阻塞命令
+func (r *Redis) doTimeout(ctx *gin.Context, timeout time.Duration, commandName string, logArgs, args []interface{}) (reply interface{}, err error) {
 	start := time.Now()
 
-	conn := r.pool.Get()
-	err = conn.Err()
-	if err != nil {
-		xlog.ErrorLogger(ctx, "get connection error: "+err.Error(), xlog.String("prot", "redis"))
-		return reply, err
+	remoteAddr := r.RemoteAddr
+	if r.cluster != nil {
+		remoteAddr, reply, err = r.cluster.do(timeout, commandName, args...)
+	} else {
+		pool := r.pool
+		if r.sentinel != nil {
+			pool, remoteAddr = r.sentinel.route(commandName)
+		}
+		conn := pool.Get()
+		err = conn.Err()
+		if err != nil {
+			xlog.ErrorLogger(ctx, "get connection error: "+err.Error(), xlog.String("prot", "redis"))
+			return reply, err
+		}
+
+		if timeout > 0 {
+			reply, err = redigo.DoWithTimeout(conn, timeout, commandName, args...)
+		} else {
+			reply, err = conn.Do(commandName, args...)
+		}
+		if err = conn.Close(); err != nil {
+			xlog.WarnLogger(ctx, "connection close error: "+err.Error(), xlog.String("prot", "redis"))
+		}
 	}
 
-	reply, err = conn.Do(commandName, args...)
-	if err = conn.Close(); err != nil {
-		xlog.WarnLogger(ctx, "connection close error: "+err.Error(), xlog.String("prot", "redis"))
+	r.logCommand(ctx, start, remoteAddr, commandName, logArgs, err)
+	return reply, err
+}
+
+// getConn 返回一个独占的连接池连接，集群模式下返回key所在节点的连接
+func (r *Redis) getConn(key string) (string, redigo.Conn) {
+	if r.cluster != nil {
+		return r.cluster.getConn(key)
+	}
+	if r.sentinel != nil {
+		return r.sentinel.masterAddr(), r.pool.Get()
 	}
+	return r.RemoteAddr, r.pool.Get()
+}
 
+// logCommand 打印与Do一致的module日志
+func (r *Redis) logCommand(ctx *gin.Context, start time.Time, remoteAddr, commandName string, logArgs []interface{}, err error) {
 	end := time.Now()
 
 	// 执行时间 单位:毫秒
@@ -119,26 +242,38 @@ func (r *Redis) Do(ctx *gin.Context, commandName string, args ...interface{}) (r
 	fields := []xlog.Field{
 		xlog.String(xlog.TopicType, xlog.LogNameModule),
 		xlog.String("prot", "redis"),
-		xlog.String("remoteAddr", r.RemoteAddr),
+		xlog.String("remoteAddr", remoteAddr),
 		xlog.String("service", r.Service),
 		xlog.String("requestStartTime", utils.GetFormatRequestTime(start)),
 		xlog.String("requestEndTime", utils.GetFormatRequestTime(end)),
 		xlog.Float64("cost", utils.GetRequestCost(start, end)),
 		xlog.String("command", commandName),
-		xlog.String("commandVal", utils.JoinArgs(logForRedisValue, args)),
+		xlog.String("commandVal", utils.JoinArgs(logForRedisValue, logArgs)),
 		xlog.Int("ralCode", ralCode),
 	}
 
 	xlog.InfoLogger(ctx, msg, fields...)
-	return reply, err
 }
 
 func (r *Redis) Close() error {
+	if r.cluster != nil {
+		return r.cluster.close()
+	}
+	if r.sentinel != nil {
+		return r.sentinel.close()
+	}
 	return r.pool.Close()
 }
 
 func (r *Redis) Stats() (inUseCount, idleCount, activeCount int) {
-	stats := r.pool.Stats()
+	var stats redigo.PoolStats
+	if r.cluster != nil {
+		stats = r.cluster.stats()
+	} else if r.sentinel != nil {
+		stats = r.sentinel.stats()
+	} else {
+		stats = r.pool.Stats()
+	}
 	idleCount = stats.IdleCount
 	activeCount = stats.ActiveCount
 	inUseCount = activeCount - idleCount
@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+)
+
+type RedlockOptions struct {
+	// 锁的过期时间，默认8s
+	Expiry time.Duration
+	// 首次重试间隔，之后指数增长到MaxRetryDelay，默认50ms
+	RetryDelay time.Duration
+	// 重试间隔上限，默认1s
+	MaxRetryDelay time.Duration
+	// 时钟漂移系数，有效期需扣除 Expiry*DriftFactor+2ms，默认0.01
+	DriftFactor float64
+}
+
+func (o *RedlockOptions) checkOptions() {
+	if o.Expiry == 0 {
+		o.Expiry = 8 * time.Second
+	}
+	if o.RetryDelay == 0 {
+		o.RetryDelay = 50 * time.Millisecond
+	}
+	if o.MaxRetryDelay == 0 {
+		o.MaxRetryDelay = time.Second
+	}
+	if o.DriftFactor == 0 {
+		o.DriftFactor = 0.01
+	}
+}
+
+// Redlock 基于N个相互独立的redis节点的分布式锁，在多数节点上加锁成功且仍在有效期内才算持有
+// 同一个Redlock不能被多个goroutine并发使用
+type Redlock struct {
+	clients []*Redis
+	key     string
+	opts    RedlockOptions
+
+	token      string
+	validUntil time.Time
+}
+
+func NewRedlock(key string, clients []*Redis, opts *RedlockOptions) *Redlock {
+	var o RedlockOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.checkOptions()
+	return &Redlock{
+		clients: clients,
+		key:     key,
+		opts:    o,
+	}
+}
+
+// Lock 阻塞加锁，失败后按指数退避重试，直到ctx被取消或超时
+func (l *Redlock) Lock(ctx context.Context) error {
+	delay := l.opts.RetryDelay
+	for {
+		ok, err := l.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ErrLockNotObtained
+		case <-timer.C:
+		}
+		if delay *= 2; delay > l.opts.MaxRetryDelay {
+			delay = l.opts.MaxRetryDelay
+		}
+	}
+}
+
+// TryLock 在所有节点上尝试加锁一次，未达到多数或有效期已耗尽时释放已加的锁并返回false
+// 多数节点返回错误时同时返回第一个错误
+func (l *Redlock) TryLock(ctx context.Context) (bool, error) {
+	token, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+
+	gc := ginContext(ctx)
+	start := time.Now()
+	n, err := l.each(func(c *Redis) (bool, error) {
+		_, err := redis.String(c.Do(gc, "SET", l.key, token, "PX", l.opts.Expiry.Milliseconds(), NOTEXISTS))
+		if err == redis.ErrNil {
+			return false, nil
+		}
+		return err == nil, err
+	})
+
+	if validity := l.validity(start); n >= l.quorum() && validity > 0 {
+		l.token, l.validUntil = token, start.Add(l.opts.Expiry-l.drift())
+		return true, nil
+	}
+
+	_, _ = l.release(gc, token)
+	return false, err
+}
+
+// Unlock 在所有节点上释放锁，多数节点上锁已不由自己持有时返回 ErrLockNotHeld
+func (l *Redlock) Unlock(ctx context.Context) error {
+	if l.token == "" {
+		return ErrLockNotHeld
+	}
+	n, err := l.release(ginContext(ctx), l.token)
+	l.token, l.validUntil = "", time.Time{}
+	if n >= l.quorum() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// Extend 在所有节点上将锁的过期时间重置为Expiry，未在多数节点上续期成功时返回 ErrLockNotHeld
+func (l *Redlock) Extend(ctx context.Context) error {
+	if l.token == "" {
+		return ErrLockNotHeld
+	}
+	gc := ginContext(ctx)
+	start := time.Now()
+	n, err := l.each(func(c *Redis) (bool, error) {
+		res, err := redis.Int64(lockExtendScript.Do(gc, c, l.key, l.token, l.opts.Expiry.Milliseconds()))
+		return res == 1, err
+	})
+	if n >= l.quorum() && l.validity(start) > 0 {
+		l.validUntil = start.Add(l.opts.Expiry - l.drift())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// Validity 返回锁剩余的有效时间，未持有或已过期时返回0
+func (l *Redlock) Validity() time.Duration {
+	if l.token == "" {
+		return 0
+	}
+	if d := time.Until(l.validUntil); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Token 返回当前持有锁的随机token
+func (l *Redlock) Token() string {
+	return l.token
+}
+
+func (l *Redlock) release(ctx *gin.Context, token string) (int, error) {
+	return l.each(func(c *Redis) (bool, error) {
+		res, err := redis.Int64(lockReleaseScript.Do(ctx, c, l.key, token))
+		return res == 1, err
+	})
+}
+
+// each 并发地在所有节点上执行fn，返回成功的节点数以及多数节点出错时的第一个错误
+func (l *Redlock) each(fn func(c *Redis) (bool, error)) (int, error) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		n     int
+		errs  int
+		first error
+	)
+	for _, c := range l.clients {
+		wg.Add(1)
+		go func(c *Redis) {
+			defer wg.Done()
+			ok, err := fn(c)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				n++
+			}
+			if err != nil {
+				errs++
+				if first == nil {
+					first = err
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if errs >= l.quorum() {
+		return n, first
+	}
+	return n, nil
+}
+
+func (l *Redlock) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+func (l *Redlock) drift() time.Duration {
+	return time.Duration(float64(l.opts.Expiry)*l.opts.DriftFactor) + 2*time.Millisecond
+}
+
+func (l *Redlock) validity(start time.Time) time.Duration {
+	return l.opts.Expiry - time.Since(start) - l.drift()
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// redlock需要多个相互独立的redis节点，节点不可用时跳过
+func redlockClients(t *testing.T, addrs ...string) []*Redis {
+	var clients []*Redis
+	for _, addr := range addrs {
+		c, _ := InitRedisClient(RedisConf{
+			Service:     "redlock",
+			Addr:        addr,
+			ConnTimeOut: 100 * time.Millisecond,
+		})
+		if _, err := c.Do(nil, "PING"); err != nil {
+			t.Skipf("redis %s not available: %v", addr, err)
+		}
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func TestRedlock_LockUnlock(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	clients := redlockClients(t, "127.0.0.1:6379", "127.0.0.1:6380")
+	// 第三个节点不可用，2/3仍然满足多数
+	dead, _ := InitRedisClient(RedisConf{Addr: "127.0.0.1:1", ConnTimeOut: 100 * time.Millisecond})
+	clients = append(clients, dead)
+
+	key := "TestRedlock_LockUnlock"
+	for _, c := range clients[:2] {
+		_, _ = c.Del(ctx, key)
+	}
+
+	l1 := NewRedlock(key, clients, &RedlockOptions{Expiry: 2 * time.Second})
+	l2 := NewRedlock(key, clients, &RedlockOptions{Expiry: 2 * time.Second})
+
+	ok, err := l1.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, l1.Validity() > time.Second)
+	assert.True(t, l1.Validity() <= 2*time.Second)
+
+	ok, err = l2.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), l2.Validity())
+
+	assert.NoError(t, l1.Extend(ctx))
+	assert.NoError(t, l1.Unlock(ctx))
+	assert.Equal(t, time.Duration(0), l1.Validity())
+
+	timeout, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, l2.Lock(timeout))
+	assert.NoError(t, l2.Unlock(ctx))
+}
+
+func TestRedlock_NoQuorum(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	clients := redlockClients(t, "127.0.0.1:6379")
+	dead1, _ := InitRedisClient(RedisConf{Addr: "127.0.0.1:1", ConnTimeOut: 100 * time.Millisecond})
+	dead2, _ := InitRedisClient(RedisConf{Addr: "127.0.0.1:2", ConnTimeOut: 100 * time.Millisecond})
+	clients = append(clients, dead1, dead2)
+
+	key := "TestRedlock_NoQuorum"
+	_, _ = clients[0].Del(ctx, key)
+
+	l := NewRedlock(key, clients, nil)
+	ok, err := l.TryLock(ctx)
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	// 未达到多数时已加的锁需要被释放
+	exists, err := clients[0].Exists(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Script 封装一段lua脚本及其SHA1，执行时优先使用EVALSHA，服务端未缓存时退化为EVAL
+// 日志中用脚本名代替脚本内容
+type Script struct {
+	name     string
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewScript 创建脚本，keyCount为脚本使用的key数量，小于0时由调用方在参数中自行传入numkeys
+func NewScript(name string, keyCount int, src string) *Script {
+	h := sha1.New()
+	h.Write([]byte(src))
+	return &Script{
+		name:     name,
+		keyCount: keyCount,
+		src:      src,
+		hash:     hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+func (s *Script) Name() string {
+	return s.name
+}
+
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Do 执行脚本，先发送EVALSHA，返回NOSCRIPT时使用EVAL重试，EVAL会同时让服务端缓存脚本
+func (s *Script) Do(ctx *gin.Context, r *Redis, keysAndArgs ...interface{}) (interface{}, error) {
+	reply, err := r.do(ctx, "EVALSHA", s.args(s.name, keysAndArgs), s.args(s.hash, keysAndArgs))
+	if isNoScript(reply, err) {
+		reply, err = r.do(ctx, "EVAL", s.args(s.name, keysAndArgs), s.args(s.src, keysAndArgs))
+	}
+	return reply, err
+}
+
+// Load 预先将脚本加载到服务端，集群模式下加载到任意一个节点
+func (s *Script) Load(ctx *gin.Context, r *Redis) error {
+	_, err := redigo.String(r.do(ctx, "SCRIPT", []interface{}{"LOAD", s.name}, []interface{}{"LOAD", s.src}))
+	return err
+}
+
+func (s *Script) args(spec string, keysAndArgs []interface{}) []interface{} {
+	var args []interface{}
+	if s.keyCount < 0 {
+		args = make([]interface{}, 1+len(keysAndArgs))
+		args[0] = spec
+		copy(args[1:], keysAndArgs)
+	} else {
+		args = make([]interface{}, 2+len(keysAndArgs))
+		args[0] = spec
+		args[1] = s.keyCount
+		copy(args[2:], keysAndArgs)
+	}
+	return args
+}
+
+func isNoScript(reply interface{}, err error) bool {
+	if e, ok := err.(redigo.Error); ok {
+		return strings.HasPrefix(string(e), "NOSCRIPT ")
+	}
+	if e, ok := reply.(redigo.Error); ok {
+		return strings.HasPrefix(string(e), "NOSCRIPT ")
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScript_Do(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestScript_Do"
+	_, _ = r.Del(ctx, key)
+
+	s := NewScript("incr_by", 1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+	assert.Equal(t, "7d6a962aa4923dd6a700f73ce6ad148d2fc16ec9", s.Hash())
+
+	// 清空脚本缓存，第一次执行走 NOSCRIPT -> EVAL
+	_, err := r.Do(ctx, "SCRIPT", "FLUSH")
+	assert.NoError(t, err)
+	n, err := redis.Int64(s.Do(ctx, r, key, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// 第二次直接命中 EVALSHA
+	n, err = redis.Int64(s.Do(ctx, r, key, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	exists, err := redis.Ints(r.Do(ctx, "SCRIPT", "EXISTS", s.Hash()))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, exists)
+}
+
+func TestScript_Pipeline(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestScript_Pipeline"
+	_, _ = r.Del(ctx, key)
+
+	s := NewScript("incr_by", 1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+	_, err := r.Do(ctx, "SCRIPT", "FLUSH")
+	assert.NoError(t, err)
+
+	p := r.Pipeline()
+	first := p.PutScript(ctx, s, key, 1)
+	p.Put(ctx, "GET", key)
+	last := p.PutScript(ctx, s, key, 10)
+	res, err := p.Exec(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+
+	n, err := first.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	// 脚本之后的命令能看到脚本的执行结果
+	n, err = res[1].Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = last.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+}
+
+func TestScript_PipelineLoadError(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	s := NewScript("bad", 0, `return (`)
+	p := r.Pipeline()
+	c := p.PutScript(ctx, s)
+	_, err := p.Exec(ctx)
+	assert.Error(t, err)
+	assert.Error(t, c.Err())
+	assert.False(t, isNoScript(nil, c.Err()))
+}
@@ -0,0 +1,345 @@
+package redis
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-crt/golib/xlog"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const (
+	// 订阅 +switch-master 断线后的重连间隔上限
+	sentinelMaxBackoff = 10 * time.Second
+	// 订阅连接的探活间隔
+	sentinelPingInterval = 10 * time.Second
+)
+
+var ErrSentinelNoMaster = errors.New("redis sentinel: no master found")
+
+// 可以由从节点处理的只读命令
+var readOnlyCommands = map[string]struct{}{
+	"GET": {}, "MGET": {}, "STRLEN": {}, "GETRANGE": {}, "EXISTS": {}, "TTL": {}, "PTTL": {}, "TYPE": {},
+	"HGET": {}, "HMGET": {}, "HGETALL": {}, "HKEYS": {}, "HVALS": {}, "HLEN": {}, "HEXISTS": {}, "HSCAN": {},
+	"LRANGE": {}, "LLEN": {}, "LINDEX": {},
+	"SMEMBERS": {}, "SISMEMBER": {}, "SCARD": {}, "SRANDMEMBER": {}, "SINTER": {}, "SUNION": {}, "SDIFF": {}, "SSCAN": {},
+	"ZRANGE": {}, "ZREVRANGE": {}, "ZRANGEBYSCORE": {}, "ZREVRANGEBYSCORE": {}, "ZRANGEBYLEX": {}, "ZREVRANGEBYLEX": {},
+	"ZSCORE": {}, "ZCARD": {}, "ZCOUNT": {}, "ZLEXCOUNT": {}, "ZRANK": {}, "ZREVRANK": {}, "ZSCAN": {},
+}
+
+// sentinel 通过哨兵发现主节点，并在 +switch-master 时切换连接池的目标地址
+type sentinel struct {
+	conf RedisConf
+
+	mu       sync.RWMutex
+	master   string
+	replicas []string
+
+	pool    *redigo.Pool
+	replica *redigo.Pool
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// sentinelConn 记录连接建立时的节点地址，用于在主从切换后识别过期连接
+type sentinelConn struct {
+	redigo.Conn
+	addr string
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redigo.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redigo.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func newSentinel(conf RedisConf) *sentinel {
+	s := &sentinel{
+		conf:   conf,
+		closed: make(chan struct{}),
+	}
+
+	s.pool = newPool(conf, s.dialMaster)
+	s.pool.TestOnBorrow = s.testOnBorrow(s.pool.TestOnBorrow, s.isMaster)
+	if conf.ReadFromReplica {
+		s.replica = newPool(conf, s.dialReplica)
+		s.replica.TestOnBorrow = s.testOnBorrow(s.replica.TestOnBorrow, s.isReplica)
+	}
+	return s
+}
+
+// route 返回执行命令使用的连接池及节点地址，开启ReadFromReplica时只读命令发往从节点
+func (s *sentinel) route(cmd string) (*redigo.Pool, string) {
+	if s.replica != nil {
+		if _, ok := readOnlyCommands[strings.ToUpper(cmd)]; ok {
+			return s.replica, s.conf.MasterName + "/replica"
+		}
+	}
+	return s.pool, s.masterAddr()
+}
+
+func (s *sentinel) masterAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+func (s *sentinel) isMaster(addr string) bool {
+	return addr == s.masterAddr()
+}
+
+func (s *sentinel) isReplica(addr string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if addr == s.master {
+		// 没有可用从节点时读请求会落在主节点上
+		return len(s.replicas) == 0
+	}
+	for _, replica := range s.replicas {
+		if replica == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sentinel) dialMaster() (redigo.Conn, error) {
+	addr := s.masterAddr()
+	if addr == "" {
+		var err error
+		if addr, err = s.discover(); err != nil {
+			return nil, err
+		}
+	}
+	c, err := dialAddr(s.conf, addr)()
+	if err != nil {
+		// 缓存的主节点可能已下线，重新询问哨兵
+		if addr, err = s.discover(); err != nil {
+			return nil, err
+		}
+		if c, err = dialAddr(s.conf, addr)(); err != nil {
+			return nil, err
+		}
+	}
+	return &sentinelConn{Conn: c, addr: addr}, nil
+}
+
+func (s *sentinel) dialReplica() (redigo.Conn, error) {
+	s.mu.RLock()
+	replicas := s.replicas
+	s.mu.RUnlock()
+	if len(replicas) == 0 {
+		return s.dialMaster()
+	}
+	addr := replicas[rand.Intn(len(replicas))]
+	c, err := dialAddr(s.conf, addr)()
+	if err != nil {
+		return s.dialMaster()
+	}
+	return &sentinelConn{Conn: c, addr: addr}, nil
+}
+
+// testOnBorrow 在原有探活逻辑之前检查连接是否仍指向当前节点，过期连接返回错误由连接池关闭
+func (s *sentinel) testOnBorrow(next func(redigo.Conn, time.Time) error, valid func(string) bool) func(redigo.Conn, time.Time) error {
+	return func(c redigo.Conn, t time.Time) error {
+		if sc, ok := c.(*sentinelConn); ok && !valid(sc.addr) {
+			return errors.New("redis sentinel: stale connection to " + sc.addr)
+		}
+		return next(c, t)
+	}
+}
+
+// discover 依次询问哨兵当前的主节点及可用从节点
+func (s *sentinel) discover() (string, error) {
+	var lastErr error = ErrSentinelNoMaster
+	for _, addr := range s.conf.SentinelAddrs {
+		master, replicas, err := s.query(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		s.mu.Lock()
+		s.master, s.replicas = master, replicas
+		s.mu.Unlock()
+		return master, nil
+	}
+	return "", lastErr
+}
+
+func (s *sentinel) query(addr string) (string, []string, error) {
+	c, err := s.dialSentinel(addr, s.conf.ReadTimeOut)
+	if err != nil {
+		return "", nil, err
+	}
+	defer c.Close()
+
+	res, err := redigo.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.conf.MasterName))
+	if err == redigo.ErrNil {
+		return "", nil, ErrSentinelNoMaster
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(res) != 2 {
+		return "", nil, ErrSentinelNoMaster
+	}
+	master := net.JoinHostPort(res[0], res[1])
+
+	if !s.conf.ReadFromReplica {
+		return master, nil, nil
+	}
+	// 从节点查询失败不影响主节点发现，读请求退化为读主节点
+	values, err := redigo.Values(c.Do("SENTINEL", "slaves", s.conf.MasterName))
+	if err != nil {
+		return master, nil, nil
+	}
+	var replicas []string
+	for _, v := range values {
+		info, err := redigo.StringMap(v, nil)
+		if err != nil {
+			continue
+		}
+		flags := info["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+		replicas = append(replicas, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return master, replicas, nil
+}
+
+func (s *sentinel) dialSentinel(addr string, readTimeout time.Duration) (redigo.Conn, error) {
+	return redigo.Dial(
+		"tcp",
+		addr,
+		redigo.DialPassword(s.conf.SentinelPassword),
+		redigo.DialConnectTimeout(s.conf.ConnTimeOut),
+		redigo.DialReadTimeout(readTimeout),
+		redigo.DialWriteTimeout(s.conf.WriteTimeOut),
+	)
+}
+
+// watch 订阅哨兵的 +switch-master 事件，断线后指数退避重连，直到close
+func (s *sentinel) watch() {
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		addr := s.conf.SentinelAddrs[i%len(s.conf.SentinelAddrs)]
+		subscribed, err := s.subscribe(addr)
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		if subscribed {
+			backoff = 100 * time.Millisecond
+		}
+		if err != nil {
+			xlog.WarnLogger(nil, "redis sentinel subscribe error: "+err.Error(), xlog.String("prot", "redis"), xlog.String("sentinel", addr))
+		}
+
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > sentinelMaxBackoff {
+			backoff = sentinelMaxBackoff
+		}
+	}
+}
+
+func (s *sentinel) subscribe(addr string) (bool, error) {
+	c, err := s.dialSentinel(addr, 0)
+	if err != nil {
+		return false, err
+	}
+	psc := redigo.PubSubConn{Conn: c}
+	defer psc.Close()
+
+	if err = psc.Subscribe("+switch-master"); err != nil {
+		return false, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(sentinelPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closed:
+				_ = psc.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = psc.Ping("")
+			}
+		}
+	}()
+
+	subscribed := false
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * sentinelPingInterval).(type) {
+		case redigo.Subscription:
+			if !subscribed {
+				subscribed = true
+				// 断线期间可能错过了切换事件，订阅成功后主动刷新一次
+				_, _ = s.discover()
+			}
+		case redigo.Message:
+			s.onSwitchMaster(string(v.Data))
+		case error:
+			return subscribed, v
+		}
+	}
+}
+
+// onSwitchMaster 处理 "<master name> <old ip> <old port> <new ip> <new port>"
+func (s *sentinel) onSwitchMaster(msg string) {
+	parts := strings.Fields(msg)
+	if len(parts) != 5 || parts[0] != s.conf.MasterName {
+		return
+	}
+	master := net.JoinHostPort(parts[3], parts[4])
+	xlog.WarnLogger(nil, "redis sentinel switch master to "+master, xlog.String("prot", "redis"), xlog.String("masterName", parts[0]))
+
+	if s.conf.ReadFromReplica {
+		if _, err := s.discover(); err == nil {
+			return
+		}
+	}
+	s.mu.Lock()
+	s.master = master
+	s.mu.Unlock()
+}
+
+func (s *sentinel) close() error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	err := s.pool.Close()
+	if s.replica != nil {
+		if e := s.replica.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *sentinel) stats() redigo.PoolStats {
+	stats := s.pool.Stats()
+	if s.replica != nil {
+		r := s.replica.Stats()
+		stats.ActiveCount += r.ActiveCount
+		stats.IdleCount += r.IdleCount
+	}
+	return stats
+}
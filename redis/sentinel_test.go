@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinel_OnSwitchMaster(t *testing.T) {
+	s := newSentinel(RedisConf{MasterName: "mymaster", SentinelAddrs: []string{"127.0.0.1:26379"}})
+	s.master = "127.0.0.1:6379"
+
+	s.onSwitchMaster("othermaster 127.0.0.1 6379 127.0.0.1 6381")
+	assert.Equal(t, "127.0.0.1:6379", s.masterAddr())
+
+	s.onSwitchMaster("mymaster 127.0.0.1 6379 127.0.0.1 6380")
+	assert.Equal(t, "127.0.0.1:6380", s.masterAddr())
+}
+
+func TestSentinel_TestOnBorrow(t *testing.T) {
+	s := newSentinel(RedisConf{MasterName: "mymaster", SentinelAddrs: []string{"127.0.0.1:26379"}})
+	s.master = "127.0.0.1:6379"
+
+	conn := &sentinelConn{addr: "127.0.0.1:6379"}
+	assert.NoError(t, s.pool.TestOnBorrow(conn, time.Now()))
+
+	s.master = "127.0.0.1:6380"
+	assert.Error(t, s.pool.TestOnBorrow(conn, time.Now()))
+}
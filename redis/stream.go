@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+)
+
+// StreamMessage stream中的一条消息，已被删除的pending消息Values为nil
+type StreamMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XStream XREAD/XREADGROUP 返回的一个stream及其消息
+type XStream struct {
+	Stream   string
+	Messages []StreamMessage
+}
+
+// XPendingMessage XPENDING 扩展格式返回的一条pending消息
+type XPendingMessage struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	RetryCount int64
+}
+
+// 向stream追加消息，id传""或"*"时由服务端生成，maxLen大于0时按近似长度裁剪
+// return: 消息id
+func (r *Redis) XAdd(ctx *gin.Context, key string, maxLen int64, id string, values map[string]interface{}) (string, error) {
+	args := packArgs(key)
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	if id == "" {
+		id = "*"
+	}
+	args = append(args, id)
+	for field, value := range values {
+		args = append(args, field, parseToString(value))
+	}
+	return redis.String(r.Do(ctx, "XADD", args...))
+}
+
+// 返回stream中的消息数量
+func (r *Redis) XLen(ctx *gin.Context, key string) (int64, error) {
+	return redis.Int64(r.Do(ctx, "XLEN", key))
+}
+
+// 删除stream中的消息，返回实际删除的数量
+func (r *Redis) XDel(ctx *gin.Context, key string, ids ...string) (int64, error) {
+	return redis.Int64(r.Do(ctx, "XDEL", packArgs(key, ids)...))
+}
+
+// 返回id在[start, end]之间的消息，count小于等于0时不限制数量
+func (r *Redis) XRange(ctx *gin.Context, key, start, end string, count int64) ([]StreamMessage, error) {
+	args := packArgs(key, start, end)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return parseStreamMessages(r.Do(ctx, "XRANGE", args...))
+}
+
+// 创建消费组，stream不存在时自动创建；消费组已存在时不返回错误
+// param: start 消费组开始消费的位置，"$"表示只消费新消息，"0"表示从头消费
+func (r *Redis) XGroupCreate(ctx *gin.Context, key, group, start string) error {
+	_, err := redis.String(r.Do(ctx, "XGROUP", "CREATE", key, group, start, "MKSTREAM"))
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// 删除消费组
+func (r *Redis) XGroupDestroy(ctx *gin.Context, key, group string) (int64, error) {
+	return redis.Int64(r.Do(ctx, "XGROUP", "DESTROY", key, group))
+}
+
+// 以消费组的身份读取消息，block大于0时最多阻塞block，超时没有消息时返回nil
+// param: streamsAndIDs 先依次传入stream，再依次传入对应的id，id为">"表示读取从未投递过的消息
+func (r *Redis) XReadGroup(ctx *gin.Context, group, consumer string, count int64, block time.Duration, streamsAndIDs ...string) ([]XStream, error) {
+	if len(streamsAndIDs) == 0 || len(streamsAndIDs)%2 != 0 {
+		return nil, errors.New("streams and ids mismatch")
+	}
+	args := packArgs("GROUP", group, consumer)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	var timeout time.Duration
+	if block > 0 {
+		args = append(args, "BLOCK", block.Milliseconds())
+		timeout = block + r.readTimeOut
+	}
+	args = append(args, "STREAMS")
+	args = append(args, packArgs(streamsAndIDs)...)
+
+	reply, err := r.doTimeout(ctx, timeout, "XREADGROUP", args, args)
+	res, err := parseXStreams(reply, err)
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return res, err
+}
+
+// 确认消息已处理，返回确认成功的数量
+func (r *Redis) XAck(ctx *gin.Context, key, group string, ids ...string) (int64, error) {
+	return redis.Int64(r.Do(ctx, "XACK", packArgs(key, group, ids)...))
+}
+
+// 返回消费组中pending消息的明细，consumer为""时返回所有消费者的
+func (r *Redis) XPending(ctx *gin.Context, key, group, start, end string, count int64, consumer string) ([]XPendingMessage, error) {
+	args := packArgs(key, group, start, end, count)
+	if consumer != "" {
+		args = append(args, consumer)
+	}
+	values, err := redis.Values(r.Do(ctx, "XPENDING", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res := make([]XPendingMessage, 0, len(values))
+	for _, v := range values {
+		item, err := redis.Values(v, nil)
+		if err != nil || len(item) != 4 {
+			return nil, errors.New("xpending err format")
+		}
+		id, _ := redis.String(item[0], nil)
+		name, _ := redis.String(item[1], nil)
+		idle, _ := redis.Int64(item[2], nil)
+		retry, _ := redis.Int64(item[3], nil)
+		res = append(res, XPendingMessage{
+			ID:         id,
+			Consumer:   name,
+			Idle:       time.Duration(idle) * time.Millisecond,
+			RetryCount: retry,
+		})
+	}
+	return res, nil
+}
+
+// 将空闲超过minIdle的pending消息转移给consumer，返回转移成功的消息
+func (r *Redis) XClaim(ctx *gin.Context, key, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamMessage, error) {
+	args := packArgs(key, group, consumer, minIdle.Milliseconds(), ids)
+	return parseStreamMessages(r.Do(ctx, "XCLAIM", args...))
+}
+
+// 从start开始扫描并转移空闲超过minIdle的pending消息，返回下一次扫描的起点，"0-0"表示扫描结束
+func (r *Redis) XAutoClaim(ctx *gin.Context, key, group, consumer string, minIdle time.Duration, start string, count int64) (string, []StreamMessage, error) {
+	args := packArgs(key, group, consumer, minIdle.Milliseconds(), start)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	values, err := redis.Values(r.Do(ctx, "XAUTOCLAIM", args...))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(values) < 2 {
+		return "", nil, errors.New("xautoclaim err format")
+	}
+	next, err := redis.String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	msgs, err := parseStreamMessages(values[1], nil)
+	return next, msgs, err
+}
+
+func parseXStreams(reply interface{}, err error) ([]XStream, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]XStream, 0, len(values))
+	for _, v := range values {
+		item, err := redis.Values(v, nil)
+		if err != nil || len(item) != 2 {
+			return nil, errors.New("xread err format")
+		}
+		stream, err := redis.String(item[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := parseStreamMessages(item[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, XStream{Stream: stream, Messages: msgs})
+	}
+	return res, nil
+}
+
+func parseStreamMessages(reply interface{}, err error) ([]StreamMessage, error) {
+	values, err := redis.Values(reply, err)
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res := make([]StreamMessage, 0, len(values))
+	for _, v := range values {
+		item, err := redis.Values(v, nil)
+		if err != nil || len(item) != 2 {
+			return nil, errors.New("stream message err format")
+		}
+		id, err := redis.String(item[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		msg := StreamMessage{ID: id}
+		if item[1] != nil {
+			if msg.Values, err = redis.StringMap(item[1], nil); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, msg)
+	}
+	return res, nil
+}
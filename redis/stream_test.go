@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedis_XAddXReadGroupXAck(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestRedis_XAddXReadGroupXAck"
+	group := "g1"
+	_, _ = r.Del(ctx, key)
+
+	assert.NoError(t, r.XGroupCreate(ctx, key, group, "$"))
+	// 重复创建不报错
+	assert.NoError(t, r.XGroupCreate(ctx, key, group, "$"))
+
+	id1, err := r.XAdd(ctx, key, 0, "*", map[string]interface{}{"name": "a", "n": 1})
+	assert.NoError(t, err)
+	id2, err := r.XAdd(ctx, key, 0, "", map[string]interface{}{"name": "b"})
+	assert.NoError(t, err)
+
+	n, err := r.XLen(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	msgs, err := r.XRange(ctx, key, "-", "+", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamMessage{
+		{ID: id1, Values: map[string]string{"name": "a", "n": "1"}},
+		{ID: id2, Values: map[string]string{"name": "b"}},
+	}, msgs)
+
+	streams, err := r.XReadGroup(ctx, group, "c1", 10, 100*time.Millisecond, key, ">")
+	assert.NoError(t, err)
+	assert.Len(t, streams, 1)
+	assert.Equal(t, key, streams[0].Stream)
+	assert.Equal(t, msgs, streams[0].Messages)
+
+	// 没有新消息时阻塞到超时返回nil
+	streams, err = r.XReadGroup(ctx, group, "c1", 10, 100*time.Millisecond, key, ">")
+	assert.NoError(t, err)
+	assert.Nil(t, streams)
+
+	pending, err := r.XPending(ctx, key, group, "-", "+", 10, "")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+	assert.Equal(t, "c1", pending[0].Consumer)
+	assert.Equal(t, int64(1), pending[0].RetryCount)
+
+	claimed, err := r.XClaim(ctx, key, group, "c2", 0, id1)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, id1, claimed[0].ID)
+
+	next, claimed, err := r.XAutoClaim(ctx, key, group, "c3", 0, "0", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "0-0", next)
+	assert.Len(t, claimed, 2)
+
+	acked, err := r.XAck(ctx, key, group, id1, id2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), acked)
+
+	n, err = r.XDel(ctx, key, id1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestStreamWorker(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestStreamWorker"
+	_, _ = r.Del(ctx, key, key+":dead")
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	worker, err := r.NewStreamWorker(StreamWorkerOptions{
+		Stream:        key,
+		Group:         "g1",
+		Consumer:      "c1",
+		Concurrency:   2,
+		Block:         100 * time.Millisecond,
+		ClaimIdle:     50 * time.Millisecond,
+		ClaimInterval: 100 * time.Millisecond,
+		MaxDeliveries: 2,
+	}, func(msg StreamMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.Values["name"]]++
+		if msg.Values["name"] == "poison" {
+			return errors.New("poison message")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, worker.Start(ctx))
+
+	_, err = r.XAdd(ctx, key, 0, "*", map[string]interface{}{"name": "ok"})
+	assert.NoError(t, err)
+	_, err = r.XAdd(ctx, key, 0, "*", map[string]interface{}{"name": "poison"})
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+	worker.Stop()
+
+	mu.Lock()
+	assert.Equal(t, 1, handled["ok"])
+	assert.Equal(t, 2, handled["poison"])
+	mu.Unlock()
+
+	pending, err := r.XPending(ctx, key, "g1", "-", "+", 10, "")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+
+	dead, err := r.XRange(ctx, key+":dead", "-", "+", 0)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "poison", dead[0].Values["name"])
+	assert.Equal(t, key, dead[0].Values["_stream"])
+}
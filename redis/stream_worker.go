@@ -0,0 +1,250 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-crt/golib/xlog"
+)
+
+// StreamHandler 处理一条消息，返回nil时消息被确认，否则留在pending中等待重新投递
+type StreamHandler func(msg StreamMessage) error
+
+type StreamWorkerOptions struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// 处理消息的goroutine数量，默认1
+	Concurrency int
+	// 每次读取的最大消息数，默认10
+	BatchSize int64
+	// 没有新消息时每次读取的阻塞时间，同时也是Stop的最大等待时间，默认2s
+	Block time.Duration
+	// pending消息空闲超过该时间后被当前消费者认领并重新处理，默认1min
+	ClaimIdle time.Duration
+	// 扫描pending消息的间隔，默认30s
+	ClaimInterval time.Duration
+	// 投递次数达到该值的消息转移到死信stream并确认，0表示不限制
+	MaxDeliveries int64
+	// 死信stream，默认为 Stream+":dead"
+	DeadLetterStream string
+}
+
+func (o *StreamWorkerOptions) checkOptions() error {
+	if o.Stream == "" || o.Group == "" || o.Consumer == "" {
+		return errors.New("stream, group and consumer are required")
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 10
+	}
+	if o.Block <= 0 {
+		o.Block = 2 * time.Second
+	}
+	if o.ClaimIdle <= 0 {
+		o.ClaimIdle = time.Minute
+	}
+	if o.ClaimInterval <= 0 {
+		o.ClaimInterval = 30 * time.Second
+	}
+	if o.DeadLetterStream == "" {
+		o.DeadLetterStream = o.Stream + ":dead"
+	}
+	return nil
+}
+
+// StreamWorker 消费组worker，N个goroutine并发处理消息，处理成功后确认
+// 定期认领其他消费者长时间未确认的消息，超过最大投递次数的消息转入死信stream
+type StreamWorker struct {
+	redis   *Redis
+	opts    StreamWorkerOptions
+	handler StreamHandler
+
+	jobs    chan StreamMessage
+	stop    chan struct{}
+	once    sync.Once
+	fetchWg sync.WaitGroup
+	workWg  sync.WaitGroup
+}
+
+func (r *Redis) NewStreamWorker(opts StreamWorkerOptions, handler StreamHandler) (*StreamWorker, error) {
+	if err := opts.checkOptions(); err != nil {
+		return nil, err
+	}
+	return &StreamWorker{
+		redis:   r,
+		opts:    opts,
+		handler: handler,
+		jobs:    make(chan StreamMessage, opts.Concurrency),
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Start 创建消费组（已存在时忽略）并启动读取、认领及处理goroutine
+func (w *StreamWorker) Start(ctx *gin.Context) error {
+	if err := w.redis.XGroupCreate(ctx, w.opts.Stream, w.opts.Group, "0"); err != nil {
+		return err
+	}
+
+	for i := 0; i < w.opts.Concurrency; i++ {
+		w.workWg.Add(1)
+		go w.work()
+	}
+	w.fetchWg.Add(2)
+	go w.read()
+	go w.claim()
+	return nil
+}
+
+// Stop 停止读取新消息，等待已读取的消息处理完成后返回
+func (w *StreamWorker) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+		w.fetchWg.Wait()
+		close(w.jobs)
+	})
+	w.workWg.Wait()
+}
+
+func (w *StreamWorker) read() {
+	defer w.fetchWg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		streams, err := w.redis.XReadGroup(nil, w.opts.Group, w.opts.Consumer, w.opts.BatchSize, w.opts.Block, w.opts.Stream, ">")
+		if err != nil {
+			xlog.WarnLogger(nil, "stream worker read error: "+err.Error(), xlog.String("prot", "redis"), xlog.String("stream", w.opts.Stream))
+			if !w.sleep(time.Second) {
+				return
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				w.jobs <- msg
+			}
+		}
+	}
+}
+
+func (w *StreamWorker) claim() {
+	defer w.fetchWg.Done()
+	for w.sleep(w.opts.ClaimInterval) {
+		if err := w.reclaim(); err != nil {
+			xlog.WarnLogger(nil, "stream worker claim error: "+err.Error(), xlog.String("prot", "redis"), xlog.String("stream", w.opts.Stream))
+		}
+	}
+}
+
+// reclaim 认领空闲超时的pending消息，投递次数超限的转入死信stream
+func (w *StreamWorker) reclaim() error {
+	pending, err := w.redis.XPending(nil, w.opts.Stream, w.opts.Group, "-", "+", w.opts.BatchSize*int64(w.opts.Concurrency), "")
+	if err != nil {
+		return err
+	}
+
+	var retry, dead []string
+	for _, p := range pending {
+		if p.Idle < w.opts.ClaimIdle {
+			continue
+		}
+		if w.opts.MaxDeliveries > 0 && p.RetryCount >= w.opts.MaxDeliveries {
+			dead = append(dead, p.ID)
+		} else {
+			retry = append(retry, p.ID)
+		}
+	}
+
+	if len(dead) > 0 {
+		msgs, err := w.redis.XClaim(nil, w.opts.Stream, w.opts.Group, w.opts.Consumer, w.opts.ClaimIdle, dead...)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := w.deadLetter(msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(retry) > 0 {
+		msgs, err := w.redis.XClaim(nil, w.opts.Stream, w.opts.Group, w.opts.Consumer, w.opts.ClaimIdle, retry...)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.Values == nil {
+				// 消息已被XDEL删除，无法再处理
+				_, _ = w.redis.XAck(nil, w.opts.Stream, w.opts.Group, msg.ID)
+				continue
+			}
+			select {
+			case w.jobs <- msg:
+			case <-w.stop:
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (w *StreamWorker) deadLetter(msg StreamMessage) error {
+	if msg.Values != nil {
+		values := make(map[string]interface{}, len(msg.Values)+2)
+		for k, v := range msg.Values {
+			values[k] = v
+		}
+		values["_stream"] = w.opts.Stream
+		values["_id"] = msg.ID
+		if _, err := w.redis.XAdd(nil, w.opts.DeadLetterStream, 0, "*", values); err != nil {
+			return err
+		}
+	}
+	_, err := w.redis.XAck(nil, w.opts.Stream, w.opts.Group, msg.ID)
+	return err
+}
+
+func (w *StreamWorker) work() {
+	defer w.workWg.Done()
+	for msg := range w.jobs {
+		if err := w.handle(msg); err != nil {
+			xlog.WarnLogger(nil, "stream worker handle error: "+err.Error(), xlog.String("prot", "redis"),
+				xlog.String("stream", w.opts.Stream), xlog.String("id", msg.ID))
+			continue
+		}
+		if _, err := w.redis.XAck(nil, w.opts.Stream, w.opts.Group, msg.ID); err != nil {
+			xlog.WarnLogger(nil, "stream worker ack error: "+err.Error(), xlog.String("prot", "redis"),
+				xlog.String("stream", w.opts.Stream), xlog.String("id", msg.ID))
+		}
+	}
+}
+
+func (w *StreamWorker) handle(msg StreamMessage) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New("handler panic")
+			xlog.ErrorLogger(nil, "stream worker handler panic", xlog.Any("panic", e), xlog.String("id", msg.ID))
+		}
+	}()
+	return w.handler(msg)
+}
+
+// sleep 等待d，期间收到停止信号时返回false
+func (w *StreamWorker) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-w.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var ErrTxFailed = errors.New("redis tx: watched keys changed, max retries exceeded")
+
+// errTxAborted EXEC返回nil，事务因watch的key被修改而未执行
+var errTxAborted = errors.New("redis tx: aborted")
+
+// Tx 一次WATCH事务，所有命令都在同一个连接上执行
+// Do 立即执行并返回结果，用于在事务中读取被watch的key；Queue 记录写命令，在回调返回后以 MULTI/EXEC 原子执行
+type Tx struct {
+	redis *Redis
+	ctx   *gin.Context
+	conn  redigo.Conn
+	addr  string
+	slot  int
+
+	queued []*Cmd
+}
+
+// Do 在事务连接上立即执行命令
+func (tx *Tx) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if err := tx.checkSlot(cmd, args); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	reply, err := tx.conn.Do(cmd, args...)
+	tx.redis.logCommand(tx.ctx, start, tx.addr, cmd, args, err)
+	return reply, err
+}
+
+// Queue 记录一条在EXEC时执行的命令
+func (tx *Tx) Queue(cmd string, args ...interface{}) {
+	tx.queued = append(tx.queued, &Cmd{cmd: cmd, args: args})
+}
+
+// checkSlot 集群模式下事务中的所有key必须与watch的key在同一个slot
+func (tx *Tx) checkSlot(cmd string, args []interface{}) error {
+	if tx.slot < 0 {
+		return nil
+	}
+	for _, key := range commandKeys(cmd, args) {
+		if keySlot(key) != tx.slot {
+			return ErrCrossSlot
+		}
+	}
+	return nil
+}
+
+// Watch 以乐观锁方式执行事务：WATCH keys 后调用fn，fn中通过 tx.Do 读取、tx.Queue 写入，
+// fn返回后以 MULTI/EXEC 提交。watch的key在提交前被修改时EXEC返回nil，此时重新执行整个流程，
+// 最多重试 MaxTxRetries 次，仍失败时返回 ErrTxFailed。
+// fn返回错误时放弃事务并原样返回该错误；fn没有Queue任何命令时不发送 MULTI/EXEC，返回nil
+// return: EXEC中每条命令的结果，命令级别的错误以 redigo.Error 的形式出现在对应位置
+func (r *Redis) Watch(ctx *gin.Context, fn func(tx *Tx) error, keys ...string) ([]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("redis tx: no keys to watch")
+	}
+	slot := -1
+	if r.cluster != nil {
+		slot = keySlot(keys[0])
+		for _, key := range keys[1:] {
+			if keySlot(key) != slot {
+				return nil, ErrCrossSlot
+			}
+		}
+	}
+
+	for i := 0; i <= r.maxTxRetries; i++ {
+		replies, err := r.watchOnce(ctx, fn, keys, slot)
+		if err != errTxAborted {
+			return replies, err
+		}
+	}
+	return nil, ErrTxFailed
+}
+
+// watchOnce 执行一次事务，需要重试时返回 errTxAborted
+func (r *Redis) watchOnce(ctx *gin.Context, fn func(tx *Tx) error, keys []string, slot int) ([]interface{}, error) {
+	addr, conn := r.getConn(keys[0])
+	defer conn.Close()
+	if err := conn.Err(); err != nil {
+		return nil, err
+	}
+
+	tx := &Tx{redis: r, ctx: ctx, conn: conn, addr: addr, slot: slot}
+	if _, err := tx.Do("WATCH", packArgs(keys)...); err != nil {
+		if moved, _, target := parseRedirect(err); moved && r.cluster != nil {
+			// slot已迁移，更新路由后由下一次重试发往新节点
+			r.cluster.setSlot(slot, target)
+			r.cluster.refreshAsync()
+			return nil, errTxAborted
+		}
+		return nil, err
+	}
+
+	if err := fn(tx); err != nil {
+		_, _ = conn.Do("UNWATCH")
+		return nil, err
+	}
+	if len(tx.queued) == 0 {
+		_, _ = conn.Do("UNWATCH")
+		return nil, nil
+	}
+	for _, c := range tx.queued {
+		if err := tx.checkSlot(c.cmd, c.args); err != nil {
+			_, _ = conn.Do("UNWATCH")
+			return nil, err
+		}
+	}
+	return tx.exec()
+}
+
+// exec 以 MULTI/EXEC 提交排队的命令，日志中记录一条EXEC及其包含的命令名
+func (tx *Tx) exec() ([]interface{}, error) {
+	start := time.Now()
+	names := make([]interface{}, len(tx.queued))
+	err := tx.conn.Send("MULTI")
+	for i, c := range tx.queued {
+		names[i] = strings.ToUpper(c.cmd)
+		if err == nil {
+			err = tx.conn.Send(c.cmd, c.args...)
+		}
+	}
+	var replies []interface{}
+	if err == nil {
+		// MULTI及入队命令的回复在EXEC的回复之前依次返回，入队错误会使EXEC返回EXECABORT
+		replies, err = redigo.Values(tx.conn.Do("EXEC"))
+	}
+	tx.redis.logCommand(tx.ctx, start, tx.addr, "EXEC", names, err)
+	if err == redigo.ErrNil {
+		return nil, errTxAborted
+	}
+	return replies, err
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis_Watch(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	key := "TestRedis_Watch"
+	_, _ = r.Del(ctx, key)
+	_, _ = r.Do(ctx, "SET", key, 10)
+
+	incr := func(tx *Tx) error {
+		n, err := redis.Int64(tx.Do("GET", key))
+		if err != nil {
+			return err
+		}
+		tx.Queue("SET", key, n+1)
+		return nil
+	}
+	replies, err := r.Watch(ctx, incr, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"OK"}, replies)
+	n, _ := redis.Int64(r.Do(ctx, "GET", key))
+	assert.Equal(t, int64(11), n)
+
+	// 回调中修改watch的key，EXEC返回nil后自动重试
+	attempts := 0
+	_, err = r.Watch(ctx, func(tx *Tx) error {
+		attempts++
+		if attempts == 1 {
+			_, _ = r.Do(ctx, "SET", key, 100)
+		}
+		return incr(tx)
+	}, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	n, _ = redis.Int64(r.Do(ctx, "GET", key))
+	assert.Equal(t, int64(101), n)
+
+	// 每次都被修改，超过重试次数后返回 ErrTxFailed
+	attempts = 0
+	_, err = r.Watch(ctx, func(tx *Tx) error {
+		attempts++
+		_, _ = r.Do(ctx, "INCR", key)
+		return incr(tx)
+	}, key)
+	assert.Equal(t, ErrTxFailed, err)
+	assert.Equal(t, r.maxTxRetries+1, attempts)
+
+	// 回调返回错误时放弃事务
+	errAbort := errors.New("abort")
+	_, err = r.Watch(ctx, func(tx *Tx) error {
+		tx.Queue("SET", key, 0)
+		return errAbort
+	}, key)
+	assert.Equal(t, errAbort, err)
+	n, _ = redis.Int64(r.Do(ctx, "GET", key))
+	assert.NotEqual(t, int64(0), n)
+
+	_, _ = r.Del(ctx, key)
+}
+
+func TestRedis_WatchNoRetries(t *testing.T) {
+	setup()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	assert.Equal(t, defaultMaxTxRetries, r.maxTxRetries)
+
+	// MaxTxRetries 配置为0时不重试
+	retries := 0
+	once, err := InitRedisClient(RedisConf{Service: "once", Addr: "127.0.0.1:6379", MaxTxRetries: &retries})
+	assert.NoError(t, err)
+	defer once.Close()
+
+	key := "TestRedis_WatchNoRetries"
+	_, _ = once.Del(ctx, key)
+	attempts := 0
+	_, err = once.Watch(ctx, func(tx *Tx) error {
+		attempts++
+		_, _ = once.Do(ctx, "INCR", key)
+		tx.Queue("INCR", key)
+		return nil
+	}, key)
+	assert.Equal(t, ErrTxFailed, err)
+	assert.Equal(t, 1, attempts)
+
+	_, _ = once.Del(ctx, key)
+}